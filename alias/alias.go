@@ -34,13 +34,11 @@ func (f *Func) String() string {
 	return f.BaseStr
 }
 
-// Call is the method to support callableT and it calls the alias-function.
-func (f *Func) Call(ctx context.Context, cmd *shell.Cmd) (next int, err error) {
+// expandParams replaces `$1`, `$*`, `$~1` and `$~*` in base with
+// the arguments of cmd. It returns false when base has no parameters.
+func expandParams(base string, cmd *shell.Cmd) (string, bool) {
 	isReplaced := false
-	if dbg {
-		print("Func.Call('", cmd.Arg(0), "')\n")
-	}
-	cmdline := paramMatch.ReplaceAllStringFunc(f.BaseStr, func(s string) string {
+	result := paramMatch.ReplaceAllStringFunc(base, func(s string) string {
 		if s == "$~*" {
 			isReplaced = true
 			if cmd.Args() != nil && len(cmd.Args()) >= 2 {
@@ -73,7 +71,15 @@ func (f *Func) Call(ctx context.Context, cmd *shell.Cmd) (next int, err error) {
 		}
 		return s
 	})
+	return result, isReplaced
+}
 
+// Call is the method to support callableT and it calls the alias-function.
+func (f *Func) Call(ctx context.Context, cmd *shell.Cmd) (next int, err error) {
+	if dbg {
+		print("Func.Call('", cmd.Arg(0), "')\n")
+	}
+	cmdline, isReplaced := expandParams(f.BaseStr, cmd)
 	if !isReplaced {
 		var buffer strings.Builder
 		buffer.WriteString(f.BaseStr)
@@ -97,7 +103,7 @@ var paramMatch = regexp.MustCompile(`\$(\~)?(\*|[0-9]+)`)
 func AllNames() []completion.Element {
 	names := make([]completion.Element, 0, len(Table))
 	for name1 := range Table {
-		names = append(names, completion.Element1(name1))
+		names = append(names, completion.Candidate{Text: name1, Kind: completion.KindAlias})
 	}
 	return names
 }
@@ -0,0 +1,88 @@
+package alias
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// ShellFunc is the function defined with `function NAME ... end`.
+type ShellFunc struct {
+	Name string
+	Body []string
+}
+
+// NewShellFunc is the constructor for ShellFunc
+func NewShellFunc(name string, body []string) *ShellFunc {
+	return &ShellFunc{Name: name, Body: body}
+}
+
+// String is the method to support fmt.Stringer
+func (f *ShellFunc) String() string {
+	return strings.Join(f.Body, " ; ")
+}
+
+type localKeyT struct{}
+
+var localKey localKeyT
+
+// localFrame has the values of the variables before `local` is called.
+// nil means that the variable was not defined.
+type localFrame map[string]*string
+
+// Local saves the environment variable `name` to restore it
+// when the current function returns.
+func Local(ctx context.Context, name string) error {
+	frame, ok := ctx.Value(localKey).(localFrame)
+	if !ok {
+		return errors.New("local: not in a function")
+	}
+	key := strings.ToUpper(name)
+	if _, ok := frame[key]; ok {
+		return nil
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		frame[key] = &value
+	} else {
+		frame[key] = nil
+	}
+	return nil
+}
+
+func (frame localFrame) restore() {
+	for name, value := range frame {
+		if value == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *value)
+		}
+	}
+}
+
+// Call is the method to support callableT and it executes the body of the function.
+func (f *ShellFunc) Call(ctx context.Context, cmd *shell.Cmd) (int, error) {
+	if dbg {
+		print("ShellFunc.Call('", cmd.Arg(0), "')\n")
+	}
+	body := shell.BufStream{}
+	for _, line := range f.Body {
+		line, _ = expandParams(line, cmd)
+		body.Add(line)
+	}
+	frame := localFrame{}
+	defer frame.restore()
+
+	errorlevel, err := cmd.Loop(context.WithValue(ctx, localKey, frame), &body)
+	if err == io.EOF {
+		// the errorlevel of the last command
+		return errorlevel, nil
+	}
+	if err == shell.ErrReturn {
+		return errorlevel, nil
+	}
+	return errorlevel, err
+}
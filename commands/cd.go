@@ -9,11 +9,22 @@ import (
 	"strings"
 
 	"github.com/zetamatta/nyagos/dos"
+	"github.com/zetamatta/nyagos/readline"
 )
 
 var cdHistory = make([]string, 0, 100)
 var cdUniq = map[string]int{}
 
+func init() {
+	readline.CdHistory = func() []string {
+		list := make([]string, 0, len(cdHistory))
+		for i := len(cdHistory) - 1; i >= 0; i-- {
+			list = append(list, cdHistory[i])
+		}
+		return list
+	}
+}
+
 func pushCdHistory() {
 	directory, err := os.Getwd()
 	if err != nil {
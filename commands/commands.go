@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"io"
+	"os"
 	"regexp"
 	"strings"
 
@@ -18,10 +19,13 @@ type Param interface {
 	Arg(int) string
 	Args() []string
 	SetArgs(s []string)
+	SourceArgs() []string
+	ExpandArgs(context.Context, []string) ([]string, []string, error)
 	In() io.Reader
 	Out() io.Writer
 	Err() io.Writer
 	Term() io.Writer
+	File(int) *os.File
 	RawArgs() []string
 	Spawnlp(context.Context, []string, []string) (int, error)
 	Loop(context.Context, shell.Stream) (int, error)
@@ -55,11 +59,25 @@ func Exec(ctx context.Context, cmd Param) (int, bool, error) {
 	return next, true, err
 }
 
+// IsBuiltIn returns true when name is the built-in command
+// (or the drive-letter such as `C:`).
+func IsBuiltIn(name string) bool {
+	name = strings.ToLower(name)
+	if len(name) == 2 && strings.HasSuffix(name, ":") {
+		return true
+	}
+	if m := unscoNamePattern.FindStringSubmatch(name); m != nil {
+		name = m[1]
+	}
+	_, ok := buildInCommand[name]
+	return ok
+}
+
 // AllNames returns all command-names for completion package.
 func AllNames() []completion.Element {
 	names := make([]completion.Element, 0, len(buildInCommand))
 	for name1 := range buildInCommand {
-		names = append(names, completion.Element1(name1))
+		names = append(names, completion.Candidate{Text: name1, Kind: completion.KindBuiltIn})
 	}
 	return names
 }
@@ -69,12 +87,16 @@ func init() {
 		".":        cmdSource,
 		"alias":    cmdAlias,
 		"attrib":   cmdAttrib,
+		"bg":       cmdBg,
 		"bindkey":  cmdBindkey,
 		"box":      cmdBox,
+		"break":    cmdBreak,
 		"cd":       cmdCd,
 		"clip":     cmdClip,
 		"clone":    cmdClone,
 		"cls":      cmdCls,
+		"complete": cmdComplete,
+		"continue": cmdContinue,
 		"chmod":    cmdChmod,
 		"copy":     cmdCopy,
 		"del":      cmdDel,
@@ -85,11 +107,16 @@ func init() {
 		"env":      cmdEnv,
 		"erase":    cmdDel,
 		"exit":     cmdExit,
+		"fg":       cmdFg,
+		"for":      cmdFor,
 		"foreach":  cmdForeach,
+		"function": cmdFunction,
 		"history":  cmdHistory,
 		"if":       cmdIf,
+		"jobs":     cmdJobs,
 		"ln":       cmdLn,
 		"lnk":      cmdLnk,
+		"local":    cmdLocal,
 		"kill":     cmdKill,
 		"ls":       cmdLs,
 		"md":       cmdMkdir,
@@ -102,13 +129,18 @@ func init() {
 		"pushd":    cmdPushd,
 		"pwd":      cmdPwd,
 		"rd":       cmdRmdir,
+		"rehash":   cmdRehash,
 		"rem":      cmdRem,
+		"return":   cmdReturn,
 		"rmdir":    cmdRmdir,
 		"set":      cmdSet,
 		"source":   cmdSource,
 		"su":       cmdSu,
 		"touch":    cmdTouch,
 		"type":     cmdType,
+		"until":    cmdUntil,
+		"wait":     cmdWait,
 		"which":    cmdWhich,
+		"while":    cmdWhile,
 	}
 }
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/zetamatta/nyagos/completion"
+)
+
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.ContainsAny(s, " &|<>;") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// printSpec prints the spec as the `complete` commands to define it.
+func printSpec(w io.Writer, path string, spec *completion.Spec) {
+	var buffer strings.Builder
+	buffer.WriteString("complete ")
+	buffer.WriteString(path)
+	if spec.Description != "" {
+		fmt.Fprintf(&buffer, " -d %s", quoteIfNeeded(spec.Description))
+	}
+	for _, f := range spec.Flags {
+		fmt.Fprintf(&buffer, " -f %s", f.Name)
+		if f.Description != "" {
+			fmt.Fprintf(&buffer, " -d %s", quoteIfNeeded(f.Description))
+		}
+		if f.Value != nil {
+			fmt.Fprintf(&buffer, " -v %s", quoteIfNeeded(f.Value.String()))
+		}
+	}
+	for _, a := range spec.Args {
+		fmt.Fprintf(&buffer, " -a %s", quoteIfNeeded(a.String()))
+	}
+	fmt.Fprintln(w, buffer.String())
+
+	names := make([]string, 0, len(spec.Subcommands))
+	for name := range spec.Subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printSpec(w, path+" "+name, spec.Subcommands[name])
+	}
+}
+
+// importScript imports the completion script of bash, fish or zsh.
+func importScript(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	firstLine := string(data)
+	if i := strings.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	kind := completion.ScriptKind(path, strings.TrimSpace(firstLine))
+	names, err := completion.ImportScript(bytes.NewReader(data), kind)
+	if err != nil {
+		return err
+	}
+	if len(names) <= 0 {
+		return fmt.Errorf("%s: no definitions for %s are found", path, kind)
+	}
+	return nil
+}
+
+func cmdComplete(ctx context.Context, cmd Param) (int, error) {
+	args := cmd.Args()[1:]
+	if len(args) <= 0 {
+		for _, name := range completion.SpecNames() {
+			printSpec(cmd.Out(), name, completion.GetSpec(name))
+		}
+		return 0, nil
+	}
+	if args[0] == "-r" {
+		for _, name := range args[1:] {
+			completion.SetSpec(name, nil)
+		}
+		return 0, nil
+	}
+	if args[0] == "-i" {
+		for _, path := range args[1:] {
+			if err := importScript(path); err != nil {
+				return 1, fmt.Errorf("complete: %s", err.Error())
+			}
+		}
+		return 0, nil
+	}
+	name := args[0]
+	args = args[1:]
+	spec := completion.GetSpec(name)
+	if spec == nil {
+		if len(args) <= 0 {
+			return 1, fmt.Errorf("complete: %s: no specification", name)
+		}
+		spec = &completion.Spec{}
+		completion.SetSpec(name, spec)
+	}
+	path := name
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		spec = spec.Subcommand(args[0])
+		path += " " + args[0]
+		args = args[1:]
+	}
+	if len(args) <= 0 {
+		printSpec(cmd.Out(), path, spec)
+		return 0, nil
+	}
+
+	// -d describes the last -s or -f, or the command without them.
+	description := &spec.Description
+	var lastFlag *completion.Flag
+	for len(args) > 0 {
+		option := args[0]
+		if len(args) < 2 {
+			return 1, fmt.Errorf("complete: %s: requires a parameter", option)
+		}
+		param := args[1]
+		args = args[2:]
+		switch option {
+		case "-s":
+			description = &spec.Subcommand(param).Description
+			lastFlag = nil
+		case "-f":
+			lastFlag = nil
+			for _, f := range spec.Flags {
+				if f.Name == param {
+					lastFlag = f
+				}
+			}
+			if lastFlag == nil {
+				lastFlag = &completion.Flag{Name: param}
+				spec.Flags = append(spec.Flags, lastFlag)
+			}
+			description = &lastFlag.Description
+		case "-v":
+			if lastFlag == nil {
+				return 1, errors.New("complete: -v: requires -f before")
+			}
+			source, err := completion.ParseSource(param)
+			if err != nil {
+				return 1, fmt.Errorf("complete: %s", err.Error())
+			}
+			lastFlag.Value = source
+		case "-a":
+			source, err := completion.ParseSource(param)
+			if err != nil {
+				return 1, fmt.Errorf("complete: %s", err.Error())
+			}
+			spec.Args = append(spec.Args, source)
+		case "-d":
+			*description = param
+		default:
+			return 1, fmt.Errorf("complete: %s: unknown option", option)
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,341 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// cmdExtVersion is the value compared by `cmdextversion N`.
+const cmdExtVersion = 2
+
+type condToken struct {
+	text   string
+	quoted bool
+	arg    int // the index of the argument which the token is from.
+}
+
+type condParser struct {
+	tokens     []condToken
+	pos        int
+	depth      int
+	ignoreCase bool
+	// dryRun is true not to set the variables by `=~`.
+	dryRun bool
+}
+
+func (p *condParser) peek() (condToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return condToken{}, false
+}
+
+func (p *condParser) isKeyword(keyword string) bool {
+	tk, ok := p.peek()
+	return ok && !tk.quoted && strings.EqualFold(tk.text, keyword)
+}
+
+func (p *condParser) insert(at int, tk condToken) {
+	p.tokens = append(p.tokens, condToken{})
+	copy(p.tokens[at+1:], p.tokens[at:])
+	p.tokens[at] = tk
+}
+
+// splitOpenParen splits `(` at the top of the current token: `(A` -> `(` `A`
+func (p *condParser) splitOpenParen() {
+	tk, ok := p.peek()
+	if !ok || tk.quoted || len(tk.text) <= 1 || tk.text[0] != '(' {
+		return
+	}
+	p.tokens[p.pos].text = tk.text[1:]
+	p.insert(p.pos, condToken{text: "(", arg: tk.arg})
+}
+
+// operand reads one operand and splits the unbalanced `)` at the tail: `A)` -> `A` `)`
+func (p *condParser) operand() (string, error) {
+	tk, ok := p.peek()
+	if !ok {
+		return "", errors.New("if: too few arguments")
+	}
+	p.pos++
+	if tk.quoted || p.depth <= 0 {
+		return tk.text, nil
+	}
+	text := tk.text
+	extra := strings.Count(text, ")") - strings.Count(text, "(")
+	for ; extra > 0 && strings.HasSuffix(text, ")"); extra-- {
+		text = text[:len(text)-1]
+		p.insert(p.pos, condToken{text: ")", arg: tk.arg})
+	}
+	return text, nil
+}
+
+// expr := term { "or" term }
+func (p *condParser) expr() (bool, error) {
+	status, err := p.term()
+	if err != nil {
+		return false, err
+	}
+	for p.isKeyword("or") {
+		p.pos++
+		right, err := p.skipIf(status, p.term)
+		if err != nil {
+			return false, err
+		}
+		status = status || right
+	}
+	return status, nil
+}
+
+// term := factor { "and" factor }
+func (p *condParser) term() (bool, error) {
+	status, err := p.factor()
+	if err != nil {
+		return false, err
+	}
+	for p.isKeyword("and") {
+		p.pos++
+		right, err := p.skipIf(!status, p.factor)
+		if err != nil {
+			return false, err
+		}
+		status = status && right
+	}
+	return status, nil
+}
+
+// skipIf parses the right side of `and`/`or` with parse. When the left side
+// has already decided the result, it is only parsed in the dry-run mode
+// so that `=~` on it does not set the variables.
+func (p *condParser) skipIf(decided bool, parse func() (bool, error)) (bool, error) {
+	if !decided || p.dryRun {
+		return parse()
+	}
+	p.dryRun = true
+	defer func() { p.dryRun = false }()
+	return parse()
+}
+
+// factor := [ "/i" ] ( "not" factor | "(" expr ")" | primary )
+func (p *condParser) factor() (bool, error) {
+	for p.isKeyword("/i") {
+		p.ignoreCase = true
+		p.pos++
+	}
+	if p.isKeyword("not") {
+		p.pos++
+		status, err := p.factor()
+		return !status, err
+	}
+	p.splitOpenParen()
+	if p.isKeyword("(") {
+		p.pos++
+		p.depth++
+		status, err := p.expr()
+		if err != nil {
+			return false, err
+		}
+		if !p.isKeyword(")") {
+			return false, errors.New("if: missing ')'")
+		}
+		p.pos++
+		p.depth--
+		return status, nil
+	}
+	return p.primary()
+}
+
+func compareNumberOrString(left, right string, ignoreCase bool) int {
+	if l, err := strconv.ParseInt(left, 0, 64); err == nil {
+		if r, err := strconv.ParseInt(right, 0, 64); err == nil {
+			if l < r {
+				return -1
+			} else if l > r {
+				return 1
+			}
+			return 0
+		}
+	}
+	if ignoreCase {
+		left = strings.ToLower(left)
+		right = strings.ToLower(right)
+	}
+	return strings.Compare(left, right)
+}
+
+var compareOperators = map[string]func(int) bool{
+	"equ": func(c int) bool { return c == 0 },
+	"neq": func(c int) bool { return c != 0 },
+	"lss": func(c int) bool { return c < 0 },
+	"leq": func(c int) bool { return c <= 0 },
+	"gtr": func(c int) bool { return c > 0 },
+	"geq": func(c int) bool { return c >= 0 },
+}
+
+func newerThan(left, right string) bool {
+	stat1, err := os.Stat(left)
+	if err != nil {
+		return false
+	}
+	stat2, err := os.Stat(right)
+	if err != nil {
+		return true
+	}
+	return stat1.ModTime().After(stat2.ModTime())
+}
+
+// setMatches sets the groups of the regular expression to the environment
+// variables: MATCH_0 is the whole, MATCH_1... are groups and (?P<NAME>...) is NAME.
+func setMatches(rx *regexp.Regexp, m []string) {
+	names := rx.SubexpNames()
+	for i, value := range m {
+		os.Setenv(fmt.Sprintf("MATCH_%d", i), value)
+		if names[i] != "" {
+			os.Setenv(names[i], value)
+		}
+	}
+}
+
+// primary := unary-operator ARG | ARG binary-operator ARG
+func (p *condParser) primary() (bool, error) {
+	ignoreCase := p.ignoreCase
+	p.ignoreCase = false
+	tk, ok := p.peek()
+	if !ok {
+		return false, errors.New("if: too few arguments")
+	}
+	if !tk.quoted {
+		switch strings.ToLower(tk.text) {
+		case "exist":
+			p.pos++
+			path, err := p.operand()
+			if err != nil {
+				return false, err
+			}
+			_, err = os.Stat(path)
+			return err == nil, nil
+		case "errorlevel":
+			p.pos++
+			value, err := p.operand()
+			if err != nil {
+				return false, err
+			}
+			num, err := strconv.Atoi(value)
+			return err == nil && shell.LastErrorLevel >= num, nil
+		case "defined":
+			p.pos++
+			name, err := p.operand()
+			if err != nil {
+				return false, err
+			}
+			_, ok := os.LookupEnv(name)
+			return ok, nil
+		case "cmdextversion":
+			p.pos++
+			value, err := p.operand()
+			if err != nil {
+				return false, err
+			}
+			num, err := strconv.Atoi(value)
+			return err == nil && num <= cmdExtVersion, nil
+		case "-d", "-f", "-s":
+			p.pos++
+			path, err := p.operand()
+			if err != nil {
+				return false, err
+			}
+			stat, err := os.Stat(path)
+			if err != nil {
+				return false, nil
+			}
+			switch tk.text {
+			case "-d":
+				return stat.IsDir(), nil
+			case "-f":
+				return stat.Mode().IsRegular(), nil
+			default:
+				return stat.Size() > 0, nil
+			}
+		}
+	}
+	if p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].quoted {
+		return false, fmt.Errorf("if: %s: unknown condition", tk.text)
+	}
+	op := strings.ToLower(p.tokens[p.pos+1].text)
+	compare, isCompare := compareOperators[op]
+	if op != "==" && op != "-nt" && op != "=~" && !isCompare {
+		return false, fmt.Errorf("if: %s: unknown operator", p.tokens[p.pos+1].text)
+	}
+	p.pos += 2
+	left := tk.text
+	right, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "==":
+		if ignoreCase {
+			return strings.EqualFold(left, right), nil
+		}
+		return left == right, nil
+	case "-nt":
+		return newerThan(left, right), nil
+	case "=~":
+		if ignoreCase {
+			right = "(?i)" + right
+		}
+		rx, err := regexp.Compile(right)
+		if err != nil {
+			return false, err
+		}
+		m := rx.FindStringSubmatch(left)
+		if m == nil {
+			return false, nil
+		}
+		if !p.dryRun {
+			setMatches(rx, m)
+		}
+		return true, nil
+	}
+	return compare(compareNumberOrString(left, right, ignoreCase)), nil
+}
+
+// evalCondition evaluates the condition at the top of args
+// for `if`, `while` and `until`.
+// It returns the result and the number of arguments used by the condition.
+func evalCondition(args, rawargs []string) (bool, int, error) {
+	return newCondParser(args, rawargs).eval(len(args))
+}
+
+func newCondParser(args, rawargs []string) *condParser {
+	p := &condParser{tokens: make([]condToken, len(args))}
+	for i, arg := range args {
+		quoted := i < len(rawargs) && len(rawargs[i]) > 0 && (rawargs[i][0] == '"' || rawargs[i][0] == '\'')
+		p.tokens[i] = condToken{text: arg, quoted: quoted, arg: i}
+	}
+	return p
+}
+
+// eval evaluates the tokens made from nargs arguments.
+func (p *condParser) eval(nargs int) (bool, int, error) {
+	if len(p.tokens) <= 0 || p.isKeyword("then") {
+		return false, 0, errors.New("if: no condition")
+	}
+	status, err := p.expr()
+	if err != nil {
+		return false, 0, err
+	}
+	if tk, ok := p.peek(); ok {
+		if tk.text == ")" && !tk.quoted {
+			return false, 0, errors.New("if: unexpected ')'")
+		}
+		return status, tk.arg, nil
+	}
+	return status, nargs, nil
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zetamatta/nyagos/shell"
+)
+
+func TestEvalCondition(t *testing.T) {
+	os.Setenv("NYAGOS_TEST_DEFINED", "1")
+	defer os.Unsetenv("NYAGOS_TEST_DEFINED")
+	defer os.Unsetenv("MATCH_0")
+	defer os.Unsetenv("MATCH_1")
+	defer os.Unsetenv("MATCH_2")
+	defer os.Unsetenv("NUM")
+	tests := []struct {
+		text   string
+		expect bool
+		used   int
+	}{
+		{"a == a", true, 3},
+		{"/i A == a", true, 4},
+		{"not a == a", false, 4},
+		{"10 LSS 9", false, 3},
+		{"abc lss abd", true, 3},
+		{"2 GEQ 2 then", true, 3},
+		{"3 neq 4 echo x", true, 3},
+		{"defined NYAGOS_TEST_DEFINED", true, 2},
+		{"defined NYAGOS_TEST_UNDEFINED", false, 2},
+		{"cmdextversion 2", true, 2},
+		{"a == b or 1 EQU 1", true, 7},
+		{"a == a and 1 EQU 2", false, 7},
+		{"( a == b or b == b ) and not ( 1 GTR 2 )", true, 16},
+		{"(a == b or b == b) and c == c", true, 11},
+		{"abc123 =~ ^([a-z]+)(?P<NUM>[0-9]+)$", true, 3},
+	}
+	for _, test := range tests {
+		args := strings.Fields(test.text)
+		status, used, err := evalCondition(args, args)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err.Error())
+		}
+		if status != test.expect || used != test.used {
+			t.Fatalf("%s: (%v,%d) != (%v,%d)", test.text, status, used, test.expect, test.used)
+		}
+	}
+	if os.Getenv("MATCH_1") != "abc" || os.Getenv("NUM") != "123" {
+		t.Fatalf("captures are not set: %s %s", os.Getenv("MATCH_1"), os.Getenv("NUM"))
+	}
+	for _, text := range []string{
+		"a == a or xyz =~ ^(x)",
+		"a == b and xyz =~ ^(x)",
+		"not ( a == b ) or ( b == b and xyz =~ ^(x) )",
+	} {
+		os.Unsetenv("MATCH_1")
+		args := strings.Fields(text)
+		if _, _, err := evalCondition(args, args); err != nil {
+			t.Fatalf("%s: %s", text, err.Error())
+		}
+		if value, ok := os.LookupEnv("MATCH_1"); ok {
+			t.Fatalf("%s: MATCH_1=%s is set by the skipped side", text, value)
+		}
+	}
+	for _, text := range []string{"( a == a", "a", "a ~~ b", "a =~ ("} {
+		args := strings.Fields(text)
+		if _, _, err := evalCondition(args, args); err == nil {
+			t.Fatalf("%s: no error", text)
+		}
+	}
+}
+
+func TestOpenBlocks(t *testing.T) {
+	tests := []struct {
+		lines  []string
+		expect int
+	}{
+		{[]string{"echo a"}, 0},
+		{[]string{"if a == a"}, 1},
+		{[]string{"if a == a echo yes"}, 0},
+		{[]string{"if a == a then echo yes"}, 1},
+		{[]string{"if \"a\" =~ \"(a)\""}, 1},
+		{[]string{"foreach x a b", "  echo %x%", "end"}, 0},
+		{[]string{"while not exist x", "  if -d x", "  end"}, 1},
+		{[]string{"for i in 1..3 ; echo %i% ; end"}, 0},
+	}
+	for _, test := range tests {
+		if n := OpenBlocks(test.lines); n != test.expect {
+			t.Fatalf("%q: %d != %d", test.lines, n, test.expect)
+		}
+	}
+}
+
+func TestReadBlock(t *testing.T) {
+	tests := []struct {
+		source string
+		expect []string
+	}{
+		{"echo a\nend\n", []string{"echo a"}},
+		{"if a == a echo x\necho y\nend\n", []string{"if a == a echo x", "echo y"}},
+		{"if a == a\necho x\nend\nend\n", []string{"if a == a", "echo x", "end"}},
+		{"foreach x a b\necho %x%\nend\nend\n", []string{"foreach x a b", "echo %x%", "end"}},
+	}
+	for _, test := range tests {
+		stream := shell.NewCmdStreamFile(strings.NewReader(test.source + "rest\n"))
+		ctx := context.WithValue(context.Background(), shell.StreamID, stream)
+		cmd := shell.New().Command()
+		var lines []string
+		err := readBlock(ctx, cmd, "test>", func(line string, _ []string, _ int) {
+			lines = append(lines, line)
+		})
+		if err != nil {
+			t.Fatalf("%q: %s", test.source, err)
+		}
+		if strings.Join(lines, "\n") != strings.Join(test.expect, "\n") {
+			t.Fatalf("%q: %q != %q", test.source, lines, test.expect)
+		}
+		if _, line, _ := cmd.ReadCommand(ctx, stream); line != "rest" {
+			t.Fatalf("%q: %q is read after the block", test.source, line)
+		}
+	}
+}
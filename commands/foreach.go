@@ -12,40 +12,127 @@ import (
 )
 
 var startList = map[string]bool{
-	"foreach": true,
-	"if":      true,
+	"foreach":  true,
+	"function": true,
+	"if":       true,
+	"until":    true,
+	"while":    true,
 }
 
-func cmdForeach(ctx context.Context, cmd Param) (int, error) {
-	stream, ok := ctx.Value(shell.StreamID).(shell.Stream)
+// isBlockStart returns true when the command starts a block which ends with `end`.
+func isBlockStart(args []string) bool {
+	if len(args) <= 0 {
+		return false
+	}
+	name := strings.ToLower(args[0])
+	if name == "for" {
+		return isForLoop(args)
+	}
+	_, ok := startList[name]
+	return ok
+}
 
-	if !ok {
-		return 1, errors.New("Not found stream")
+// isBlockStartLine is isBlockStart for the lines not executed yet.
+// The inline `if COND COMMAND` is not the block.
+func isBlockStartLine(args []string) bool {
+	if !isBlockStart(args) {
+		return false
+	}
+	if !strings.EqualFold(args[0], "if") {
+		return true
+	}
+	p := newCondParser(args[1:], args[1:])
+	p.dryRun = true
+	_, n, err := p.eval(len(args) - 1)
+	if err != nil {
+		return false
 	}
+	rest := args[1+n:]
+	return len(rest) <= 0 || strings.EqualFold(rest[0], "then")
+}
 
-	bufstream := shell.BufStream{}
+// OpenBlocks returns the number of the blocks which are started in lines
+// and not closed with `end` yet. The line-editor uses it to decide whether
+// Enter should insert a newline.
+func OpenBlocks(lines []string) int {
+	nest := 0
+	for _, line := range lines {
+		for _, statement := range shell.SplitToStatement(line) {
+			args := texts.SplitLikeShellString(statement)
+			if len(args) <= 0 {
+				continue
+			}
+			if isBlockStartLine(args) {
+				nest++
+			} else if name := strings.ToLower(args[0]); (name == "end" || name == "endif") && nest > 0 {
+				nest--
+			}
+		}
+	}
+	return nest
+}
+
+// readBlock reads lines until the `end` corresponding to the current command
+// and calls f for each line. nest is 1 for lines not in the inner blocks.
+func readBlock(ctx context.Context, cmd Param, prompt string, f func(line string, args []string, nest int)) error {
+	stream, ok := ctx.Value(shell.StreamID).(shell.Stream)
+	if !ok {
+		return errors.New("Not found stream")
+	}
 	savePrompt := os.Getenv("PROMPT")
-	os.Setenv("PROMPT", "foreach>")
+	os.Setenv("PROMPT", prompt)
 	defer os.Setenv("PROMPT", savePrompt)
 	nest := 1
 	for {
 		_, line, err := cmd.ReadCommand(ctx, stream)
 		if err != nil {
 			if err != io.EOF {
-				return -1, err
+				return err
 			}
-			break
+			return nil
 		}
-		name := strings.ToLower(texts.FirstWord(line))
-		if _, ok := startList[name]; ok {
+		args := texts.SplitLikeShellString(line)
+		if len(args) <= 0 {
+			continue
+		}
+		if isBlockStartLine(args) {
 			nest++
-		} else if name == "end" {
+		} else if name := strings.ToLower(args[0]); name == "end" || name == "endif" {
 			nest--
 			if nest == 0 {
-				break
+				return nil
 			}
 		}
+		f(line, args, nest)
+	}
+}
+
+// runBlock executes the body of the loop once.
+// It returns true when the loop should be stopped by `break`, `return` or errors.
+func runBlock(ctx context.Context, cmd Param, body *shell.BufStream) (int, bool, error) {
+	if ctx.Err() != nil {
+		// interrupted by Ctrl-C
+		return 0, true, nil
+	}
+	body.SetPos(0)
+	rc, err := cmd.Loop(ctx, body)
+	switch err {
+	case nil, io.EOF, shell.ErrContinue:
+		return rc, false, nil
+	case shell.ErrBreak:
+		return 0, true, nil
+	default:
+		return rc, true, err
+	}
+}
+
+func cmdForeach(ctx context.Context, cmd Param) (int, error) {
+	bufstream := shell.BufStream{}
+	err := readBlock(ctx, cmd, "foreach>", func(line string, _ []string, _ int) {
 		bufstream.Add(line)
+	})
+	if err != nil {
+		return -1, err
 	}
 	if len(cmd.Args()) < 2 {
 		return 0, nil
@@ -53,11 +140,12 @@ func cmdForeach(ctx context.Context, cmd Param) (int, error) {
 
 	name := cmd.Arg(1)
 	save := os.Getenv(name)
+	defer os.Setenv(name, save)
 	for _, value := range cmd.Args()[2:] {
 		os.Setenv(name, value)
-		cmd.Loop(ctx, &bufstream)
-		bufstream.SetPos(0)
+		if rc, stop, err := runBlock(ctx, cmd, &bufstream); stop {
+			return rc, err
+		}
 	}
-	os.Setenv(name, save)
 	return 0, nil
 }
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zetamatta/nyagos/alias"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+func cmdFunction(ctx context.Context, cmd Param) (int, error) {
+	body := make([]string, 0)
+	err := readBlock(ctx, cmd, "function>", func(line string, _ []string, _ int) {
+		body = append(body, line)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if len(cmd.Args()) < 2 {
+		return 1, errors.New("function: too few arguments")
+	}
+	name := cmd.Arg(1)
+	alias.Table[strings.ToLower(name)] = alias.NewShellFunc(name, body)
+	return 0, nil
+}
+
+func cmdLocal(ctx context.Context, cmd Param) (int, error) {
+	for _, arg := range cmd.Args()[1:] {
+		name := arg
+		eqlPos := strings.IndexRune(arg, '=')
+		if eqlPos >= 0 {
+			name = arg[:eqlPos]
+		}
+		if err := alias.Local(ctx, name); err != nil {
+			return 1, err
+		}
+		if eqlPos >= 0 {
+			os.Setenv(name, arg[eqlPos+1:])
+		}
+	}
+	return 0, nil
+}
+
+func cmdReturn(ctx context.Context, cmd Param) (int, error) {
+	if len(cmd.Args()) < 2 {
+		return shell.LastErrorLevel, shell.ErrReturn
+	}
+	errorlevel, err := strconv.Atoi(cmd.Arg(1))
+	if err != nil {
+		return 1, err
+	}
+	return errorlevel, shell.ErrReturn
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/zetamatta/nyagos/alias"
+)
+
+func TestFunction(t *testing.T) {
+	defer os.Unsetenv("FUNC_TEST")
+	defer os.Unsetenv("FUNC_LOCAL")
+	defer os.Unsetenv("I")
+	defer func() {
+		for _, name := range []string{"greet", "all", "f", "g", "outer", "inner"} {
+			delete(alias.Table, name)
+		}
+	}()
+
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"function greet\necho hello $1\nend\ngreet world\ngreet nyagos\n", "hello world\nhello nyagos\n"},
+		{"function all\necho [$*]\nend\nall a b c\n", "[a b c]\n"},
+		{"function f\nreturn 3\necho never\nend\nf\necho %ERRORLEVEL%\n", "3\n"},
+		{"function f\nif $1 == x return 1\nreturn 0\nend\nf x\necho %ERRORLEVEL%\nf y\necho %ERRORLEVEL%\n", "1\n0\n"},
+		{"set FUNC_TEST=global\nfunction f\nlocal FUNC_TEST=local\necho %FUNC_TEST%\nend\nf\necho %FUNC_TEST%\n",
+			"local\nglobal\n"},
+		{"set FUNC_TEST=global\nfunction f\nlocal FUNC_TEST\nset FUNC_TEST=changed\nend\nf\necho %FUNC_TEST%\n",
+			"global\n"},
+		{"set FUNC_TEST=global\nfunction f\nset FUNC_TEST=changed\nend\nf\necho %FUNC_TEST%\n",
+			"changed\n"},
+		{"function f\nlocal FUNC_LOCAL=x\nreturn 2\nend\nf\necho [%FUNC_LOCAL%] %ERRORLEVEL%\n",
+			"[%FUNC_LOCAL%] 2\n"},
+		{"function outer\nlocal FUNC_TEST=outer\ninner\necho %FUNC_TEST%\nend\nfunction inner\nlocal FUNC_TEST=inner\necho %FUNC_TEST%\nend\nset FUNC_TEST=global\nouter\necho %FUNC_TEST%\n",
+			"inner\nouter\nglobal\n"},
+		{"function f\nfor I in 1..3\nif %I% == 2 return %I%\nend\necho never\nend\nf\necho %ERRORLEVEL%\n", "2\n"},
+		{"local FUNC_LOCAL=x\necho [%FUNC_LOCAL%]\n", "[%FUNC_LOCAL%]\n"},
+		{"function g\nreturn 4\nend\nfunction f\ng\nend\nf\necho %ERRORLEVEL%\n", "4\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+}
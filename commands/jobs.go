@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zetamatta/nyagos/shell"
+)
+
+func cmdJobs(ctx context.Context, cmd Param) (int, error) {
+	for _, job := range shell.Jobs() {
+		fmt.Fprintf(cmd.Out(), "%s %v\n", job.String(), job.Pids())
+	}
+	return 0, nil
+}
+
+func findJobs(args []string) ([]*shell.Job, error) {
+	if len(args) <= 0 {
+		return shell.Jobs(), nil
+	}
+	jobs := make([]*shell.Job, 0, len(args))
+	for _, arg := range args {
+		job, err := shell.FindJob(arg)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func cmdWait(ctx context.Context, cmd Param) (int, error) {
+	jobs, err := findJobs(cmd.Args()[1:])
+	if err != nil {
+		return 127, err
+	}
+	errorlevel := 0
+	for _, job := range jobs {
+		errorlevel, err = job.Wait(ctx)
+		if err != nil {
+			return errorlevel, err
+		}
+	}
+	return errorlevel, nil
+}
+
+func cmdFg(ctx context.Context, cmd Param) (int, error) {
+	args := cmd.Args()
+	if len(args) > 2 {
+		return 1, errors.New("Usage: fg [%N]")
+	}
+	jobs, err := findJobs(args[1:])
+	if err != nil {
+		return 1, err
+	}
+	if len(jobs) <= 0 {
+		return 1, errors.New("fg: no current job")
+	}
+	job := jobs[len(jobs)-1]
+	fmt.Fprintln(cmd.Out(), job.Cmdline)
+	return job.Wait(ctx)
+}
+
+func cmdBg(ctx context.Context, cmd Param) (int, error) {
+	jobs, err := findJobs(cmd.Args()[1:])
+	if err != nil {
+		return 1, err
+	}
+	for _, job := range jobs {
+		// Jobs are never stopped, so they are already running in background.
+		if job.Done() {
+			return 1, fmt.Errorf("bg: [%d] job has terminated", job.ID)
+		}
+		fmt.Fprintf(cmd.Out(), "[%d] %s &\n", job.ID, job.Cmdline)
+	}
+	return 0, nil
+}
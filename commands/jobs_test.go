@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/zetamatta/nyagos/alias"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+func TestJobs(t *testing.T) {
+	defer os.Unsetenv("JOB_TEST")
+	defer delete(alias.Table, "spin")
+	// spin runs until killed and sets JOB_TEST at last.
+	const spin = "function spin\nwhile 1 == 1\nend\nset JOB_TEST=killed\nend\n"
+	const stopped = "while not defined JOB_TEST\nend\necho %JOB_TEST%\n"
+
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"echo foo &\nwait\n", "foo\n"},
+		{"set JOB_TEST=wait &\nwait %1\necho %JOB_TEST% %ERRORLEVEL%\n", "wait 0\n"},
+		{"set JOB_TEST=fg &\nfg %set\necho %JOB_TEST%\n", "set JOB_TEST=fg\nfg\n"},
+		{"wait %1\necho %ERRORLEVEL%\n", "127\n"},
+		{spin + "spin &\njobs\nkill %1\njobs\n" + stopped, "[1] Running    spin []\nkilled\n"},
+		{spin + "spin &\nbg %1\nkill %%\n" + stopped, "[1] spin &\nkilled\n"},
+	}
+	for _, test := range tests {
+		os.Unsetenv("JOB_TEST")
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+		if jobs := shell.Jobs(); len(jobs) > 0 {
+			t.Fatalf("%q: %v are left", test.script, jobs)
+		}
+	}
+}
@@ -5,12 +5,26 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/zetamatta/nyagos/shell"
 )
 
 func cmdKill(ctx context.Context, cmd Param) (int, error) {
 	args := cmd.Args()
 	if len(args) < 2 {
-		return 1, fmt.Errorf("Usage: %s PID", args[0])
+		return 1, fmt.Errorf("Usage: %s PID|%%N", args[0])
+	}
+
+	if strings.HasPrefix(args[1], "%") {
+		job, err := shell.FindJob(args[1])
+		if err != nil {
+			return 1, err
+		}
+		if err := job.Kill(); err != nil {
+			return 1, err
+		}
+		return 0, nil
 	}
 
 	pid, err := strconv.Atoi(cmd.Arg(1))
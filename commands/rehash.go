@@ -0,0 +1,12 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/zetamatta/nyagos/completion"
+)
+
+func cmdRehash(ctx context.Context, cmd Param) (int, error) {
+	completion.Rehash()
+	return 0, nil
+}
@@ -51,11 +51,21 @@ var BoolOptions = map[string]*optionT{
 		Usage:   "Clean up key buffer at prompt",
 		NoUsage: "Do not clean up key buffer at prompt",
 	},
+	"completion_cobra": {
+		V:       &completion.UseCobra,
+		Usage:   "Complete the arguments by the commands made with Cobra or clap themselves",
+		NoUsage: "Do not ask the commands made with Cobra or clap for the candidates",
+	},
 	"completion_hidden": {
 		V:       &completion.IncludeHidden,
 		Usage:   "Include hidden files on completion",
 		NoUsage: "Do not include hidden files on completion",
 	},
+	"completion_menu": {
+		V:       &completion.UseMenu,
+		Usage:   "Select the candidate in the menu with the second Tab",
+		NoUsage: "List the candidates again with the second Tab",
+	},
 	"completion_slash": {
 		V:       &completion.UseSlash,
 		Usage:   "use forward slash on completion",
@@ -66,16 +76,46 @@ var BoolOptions = map[string]*optionT{
 		Usage:   "Enable to expand wildcards",
 		NoUsage: "Disable to expand wildcards",
 	},
+	"highlight": {
+		V:       &readline.HighlightMode,
+		Usage:   "Colour the command-line while typing",
+		NoUsage: "Do not colour the command-line",
+	},
+	"multiline": {
+		V:       &readline.MultiLineMode,
+		Usage:   "Wrap the long line and edit multiple lines",
+		NoUsage: "Scroll the long line horizontally",
+	},
 	"noclobber": {
 		V:       &shell.NoClobber,
 		Usage:   "forbide to overwrite files on redirect",
 		NoUsage: "Do not forbide to overwrite files no redirect",
 	},
+	"pipefail": {
+		V:       &shell.PipeFail,
+		Usage:   "make the errorlevel of pipeline that of the last failed command",
+		NoUsage: "make the errorlevel of pipeline that of the last command",
+	},
 	"usesource": {
 		V:       &shell.UseSourceRunBatch,
 		Usage:   "allow batchfile to change environment variables of nyagos",
 		NoUsage: "forbide batchfile to change environment variables of nyagos",
 	},
+	"vi": {
+		V:       &readline.ViMode,
+		Usage:   "Edit the command-line with the keys of vi",
+		NoUsage: "Edit the command-line with the keys of Emacs",
+	},
+	"suggest": {
+		V:       &readline.SuggestMode,
+		Usage:   "Suggest the rest of the line from the history",
+		NoUsage: "Do not suggest the rest of the line",
+	},
+	"transient_prompt": {
+		V:       &readline.TransientPromptMode,
+		Usage:   "Replace the prompt of the line accepted with the short one",
+		NoUsage: "Keep the prompt of the line accepted",
+	},
 	"tilde_expansion": {
 		V:       &shell.TildeExpansion,
 		Usage:   "Enable Tilde Expansion",
@@ -88,6 +128,40 @@ var BoolOptions = map[string]*optionT{
 	},
 }
 
+type stringOptionT struct {
+	V      *string
+	Values func() []string
+	Usage  string
+}
+
+// StringOptions are the global options which take one of the values
+// (`set -o NAME=VALUE`).
+var StringOptions = map[string]*stringOptionT{
+	"completion_match": {
+		V: &completion.MatchMode,
+		Values: func() []string {
+			return texts.SortedKeys(completion.Matchers)
+		},
+		Usage: "How the word matches the candidates on completion",
+	},
+}
+
+// SetStringOption sets the value of the option after checking it.
+func SetStringOption(key, value string) error {
+	ptr, ok := StringOptions[key]
+	if !ok {
+		return fmt.Errorf("%s: no such option", key)
+	}
+	values := ptr.Values()
+	for _, v := range values {
+		if v == value {
+			*ptr.V = value
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %s: not one of %s", key, value, strings.Join(values, ","))
+}
+
 func dumpBoolOptions(out io.Writer) {
 	max := 0
 	for key := range BoolOptions {
@@ -95,6 +169,11 @@ func dumpBoolOptions(out io.Writer) {
 			max = L
 		}
 	}
+	for key, val := range StringOptions {
+		if L := len(key) + 1 + len(*val.V); L > max {
+			max = L
+		}
+	}
 	for _, key := range texts.SortedKeys(BoolOptions) {
 		val := BoolOptions[key]
 		if *val.V {
@@ -109,6 +188,11 @@ func dumpBoolOptions(out io.Writer) {
 			fmt.Fprintf(out, " (%s)\n", val.NoUsage)
 		}
 	}
+	for _, key := range texts.SortedKeys(StringOptions) {
+		val := StringOptions[key]
+		fmt.Fprintf(out, "-o %-*s (%s: %s)\n", max, key+"="+*val.V,
+			val.Usage, strings.Join(val.Values(), ","))
+	}
 }
 
 func cmdSet(ctx context.Context, cmd Param) (int, error) {
@@ -128,6 +212,10 @@ func cmdSet(ctx context.Context, cmd Param) (int, error) {
 			} else {
 				if ptr, ok := BoolOptions[args[0]]; ok {
 					*ptr.V = true
+				} else if eqlPos := strings.IndexByte(args[0], '='); eqlPos > 0 {
+					if err := SetStringOption(args[0][:eqlPos], args[0][eqlPos+1:]); err != nil {
+						fmt.Fprintf(cmd.Err(), "-o %s\n", err.Error())
+					}
 				} else {
 					fmt.Fprintf(cmd.Err(), "-o %s: no such option\n", args[0])
 				}
@@ -169,6 +257,9 @@ func cmdSet(ctx context.Context, cmd Param) (int, error) {
 				// set NAME=
 				os.Unsetenv(arg[:eqlPos])
 			}
+			if eqlPos >= 0 {
+				completion.EnvChanged(strings.TrimRight(arg[:eqlPos], "+^"))
+			}
 			break
 		}
 	}
@@ -8,8 +8,7 @@ import (
 	"strings"
 
 	"github.com/zetamatta/nyagos/alias"
-	"github.com/zetamatta/nyagos/dos"
-	"github.com/zetamatta/nyagos/shell"
+	"github.com/zetamatta/nyagos/completion"
 )
 
 const (
@@ -38,7 +37,11 @@ func cmdWhich(ctx context.Context, cmd Param) (int, error) {
 			continue
 		}
 		if a, ok := alias.Table[strings.ToLower(name)]; ok {
-			fmt.Fprintf(cmd.Out(), "%s: aliased to %s\n", name, a.String())
+			if _, ok := a.(*alias.ShellFunc); ok {
+				fmt.Fprintf(cmd.Out(), "%s: shell function\n", name)
+			} else {
+				fmt.Fprintf(cmd.Out(), "%s: aliased to %s\n", name, a.String())
+			}
 			if !all {
 				continue
 			}
@@ -61,7 +64,7 @@ func cmdWhich(ctx context.Context, cmd Param) (int, error) {
 			}
 
 		} else {
-			path := dos.LookPath(shell.LookCurdirOrder, name, "NYAGOSPATH")
+			path := completion.LookPath(name)
 			if path == "" {
 				return errnoWhichNotFound, fmt.Errorf("which %s: not found", name)
 			}
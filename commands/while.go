@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// sourceArgs returns the arguments of the command before they are expanded
+// so that the condition of the loop can be evaluated again on each turn.
+func sourceArgs(cmd Param) []string {
+	if source := cmd.SourceArgs(); len(source) > 0 {
+		return source
+	}
+	return cmd.RawArgs()
+}
+
+func doWhile(ctx context.Context, cmd Param, prompt string, expect bool) (int, error) {
+	body := shell.BufStream{}
+	err := readBlock(ctx, cmd, prompt, func(line string, _ []string, _ int) {
+		body.Add(line)
+	})
+	if err != nil {
+		return -1, err
+	}
+	cond := sourceArgs(cmd)[1:]
+	for {
+		rawargs, args, err := cmd.ExpandArgs(ctx, cond)
+		if err != nil {
+			return 1, err
+		}
+		status, _, err := evalCondition(args, rawargs)
+		if err != nil {
+			return 1, err
+		}
+		if status != expect {
+			return 0, nil
+		}
+		if rc, stop, err := runBlock(ctx, cmd, &body); stop {
+			return rc, err
+		}
+	}
+}
+
+func cmdWhile(ctx context.Context, cmd Param) (int, error) {
+	return doWhile(ctx, cmd, "while>", true)
+}
+
+func cmdUntil(ctx context.Context, cmd Param) (int, error) {
+	return doWhile(ctx, cmd, "until>", false)
+}
+
+// isForLoop returns true for `for VAR in ...` of nyagos,
+// not `for %VAR in (...) do ...` of CMD.EXE.
+func isForLoop(args []string) bool {
+	return len(args) >= 3 &&
+		strings.EqualFold(args[2], "in") &&
+		!strings.HasPrefix(args[1], "%") &&
+		!strings.HasPrefix(args[1], "/")
+}
+
+var rxRange = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)(?:\.\.(-?\d+))?$`)
+
+// expandRange expands `FROM..TO` and `FROM..TO..STEP` into numbers.
+func expandRange(values []string) ([]string, error) {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		m := rxRange.FindStringSubmatch(value)
+		if m == nil {
+			result = append(result, value)
+			continue
+		}
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		step := 1
+		if to < from {
+			step = -1
+		}
+		if m[3] != "" {
+			step, _ = strconv.Atoi(m[3])
+			if step == 0 || (to-from)*step < 0 {
+				return nil, fmt.Errorf("for: %s: invalid step", value)
+			}
+		}
+		for i := from; (step > 0 && i <= to) || (step < 0 && i >= to); i += step {
+			result = append(result, strconv.Itoa(i))
+		}
+	}
+	return result, nil
+}
+
+func cmdFor(ctx context.Context, cmd Param) (int, error) {
+	args := cmd.Args()
+	if !isForLoop(args) {
+		return 1, fmt.Errorf("usage: %s VAR in VALUE|FROM..TO[..STEP] ...", args[0])
+	}
+	body := shell.BufStream{}
+	err := readBlock(ctx, cmd, "for>", func(line string, _ []string, _ int) {
+		body.Add(line)
+	})
+	if err != nil {
+		return -1, err
+	}
+	values, err := expandRange(args[3:])
+	if err != nil {
+		return 1, err
+	}
+	name := args[1]
+	save := os.Getenv(name)
+	defer os.Setenv(name, save)
+	for _, value := range values {
+		os.Setenv(name, value)
+		if rc, stop, err := runBlock(ctx, cmd, &body); stop {
+			return rc, err
+		}
+	}
+	return 0, nil
+}
+
+func cmdBreak(ctx context.Context, cmd Param) (int, error) {
+	return 0, shell.ErrBreak
+}
+
+func cmdContinue(ctx context.Context, cmd Param) (int, error) {
+	return 0, shell.ErrContinue
+}
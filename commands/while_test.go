@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zetamatta/nyagos/alias"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+func TestExpandRange(t *testing.T) {
+	tests := map[string]string{
+		"1..5":     "1 2 3 4 5",
+		"3..1":     "3 2 1",
+		"0..10..5": "0 5 10",
+		"a 1..2 b": "a 1 2 b",
+		"-1..1":    "-1 0 1",
+	}
+	for source, expect := range tests {
+		result, err := expandRange(strings.Fields(source))
+		if err != nil {
+			t.Fatalf("%s: %s", source, err.Error())
+		}
+		if s := strings.Join(result, " "); s != expect {
+			t.Fatalf("%s: `%s` != `%s`", source, s, expect)
+		}
+	}
+	if _, err := expandRange([]string{"1..10..-1"}); err == nil {
+		t.Fatal("invalid step is not an error")
+	}
+}
+
+// runScript runs the lines of script with the built-in commands
+// and returns the standard output.
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+	defer shell.SetHook(shell.SetHook(func(ctx context.Context, cmd *shell.Cmd) (int, bool, error) {
+		return Exec(ctx, cmd)
+	}))
+	alias.Init()
+
+	out, err := ioutil.TempFile("", "nyagos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	sh := shell.New()
+	sh.Stdout = out
+	_, err = sh.Loop(context.Background(), shell.NewCmdStreamFile(strings.NewReader(script)))
+	if err != nil && err != io.EOF {
+		t.Fatalf("%q: %s", script, err)
+	}
+	output, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(string(output), "\r\n", "\n", -1)
+}
+
+func TestLoops(t *testing.T) {
+	defer os.Unsetenv("LOOP_TEST")
+	defer os.Unsetenv("I")
+	defer os.Unsetenv("J")
+
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"set LOOP_TEST=-\nwhile not \"%LOOP_TEST%\" == \"-xxx\"\nset LOOP_TEST=%LOOP_TEST%x\necho %LOOP_TEST%\nend\n",
+			"-x\n-xx\n-xxx\n"},
+		{"set LOOP_TEST=-\nuntil \"%LOOP_TEST%\" == \"-xx\"\nset LOOP_TEST=%LOOP_TEST%x\nend\necho %LOOP_TEST%\n",
+			"-xx\n"},
+		{"for I in 1..3 a\necho %I%\nend\n", "1\n2\n3\na\n"},
+		{"for I in 1..5\nif %I% == 2 continue\nif %I% == 4 break\necho %I%\nend\necho done\n",
+			"1\n3\ndone\n"},
+		{"while 1 == 1\necho once\nbreak\necho never\nend\n", "once\n"},
+		{"set LOOP_TEST=-\nwhile not \"%LOOP_TEST%\" == \"-xx\"\nset LOOP_TEST=%LOOP_TEST%x\nif \"%LOOP_TEST%\" == \"-x\" continue\necho %LOOP_TEST%\nend\n",
+			"-xx\n"},
+		{"for I in 1 2\nfor J in a b c\nif %J% == b break\necho %I%%J%\nend\nend\n", "1a\n2a\n"},
+		{"for I in 1..3\nif %I% == 2 then\ncontinue\nend\necho %I%\nend\n", "1\n3\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+	if shell.LastErrorLevel != 0 {
+		t.Errorf("errorlevel %d after break", shell.LastErrorLevel)
+	}
+}
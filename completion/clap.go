@@ -0,0 +1,60 @@
+package completion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// clapSignature is the name of the environment variable that only the
+// executables supporting the dynamic completion of clap (clap_complete's
+// CompleteEnv) contain.
+var clapSignature = []byte("_CLAP_COMPLETE_INDEX")
+
+// parseClap reads the candidates printed for fish: the lines of
+// "CANDIDATE<TAB>DESCRIPTION".
+func parseClap(r io.Reader) *cobraResult {
+	result := &cobraResult{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		value, description := line, ""
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			value, description = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		result.values = append(result.values, value)
+		result.descriptions = append(result.descriptions, description)
+	}
+	return result
+}
+
+// callClap runs `COMPLETE=fish EXECUTABLE -- NAME ARGS... WORD` as the script
+// of fish registered by clap does, or returns the cached result.
+func callClap(ctx context.Context, path, name string, args []string, word string) (*cobraResult, error) {
+	key := strings.Join(args, "\t") + "\t" + word
+	if r, ok := cobraCache[path]; ok && r.key == key && time.Since(r.time) < CobraCacheTime {
+		return r, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, CobraTimeout)
+	defer cancel()
+	params := append(append([]string{"--", name}, args...), word)
+	xcmd := exec.CommandContext(ctx, path, params...)
+	xcmd.Env = append(os.Environ(), "COMPLETE=fish")
+	output, err := xcmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	r := parseClap(bytes.NewReader(output))
+	r.key = key
+	r.time = time.Now()
+	cobraCache[path] = r
+	return r, nil
+}
@@ -0,0 +1,273 @@
+package completion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zetamatta/nyagos/dos"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// UseCobra is the switch to complete the arguments of the commands made
+// with Cobra (kubectl, gh, helm, hugo...) by their hidden subcommand `__complete`
+// and the commands made with clap by its dynamic completion (see clap.go).
+var UseCobra = true
+
+// CobraCacheTime is how long the candidates for the same arguments are reused.
+var CobraCacheTime = 10 * time.Second
+
+// CobraTimeout is how long `__complete` can run.
+var CobraTimeout = 5 * time.Second
+
+// signatureScanLimit is the bytes of the executable to find the signature in.
+var signatureScanLimit int64 = 256 << 20
+
+// The directives which `__complete` prints at the last line as `:N`
+const (
+	cobraError         = 1
+	cobraNoSpace       = 2
+	cobraNoFileComp    = 4
+	cobraFilterFileExt = 8
+	cobraFilterDirs    = 16
+)
+
+// The protocols to ask the executables for the candidates
+const (
+	protocolNone  = iota
+	protocolCobra // `EXECUTABLE __complete ARGS...`
+	protocolClap  // `COMPLETE=fish EXECUTABLE -- EXECUTABLE ARGS...`
+)
+
+// cobraSignature is the name of the hidden subcommand that only
+// the executables made with Cobra contain.
+var cobraSignature = []byte("__completeNoDesc")
+
+// protocolSignatures are the signatures of the protocols in the executables.
+var protocolSignatures = [][]byte{
+	protocolCobra: cobraSignature,
+	protocolClap:  clapSignature,
+}
+
+type protocolDetection struct {
+	modTime  time.Time
+	protocol int
+}
+
+type cobraResult struct {
+	key          string // the arguments and the word
+	values       []string
+	descriptions []string
+	directive    int
+	time         time.Time
+}
+
+var (
+	protocolDetected = map[string]protocolDetection{}
+	// cobraCache has the last result for each executable.
+	cobraCache = map[string]*cobraResult{}
+)
+
+// findSignature returns the protocol whose signature is found in the first
+// signatureScanLimit bytes of the file. It reads the file by 64KiB.
+func findSignature(path string) int {
+	fd, err := os.Open(path)
+	if err != nil {
+		return protocolNone
+	}
+	defer fd.Close()
+	keep := 0
+	for _, signature := range protocolSignatures {
+		if len(signature)-1 > keep {
+			keep = len(signature) - 1
+		}
+	}
+	buffer := make([]byte, keep+1<<16)
+	filled := 0 // the tail of the last chunk, which may be a part of the signature
+	for total := int64(0); total < signatureScanLimit; {
+		n, err := fd.Read(buffer[filled:])
+		total += int64(n)
+		data := buffer[:filled+n]
+		for protocol, signature := range protocolSignatures {
+			if len(signature) > 0 && bytes.Contains(data, signature) {
+				return protocol
+			}
+		}
+		if err != nil {
+			return protocolNone
+		}
+		if len(data) > keep {
+			data = data[len(data)-keep:]
+		}
+		filled = copy(buffer, data)
+	}
+	return protocolNone
+}
+
+// protocolOf returns the protocol which the executable supports.
+// The result is cached until the executable is updated.
+func protocolOf(path string) int {
+	if !strings.EqualFold(filepath.Ext(path), ".exe") {
+		return protocolNone
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return protocolNone
+	}
+	if d, ok := protocolDetected[path]; ok && d.modTime.Equal(stat.ModTime()) {
+		return d.protocol
+	}
+	protocol := findSignature(path)
+	protocolDetected[path] = protocolDetection{modTime: stat.ModTime(), protocol: protocol}
+	return protocol
+}
+
+// parseCobra reads the output of `__complete`: the lines of
+// "CANDIDATE<TAB>DESCRIPTION" and ":DIRECTIVE" at the end.
+func parseCobra(r io.Reader) *cobraResult {
+	result := &cobraResult{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(line, ":") {
+			if n, err := strconv.Atoi(line[1:]); err == nil {
+				result.directive = n
+				continue
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "_activeHelp_ ") {
+			continue
+		}
+		value, description := line, ""
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			value, description = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		result.values = append(result.values, value)
+		result.descriptions = append(result.descriptions, description)
+	}
+	return result
+}
+
+// callCobra runs `EXECUTABLE __complete ARGS... WORD` or returns the cached result.
+func callCobra(ctx context.Context, path string, args []string, word string) (*cobraResult, error) {
+	key := strings.Join(args, "\t") + "\t" + word
+	if r, ok := cobraCache[path]; ok && r.key == key && time.Since(r.time) < CobraCacheTime {
+		return r, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, CobraTimeout)
+	defer cancel()
+	params := append(append([]string{"__complete"}, args...), word)
+	output, err := exec.CommandContext(ctx, path, params...).Output()
+	if err != nil {
+		return nil, err
+	}
+	r := parseCobra(bytes.NewReader(output))
+	r.key = key
+	r.time = time.Now()
+	cobraCache[path] = r
+	return r, nil
+}
+
+// filterFiles returns the directories and the files (only when withFile
+// is true) whose extension is one of exts (without dots).
+func filterFiles(ctx context.Context, word string, withFile bool, exts []string) ([]Element, error) {
+	files, err := listUpFiles(ctx, word)
+	list := make([]Element, 0, len(files))
+	for _, f := range files {
+		if endWithRoot(f.String()) {
+			list = append(list, f)
+			continue
+		}
+		if !withFile {
+			continue
+		}
+		ext := strings.TrimPrefix(filepath.Ext(f.String()), ".")
+		for _, e := range exts {
+			if strings.EqualFold(ext, strings.TrimPrefix(e, ".")) {
+				list = append(list, f)
+				break
+			}
+		}
+	}
+	return list, err
+}
+
+// listUpCobra sets the candidates of rv.Word from `__complete` of
+// the command fields[0] followed by the arguments fields[1:], or from
+// the dynamic completion of clap.
+// ok is false when the command is made with neither Cobra nor clap.
+func listUpCobra(ctx context.Context, fields []string, rv *List) (ok bool, err error) {
+	name := strings.Replace(fields[0], `"`, "", -1)
+	path := dos.LookPath(shell.LookCurdirOrder, name, "NYAGOSPATH")
+	if path == "" {
+		return false, nil
+	}
+	protocol := protocolOf(path)
+	if protocol == protocolNone {
+		return false, nil
+	}
+	args := make([]string, 0, len(fields))
+	for _, f := range fields[1:] {
+		args = append(args, strings.Replace(f, `"`, "", -1))
+	}
+	// the part until the last `=` or `;` is kept by listUpComplete.
+	prefix := rv.Word[:strings.LastIndexAny(rv.Word, ";=")+1]
+	rest := rv.Word[len(prefix):]
+
+	var r *cobraResult
+	if protocol == protocolClap {
+		r, err = callClap(ctx, path, name, args, rv.Word)
+	} else {
+		r, err = callCobra(ctx, path, args, rv.Word)
+	}
+	if err != nil {
+		list, _ := listUpFiles(ctx, rest)
+		rv.List = list
+		return true, err
+	}
+
+	rv.NoSpace = (r.directive & cobraNoSpace) != 0
+	switch {
+	case (r.directive & cobraError) != 0:
+		rv.List = nil
+	case (r.directive & cobraFilterFileExt) != 0:
+		rv.List, err = filterFiles(ctx, rest, true, r.values)
+	case (r.directive & cobraFilterDirs) != 0:
+		if len(r.values) > 0 && r.values[0] != "" {
+			// the directories under values[0]
+			base := strings.TrimRight(r.values[0], `\/`) + STD_SLASH
+			list, err1 := filterFiles(ctx, base+rest, false, nil)
+			for i, e := range list {
+				value := e.String()
+				if len(value) >= len(base) {
+					value = value[len(base):]
+				}
+				list[i] = withText(e, value)
+			}
+			rv.List, err = list, err1
+		} else {
+			rv.List, err = filterFiles(ctx, rest, false, nil)
+		}
+	default:
+		rv.List = make([]Element, 0, len(r.values))
+		for i, value := range r.values {
+			value = strings.TrimPrefix(value, prefix)
+			kind := KindOther
+			if strings.HasPrefix(value, "-") {
+				kind = KindOption
+			}
+			rv.List = append(rv.List, Candidate{Text: value, Kind: kind, Description: r.descriptions[i]})
+		}
+		if len(rv.List) <= 0 && (r.directive&cobraNoFileComp) == 0 {
+			rv.List, err = listUpFiles(ctx, rest)
+		}
+	}
+	return true, err
+}
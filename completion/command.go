@@ -2,11 +2,7 @@ package completion
 
 import (
 	"context"
-	"io/ioutil"
-	"os"
-	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/zetamatta/nyagos/dos"
 )
@@ -15,30 +11,6 @@ func isExecutable(path string) bool {
 	return dos.IsExecutableSuffix(filepath.Ext(path))
 }
 
-func listUpAllExecutableOnEnv(envName string) []Element {
-	list := make([]Element, 0, 100)
-	pathEnv := os.Getenv(envName)
-	dirList := filepath.SplitList(pathEnv)
-	for _, dir1 := range dirList {
-		files, err := ioutil.ReadDir(dir1)
-		if err != nil {
-			continue
-		}
-		for _, file1 := range files {
-			if file1.IsDir() {
-				continue
-			}
-			name := file1.Name()
-			if isExecutable(name) {
-				name_ := path.Base(name)
-				element := Element1(name_)
-				list = append(list, element)
-			}
-		}
-	}
-	return list
-}
-
 func listUpCurrentAllExecutable(ctx context.Context, str string) ([]Element, error) {
 	listTmp, listErr := listUpFiles(ctx, str)
 	if listErr != nil {
@@ -71,14 +43,18 @@ func listUpCommands(ctx context.Context, str string) ([]Element, error) {
 	if listErr != nil {
 		return nil, listErr
 	}
-	strUpr := strings.ToUpper(str)
+	var commands ranking
+	match := matcher()
+	for _, element := range list {
+		score, _ := match(lastPart(element.String()), lastPart(str))
+		commands.add(element, score)
+	}
 	for _, f := range commandListUpper {
 		for _, element := range f() {
-			name1Upr := strings.ToUpper(element.String())
-			if strings.HasPrefix(name1Upr, strUpr) {
-				list = append(list, element)
+			if score, ok := match(element.String(), str); ok {
+				commands.add(element, score)
 			}
 		}
 	}
-	return removeDup(list), nil
+	return removeDup(commands.sorted()), nil
 }
@@ -8,8 +8,6 @@ import (
 	"strings"
 	"unicode"
 
-	"github.com/zetamatta/go-box"
-
 	"github.com/zetamatta/nyagos/readline"
 	"github.com/zetamatta/nyagos/texts"
 )
@@ -37,10 +35,20 @@ type List struct {
 	Pos     int
 	Field   []string
 	Left    string
+	NoSpace bool // true when no space should follow the only candidate
 }
 
 var UseSlash = false
 
+// isSeparator returns true when the field ends a command.
+func isSeparator(field string) bool {
+	switch field {
+	case ";", "|", "&", "&&", "||", "|&":
+		return true
+	}
+	return false
+}
+
 func isTop(s string, indexes [][]int) bool {
 	if len(indexes) < 1 {
 		return true
@@ -49,7 +57,7 @@ func isTop(s string, indexes [][]int) bool {
 		return indexes[0][1] == len(s)
 	}
 	prev := s[indexes[len(indexes)-2][0]:indexes[len(indexes)-2][1]]
-	return prev == ";" || prev == "|" || prev == "&"
+	return isSeparator(prev)
 }
 
 func listUpComplete(ctx context.Context, this *readline.Buffer) (*List, rune, error) {
@@ -92,15 +100,14 @@ func listUpComplete(ctx context.Context, this *readline.Buffer) (*List, rune, er
 
 	if isTop(rv.Left, indexes) {
 		rv.List, err = listUpCommands(ctx, rv.Word[start:])
+	} else if ok, err1 := listUpArgs(ctx, rv); ok {
+		err = err1
 	} else {
 		rv.List, err = listUpFiles(ctx, rv.Word[start:])
 	}
 
 	for i := 0; i < len(rv.List); i++ {
-		rv.List[i] = Element2{
-			rv.Word[:start] + rv.List[i].String(),
-			rv.List[i].Display(),
-		}
+		rv.List[i] = withText(rv.List[i], rv.Word[:start]+rv.List[i].String())
 	}
 	for _, f := range HookToList {
 		rv, err = f(ctx, this, rv)
@@ -136,7 +143,7 @@ func KeyFuncCompletionList(ctx context.Context, this *readline.Buffer) readline.
 	if err != nil {
 		fmt.Fprintf(this.Writer, "(warning) %s\n", err.Error())
 	}
-	box.Print(ctx, toDisplay(comp.List), this.Writer)
+	printList(ctx, comp.List, this.TermWidth, this.Writer)
 	this.RepaintAll()
 	return readline.CONTINUE
 }
@@ -177,6 +184,24 @@ func CommonPrefix(list []string) string {
 	return common
 }
 
+// quote encloses str with quotechar. The quotation is not closed unless closing is true.
+func quote(str string, quotechar byte, closing bool) string {
+	var buffer strings.Builder
+	buffer.Grow(len(str) + 3)
+	if len(str) >= 2 && str[0] == '~' && os.IsPathSeparator(str[1]) {
+		buffer.WriteString(str[:1])
+		buffer.WriteByte(quotechar)
+		buffer.WriteString(str[1:])
+	} else {
+		buffer.WriteByte(quotechar)
+		buffer.WriteString(str)
+	}
+	if closing {
+		buffer.WriteByte(quotechar)
+	}
+	return buffer.String()
+}
+
 func endWithRoot(path string) bool {
 	return len(path) >= 1 && os.IsPathSeparator(path[len(path)-1])
 }
@@ -215,33 +240,31 @@ func KeyFuncCompletion(ctx context.Context, this *readline.Buffer) readline.Resu
 		}
 	}
 	if quotechar != 0 {
-		var buffer strings.Builder
-		buffer.Grow(len(commonStr) + 3)
-		if len(commonStr) >= 2 && commonStr[0] == '~' && os.IsPathSeparator(commonStr[1]) {
-			buffer.WriteString(commonStr[:1])
-			buffer.WriteByte(quotechar)
-			buffer.WriteString(commonStr[1:])
-		} else {
-			buffer.WriteByte(quotechar)
-			buffer.WriteString(commonStr)
-		}
-		if len(comp.List) == 1 && !endWithRoot(comp.List[0].String()) {
-			buffer.WriteByte(quotechar)
-		}
-		commonStr = buffer.String()
+		commonStr = quote(commonStr, quotechar,
+			len(comp.List) == 1 && !endWithRoot(comp.List[0].String()))
 	}
-	if len(comp.List) == 1 && !endWithRoot(commonStr) && !strings.HasSuffix(commonStr, `%`) {
+	if len(comp.List) == 1 && !comp.NoSpace && !endWithRoot(commonStr) && !strings.HasSuffix(commonStr, `%`) {
 		commonStr += " "
 	}
 	if slashToBackSlash {
 		commonStr = filepath.FromSlash(commonStr)
 	}
+	if MatchMode != "prefix" && len(comp.List) > 1 && len(unquote(commonStr)) < len(comp.Word) {
+		// The candidates do not start with the word. Keep it to list them.
+		commonStr = comp.RawWord
+	}
 	if comp.RawWord == commonStr {
+		if UseMenu && len(comp.List) > 1 && listedLine == comp.AllLine && listedCursor == this.Cursor {
+			listedLine, listedCursor = "", -1
+			selectMenu(this, comp, byte(default_delimiter), slashToBackSlash)
+			return readline.CONTINUE
+		}
+		listedLine, listedCursor = comp.AllLine, this.Cursor
 		this.Writer.WriteByte('\n')
 		if err != nil {
 			fmt.Fprintf(this.Writer, "(warning) %s\n", err.Error())
 		}
-		box.Print(nil, toDisplay(comp.List), this.Writer)
+		printList(ctx, comp.List, this.TermWidth, this.Writer)
 		this.RepaintAll()
 		return readline.CONTINUE
 	}
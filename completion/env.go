@@ -73,20 +73,18 @@ func listUpEnv(cmdline string) ([]Element, int, error) {
 		}
 	}
 
-	name = strings.ToUpper(name)
-	var matches []Element
+	var matches ranking
+	match := matcher()
 
 	for _, vars := range PercentVariables {
 		vars.EachKey(func(envName string) {
-			if strings.HasPrefix(strings.ToUpper(envName), name) {
-				envValue := makeCandidateStr(envName)
-				element := Element1(envValue)
-				matches = append(matches, element)
+			if score, ok := match(envName, name); ok {
+				matches.add(Candidate{Text: makeCandidateStr(envName), Kind: KindEnv}, score)
 			}
 		})
 	}
-	if len(matches) <= 0 { // nothing matches.
+	if len(matches.list) <= 0 { // nothing matches.
 		return nil, -1, nil
 	}
-	return matches, replaceStartPos, nil
+	return matches.sorted(), replaceStartPos, nil
 }
@@ -29,55 +29,72 @@ func listUpFiles(ctx context.Context, str string) ([]Element, error) {
 		orgSlash = str[pos]
 	}
 	str = strings.Replace(strings.Replace(str, OPT_SLASH, STD_SLASH, -1), `"`, "", -1)
-	directory := DirName(str)
-	wildcard := dos.Join(findfile.ExpandEnv(directory), "*")
-
-	// Drive letter
-	cutprefix := 0
-	if strings.HasPrefix(directory, STD_SLASH) {
-		wd, _ := os.Getwd()
-		directory = wd[0:2] + directory
-		cutprefix = 2
+	word := str[len(DirName(str)):]
+	directories := []string{DirName(str)}
+	if MatchMode == "camel" {
+		directories = expandSegments(directories[0])
 	}
-	commons := make([]Element, 0)
-	STR := strings.ToUpper(str)
+	match := matcher()
+
+	var commons ranking
 	canceled := false
-	fdErr := findfile.Walk(wildcard, func(fd *findfile.FileInfo) bool {
-		if ctx != nil {
-			select {
-			case <-ctx.Done():
-				canceled = true
-				return false
-			default:
-			}
-		}
-		if fd.Name() == "." || fd.Name() == ".." {
-			return true
-		}
-		if !IncludeHidden && fd.IsHidden() {
-			return true
-		}
-		listname := fd.Name()
-		name := dos.Join(directory, fd.Name())
-		if fd.IsDir() {
-			name += STD_SLASH
-			listname += OPT_SLASH
-		}
-		if cutprefix > 0 {
-			name = name[2:]
+	var fdErr error
+	for _, directory := range directories {
+		wildcard := dos.Join(findfile.ExpandEnv(directory), "*")
+
+		// Drive letter
+		cutprefix := 0
+		if strings.HasPrefix(directory, STD_SLASH) {
+			wd, _ := os.Getwd()
+			directory = wd[0:2] + directory
+			cutprefix = 2
 		}
-		nameUpr := strings.ToUpper(name)
-		if strings.HasPrefix(nameUpr, STR) {
+		fdErr = findfile.Walk(wildcard, func(fd *findfile.FileInfo) bool {
+			if ctx != nil {
+				select {
+				case <-ctx.Done():
+					canceled = true
+					return false
+				default:
+				}
+			}
+			if fd.Name() == "." || fd.Name() == ".." {
+				return true
+			}
+			if !IncludeHidden && fd.IsHidden() {
+				return true
+			}
+			score, ok := match(fd.Name(), word)
+			if !ok {
+				return true
+			}
+			listname := fd.Name()
+			name := dos.Join(directory, fd.Name())
+			if fd.IsDir() {
+				name += STD_SLASH
+				listname += OPT_SLASH
+			}
+			if cutprefix > 0 {
+				name = name[2:]
+			}
 			if orgSlash != STD_SLASH[0] {
 				name = strings.Replace(name, STD_SLASH, OPT_SLASH, -1)
 			}
-			element := Element2{name, listname}
-			commons = append(commons, element)
+			kind := KindFile
+			if fd.IsDir() {
+				kind = KindDir
+			} else if isExecutable(name) {
+				kind = KindExecutable
+			}
+			commons.add(Candidate{Text: name, Shown: listname, Kind: kind}, score)
+			return true
+		})
+		if canceled {
+			break
 		}
-		return true
-	})
+	}
 	if canceled {
-		return commons, ErrCtrlC
+		return commons.sorted(), ErrCtrlC
 	}
-	return commons, fdErr
+	return commons.sorted(), fdErr
 }
@@ -6,8 +6,8 @@ import (
 )
 
 var commandListUpper = []func() []Element{
-	func() []Element { return listUpAllExecutableOnEnv("PATH") },
-	func() []Element { return listUpAllExecutableOnEnv("NYAGOSPATH") },
+	func() []Element { return listUpIndexed("PATH") },
+	func() []Element { return listUpIndexed("NYAGOSPATH") },
 }
 
 // AppendCommandLister is the function to append the environment variable name at seeing on command-name completion.
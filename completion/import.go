@@ -0,0 +1,658 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The kinds of the completion scripts for ImportScript
+const (
+	ScriptBash = "bash"
+	ScriptFish = "fish"
+	ScriptZsh  = "zsh"
+)
+
+// ScriptKind guesses the kind of the completion script from its file name
+// and its first line: `#compdef` or `_NAME` is zsh, `NAME.fish` is fish
+// and the others are bash.
+func ScriptKind(path, firstLine string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasPrefix(firstLine, "#compdef"), strings.HasSuffix(name, ".zsh"), strings.HasPrefix(name, "_"):
+		return ScriptZsh
+	case strings.HasSuffix(name, ".fish"):
+		return ScriptFish
+	}
+	return ScriptBash
+}
+
+// scriptCommands splits the script into the commands and their words.
+// The commands end with newlines, `;`, `&`, `&&`, `|` and `||` outside of
+// the parentheses, and `(` and `)` outside of the quotations are words.
+// The comments and the continuation lines are handled as the shells do.
+func scriptCommands(script string) [][]string {
+	var commands [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	depth := 0
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\' && i+1 < len(runes):
+			i++
+			if runes[i] == '\n' {
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case c == '\'':
+			for i++; i < len(runes) && runes[i] != '\''; i++ {
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case c == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case c == '#' && !inWord:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '(' || c == ')':
+			endWord()
+			words = append(words, string(c))
+			if c == '(' {
+				depth++
+			} else if depth > 0 {
+				depth--
+			}
+		case c == '\n' || c == ';' || c == '&' || c == '|':
+			if depth > 0 {
+				endWord()
+			} else {
+				endCommand()
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// importer collects the specs defined by a completion script.
+type importer struct {
+	specs map[string]*Spec
+	names []string
+}
+
+func (im *importer) spec(name string) *Spec {
+	if spec, ok := im.specs[name]; ok {
+		return spec
+	}
+	spec := GetSpec(name)
+	if spec == nil {
+		spec = &Spec{}
+	}
+	im.specs[name] = spec
+	im.names = append(im.names, name)
+	return spec
+}
+
+// addFlag returns the flag of the spec and creates it when it does not exist.
+func addFlag(spec *Spec, name string) *Flag {
+	for _, f := range spec.Flags {
+		if f.Name == name {
+			return f
+		}
+	}
+	f := &Flag{Name: name}
+	spec.Flags = append(spec.Flags, f)
+	return f
+}
+
+// addWords adds the words to the list of the positional arguments of the spec.
+func addWords(spec *Spec, words []string) {
+	if len(words) <= 0 {
+		return
+	}
+	if len(spec.Args) <= 0 || spec.Args[0].Kind != SourceList {
+		spec.Args = []*Source{{Kind: SourceList}}
+	}
+	spec.Args[0].Words = append(spec.Args[0].Words, words...)
+}
+
+// ImportScript reads the completion script of the kind (ScriptBash,
+// ScriptFish or ScriptZsh) and registers the specs of the commands defined
+// in it. Only the static definitions are imported: the functions and the
+// commands of the shells which make the candidates are ignored.
+// It returns the names of the commands.
+func ImportScript(r io.Reader, kind string) ([]string, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	script := strings.Replace(string(source), "\r\n", "\n", -1)
+	im := &importer{specs: map[string]*Spec{}}
+	switch kind {
+	case ScriptBash:
+		im.bash(script)
+	case ScriptFish:
+		im.fish(script)
+	case ScriptZsh:
+		im.zsh(script)
+	default:
+		return nil, fmt.Errorf("%s: unknown kind of completion scripts", kind)
+	}
+	for _, name := range im.names {
+		SetSpec(name, im.specs[name])
+	}
+	return im.names, nil
+}
+
+// bash imports `complete [-W WORDLIST] [-A ACTION] [-dfev]... NAME...`
+func (im *importer) bash(script string) {
+	for _, words := range scriptCommands(script) {
+		if words[0] != "complete" {
+			continue
+		}
+		var source *Source
+		var names []string
+		ok := true
+		setAction := func(action string) {
+			switch action {
+			case "d", "directory":
+				source = &Source{Kind: SourceDirs}
+			case "f", "file":
+				source = &Source{Kind: SourceFiles}
+			case "e", "v", "export", "variable":
+				source = &Source{Kind: SourceEnv}
+			}
+		}
+		for i := 1; i < len(words); i++ {
+			arg := words[i]
+			if arg == "--" {
+				names = append(names, words[i+1:]...)
+				break
+			}
+			if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+				names = append(names, arg)
+				continue
+			}
+			for j, c := range arg[1:] {
+				if !strings.ContainsRune("oAGWFCXPS", c) {
+					if c == 'p' || c == 'r' || c == 'D' || c == 'E' || c == 'I' {
+						ok = false
+					}
+					setAction(string(c))
+					continue
+				}
+				// the parameter follows in the same word or is the next word.
+				param := arg[j+2:]
+				if param == "" && i+1 < len(words) {
+					i++
+					param = words[i]
+				}
+				switch c {
+				case 'A':
+					setAction(param)
+				case 'W':
+					if !strings.ContainsAny(param, "$`") {
+						source = &Source{Kind: SourceList, Words: strings.Fields(param)}
+					}
+				}
+				break
+			}
+		}
+		if !ok || source == nil {
+			continue
+		}
+		for _, name := range names {
+			im.spec(name).Args = []*Source{source}
+		}
+	}
+}
+
+// fishCondition returns the subcommands from `-n CONDITION` to which
+// the line is applied, and whether the arguments are the subcommands.
+func fishCondition(condition string) (subcommands []string, isSubcommand bool) {
+	for _, words := range scriptCommands(condition) {
+		for i, w := range words {
+			switch w {
+			case "__fish_use_subcommand", "__fish_is_first_arg", "__fish_is_first_token":
+				return nil, true
+			case "__fish_seen_subcommand_from":
+				if i > 0 && words[i-1] == "not" {
+					return nil, true
+				}
+				for _, sub := range words[i+1:] {
+					if !strings.HasPrefix(sub, "$") {
+						subcommands = append(subcommands, sub)
+					}
+				}
+				return subcommands, false
+			}
+		}
+	}
+	return nil, false
+}
+
+// fishArguments returns the words of `-a ARGUMENTS` and their descriptions
+// written as `WORD\tDESCRIPTION`. The command substitutions and
+// the variables are ignored.
+func fishArguments(arguments string) (words, descriptions []string) {
+	// keep `\t` from being unescaped by scriptCommands.
+	arguments = strings.Replace(arguments, `\t`, "\x00", -1)
+	for _, command := range scriptCommands(arguments) {
+		depth := 0
+		for _, w := range command {
+			if w == "(" {
+				depth++
+			} else if w == ")" {
+				depth--
+			} else if depth <= 0 && !strings.HasPrefix(w, "$") {
+				description := ""
+				if i := strings.IndexByte(w, 0); i >= 0 {
+					w, description = w[:i], w[i+1:]
+				}
+				words = append(words, w)
+				descriptions = append(descriptions, description)
+			}
+		}
+	}
+	return
+}
+
+// fish imports `complete -c NAME [-n CONDITION] [-s X] [-l LONG] [-o OLD]
+// [-d DESCRIPTION] [-a ARGUMENTS] [-r] [-x] [-f]`
+func (im *importer) fish(script string) {
+	for _, words := range scriptCommands(script) {
+		if words[0] != "complete" {
+			continue
+		}
+		var names, flags []string
+		var condition, description, arguments string
+		hasArguments, requireValue, erase := false, false, false
+		for i := 1; i < len(words); i++ {
+			arg := words[i]
+			if arg == "(" {
+				// skip the command substitution
+				for depth := 0; i < len(words); i++ {
+					if words[i] == "(" {
+						depth++
+					} else if words[i] == ")" {
+						if depth--; depth <= 0 {
+							break
+						}
+					}
+				}
+				continue
+			}
+			var option, param string
+			hasParam := false
+			if strings.HasPrefix(arg, "--") {
+				option = arg
+				if eq := strings.IndexByte(arg, '='); eq >= 0 {
+					option, param, hasParam = arg[:eq], arg[eq+1:], true
+				}
+			} else if strings.HasPrefix(arg, "-") && len(arg) >= 2 {
+				// the grouped options such as `-fa ARGUMENTS`
+				for len(arg) > 2 && strings.ContainsRune("rxfFke", rune(arg[1])) {
+					switch arg[1] {
+					case 'r', 'x':
+						requireValue = true
+					case 'e':
+						erase = true
+					}
+					arg = "-" + arg[2:]
+				}
+				option = arg[:2]
+				if len(arg) > 2 {
+					param, hasParam = arg[2:], true
+				}
+			} else {
+				continue
+			}
+			takeParam := func() string {
+				if !hasParam && i+1 < len(words) {
+					i++
+					return words[i]
+				}
+				return param
+			}
+			switch option {
+			case "-c", "--command", "-p", "--path":
+				names = append(names, takeParam())
+			case "-s", "--short-option":
+				flags = append(flags, "-"+takeParam())
+			case "-l", "--long-option":
+				flags = append(flags, "--"+takeParam())
+			case "-o", "--old-option":
+				flags = append(flags, "-"+takeParam())
+			case "-d", "--description":
+				description = takeParam()
+			case "-a", "--arguments":
+				arguments = takeParam()
+				hasArguments = true
+			case "-n", "--condition", "-w", "--wraps":
+				value := takeParam()
+				if option == "-n" || option == "--condition" {
+					condition = value
+				}
+			case "-r", "--require-parameter", "-x", "--exclusive":
+				requireValue = true
+			case "-e", "--erase":
+				erase = true
+			}
+		}
+		if erase {
+			continue
+		}
+		values, descriptions := fishArguments(arguments)
+		subcommands, isSubcommand := fishCondition(condition)
+		for _, name := range names {
+			targets := []*Spec{im.spec(name)}
+			if len(subcommands) > 0 {
+				targets = targets[:0]
+				for _, sub := range subcommands {
+					targets = append(targets, im.spec(name).Subcommand(sub))
+				}
+			}
+			for _, spec := range targets {
+				if len(flags) > 0 {
+					for _, flagName := range flags {
+						f := addFlag(spec, flagName)
+						if description != "" {
+							f.Description = description
+						}
+						if requireValue && hasArguments && len(values) > 0 {
+							f.Value = &Source{Kind: SourceList, Words: values}
+						} else if requireValue && f.Value == nil {
+							f.Value = &Source{Kind: SourceFiles}
+						}
+					}
+				} else if isSubcommand {
+					for i, value := range values {
+						sub := spec.Subcommand(value)
+						if description != "" {
+							sub.Description = description
+						} else if descriptions[i] != "" {
+							sub.Description = descriptions[i]
+						}
+					}
+				} else {
+					addWords(spec, values)
+				}
+			}
+		}
+	}
+}
+
+// zshAction converts the action of the spec of `_arguments` to Source.
+// nil means the action is not supported.
+func zshAction(action string) *Source {
+	action = strings.TrimSpace(action)
+	switch {
+	case strings.HasPrefix(action, "(("):
+		// ((VALUE1\:DESCRIPTION1 VALUE2\:DESCRIPTION2))
+		var words []string
+		for _, w := range strings.Fields(strings.Trim(action, "()")) {
+			if i := strings.IndexByte(w, ':'); i >= 0 {
+				w = strings.TrimSuffix(w[:i], `\`)
+			}
+			words = append(words, w)
+		}
+		return &Source{Kind: SourceList, Words: words}
+	case strings.HasPrefix(action, "("):
+		return &Source{Kind: SourceList, Words: strings.Fields(strings.Trim(action, "()"))}
+	case action == "_directories", strings.HasPrefix(action, "_files -/"), strings.HasPrefix(action, "_path_files -/"):
+		return &Source{Kind: SourceDirs}
+	case strings.HasPrefix(action, "_files"), strings.HasPrefix(action, "_path_files"):
+		return &Source{Kind: SourceFiles}
+	case action == "_parameters", action == "_vars":
+		return &Source{Kind: SourceEnv}
+	}
+	return nil
+}
+
+// splitZshSpec splits the text by `:` not escaped with `\`.
+func splitZshSpec(text string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+		} else if text[i] == ':' {
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// zshArgument adds the spec of `_arguments` such as `-v[DESCRIPTION]`,
+// `--output=[DESCRIPTION]:MESSAGE:ACTION`, `{-v,--verbose}[DESCRIPTION]`,
+// `N:MESSAGE:ACTION` and `*:MESSAGE:ACTION` to spec. positions has the
+// sources of the positional arguments and the key 0 is for `*`.
+func zshArgument(spec *Spec, text string, positions map[int]*Source) {
+	if strings.HasPrefix(text, "(") {
+		// the exclusion list
+		if i := strings.IndexByte(text, ')'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	rest := strings.HasPrefix(text, "*")
+	text = strings.TrimPrefix(text, "*")
+	if text == "" {
+		return
+	}
+	if text[0] != '-' && text[0] != '+' && text[0] != '{' {
+		parts := splitZshSpec(text)
+		position := 0
+		if n, err := strconv.Atoi(parts[0]); err == nil && n > 0 {
+			position = n
+		} else if parts[0] != "" {
+			return
+		} else if !rest {
+			// the next position
+			for n := range positions {
+				if n > position {
+					position = n
+				}
+			}
+			position++
+		}
+		if len(parts) >= 2 && parts[1] == "" {
+			// `N::MESSAGE:ACTION` is optional.
+			parts = parts[1:]
+		}
+		var source *Source
+		if len(parts) >= 3 {
+			source = zshAction(strings.Join(parts[2:], ":"))
+		}
+		if source == nil {
+			source = &Source{Kind: SourceFiles}
+		}
+		positions[position] = source
+		return
+	}
+	var names []string
+	if text[0] == '{' {
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			return
+		}
+		names = strings.Split(text[1:end], ",")
+		text = text[end+1:]
+	} else {
+		end := strings.IndexAny(text, "[:")
+		if end < 0 {
+			end = len(text)
+		}
+		names = []string{text[:end]}
+		text = text[end:]
+	}
+	description := ""
+	if strings.HasPrefix(text, "[") {
+		if end := strings.IndexByte(text, ']'); end >= 0 {
+			description = text[1:end]
+			text = text[end+1:]
+		}
+	}
+	var value *Source
+	if parts := splitZshSpec(text); len(parts) >= 2 {
+		if len(parts) >= 3 {
+			value = zshAction(strings.Join(parts[2:], ":"))
+		}
+		if value == nil {
+			value = &Source{Kind: SourceFiles}
+		}
+	}
+	for _, name := range names {
+		// `-o+`, `--output=` and `--output=-` take the value.
+		hasValue := false
+		for _, suffix := range []string{"=-", "=", "+"} {
+			if len(name) > len(suffix)+1 && strings.HasSuffix(name, suffix) {
+				name = strings.TrimSuffix(name, suffix)
+				hasValue = true
+				break
+			}
+		}
+		if name == "" {
+			continue
+		}
+		f := addFlag(spec, name)
+		f.Description = description
+		if value != nil || hasValue {
+			f.Value = value
+			if f.Value == nil {
+				f.Value = &Source{Kind: SourceFiles}
+			}
+		}
+	}
+}
+
+// zsh imports `_arguments SPEC...` and `_describe MESSAGE ARRAY` of
+// the script starting with `#compdef NAME...`.
+func (im *importer) zsh(script string) {
+	var names []string
+	firstLine := script
+	if i := strings.IndexByte(script, '\n'); i >= 0 {
+		firstLine = script[:i]
+	}
+	if strings.HasPrefix(firstLine, "#compdef") {
+		for _, name := range strings.Fields(firstLine)[1:] {
+			if !strings.HasPrefix(name, "-") {
+				names = append(names, strings.SplitN(name, "=", 2)[0])
+			}
+		}
+	}
+	commands := scriptCommands(script)
+	for _, words := range commands {
+		if words[0] == "compdef" && len(words) >= 3 {
+			for _, name := range words[2:] {
+				if !strings.HasPrefix(name, "-") {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	if len(names) <= 0 {
+		return
+	}
+	arrays := map[string][]string{}
+	spec := &Spec{}
+	positions := map[int]*Source{}
+	for _, words := range commands {
+		for i, w := range words {
+			switch {
+			case strings.HasSuffix(w, "=") && i+1 < len(words) && words[i+1] == "(":
+				var items []string
+				for _, item := range words[i+2:] {
+					if item == ")" {
+						break
+					}
+					items = append(items, item)
+				}
+				arrays[strings.TrimSuffix(w, "=")] = items
+			case w == "_arguments":
+				options := true
+				for _, arg := range words[i+1:] {
+					if arg == "(" || arg == ")" || strings.HasPrefix(arg, "$") {
+						continue
+					}
+					if options && len(arg) == 2 && arg[0] == '-' {
+						// the options of _arguments itself such as -s and -C
+						continue
+					}
+					options = false
+					zshArgument(spec, arg, positions)
+				}
+			case w == "_describe":
+				for _, arg := range words[i+1:] {
+					for _, item := range arrays[arg] {
+						parts := splitZshSpec(item)
+						sub := spec.Subcommand(strings.Replace(parts[0], `\:`, ":", -1))
+						if len(parts) >= 2 {
+							sub.Description = strings.Join(parts[1:], ":")
+						}
+					}
+				}
+			}
+		}
+	}
+	star, hasStar := positions[0]
+	delete(positions, 0)
+	for n := 1; len(positions) > 0; n++ {
+		source, ok := positions[n]
+		if !ok {
+			source = &Source{Kind: SourceFiles}
+		}
+		delete(positions, n)
+		spec.Args = append(spec.Args, source)
+	}
+	if hasStar {
+		spec.Args = append(spec.Args, star)
+	}
+	for _, name := range names {
+		target := im.spec(name)
+		for _, f := range spec.Flags {
+			*addFlag(target, f.Name) = *f
+		}
+		if len(spec.Args) > 0 {
+			target.Args = spec.Args
+		}
+		for sub, s := range spec.Subcommands {
+			target.Subcommand(sub)
+			target.Subcommands[sub] = s
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package completion
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testImported returns the candidates of the command-line by the spec imported.
+func testImported(t *testing.T, left string) string {
+	t.Helper()
+	fields := strings.Fields(left)
+	word := ""
+	if !strings.HasSuffix(left, " ") {
+		word = fields[len(fields)-1]
+	}
+	rv := &List{Field: fields, Left: left, Word: word}
+	if _, err := listUpArgs(context.Background(), rv); err != nil {
+		t.Fatalf("%q: %s", left, err.Error())
+	}
+	return strings.Join(toComplete(rv.List), " ")
+}
+
+func TestImportScript(t *testing.T) {
+	UseCobra = false
+	defer func() { UseCobra = true }()
+
+	tests := []struct {
+		kind   string
+		script string
+		names  string
+		expect map[string]string
+	}{
+		{ScriptBash, "_foo() {\n  COMPREPLY=()\n}\ncomplete -F _foo foo\ncomplete -W \"start stop\" svc svcctl\ncomplete -o default -A directory mycd\n",
+			"svc svcctl mycd",
+			map[string]string{"svc s": "start stop", "svcctl st": "start stop"}},
+		{ScriptFish, "complete -c tool -f\n" +
+			"complete -c tool -n '__fish_use_subcommand' -a build -d 'Compile the package'\n" +
+			"complete -c tool -n \"__fish_use_subcommand\" -a 'run\\tExecute test\\tTest'\n" +
+			"complete -c tool -s v -l verbose -d 'Print more'\n" +
+			"complete -c tool -n '__fish_seen_subcommand_from build' -l target -xa 'debug release'\n" +
+			"complete -c tool -n '__fish_seen_subcommand_from run' -a '(__fish_complete_pids) all'\n",
+			"tool",
+			map[string]string{
+				"tool ":                "build run test",
+				"tool --v":             "--verbose",
+				"tool build --target ": "debug release",
+				"tool run ":            "all",
+			}},
+		{ScriptZsh, "#compdef ztool=zt\n\n" +
+			"_ztool() {\n" +
+			"  local -a commands\n" +
+			"  commands=(\n    'init:Create a new project'\n    'clean:Remove the outputs'\n  )\n" +
+			"  _arguments -s \\\n" +
+			"    '(-q --quiet)'{-q,--quiet}'[Print less]' \\\n" +
+			"    '--color=[When to color]:when:(always never auto)' \\\n" +
+			"    '1: :->command' \\\n" +
+			"    '*::file:_files' && ret=0\n" +
+			"  _describe 'command' commands\n" +
+			"}\n",
+			"ztool",
+			map[string]string{
+				"ztool ":          "clean init",
+				"ztool --q":       "--quiet",
+				"ztool -":         "-q --quiet --color",
+				"ztool --color=n": "never",
+			}},
+	}
+	for _, test := range tests {
+		names, err := ImportScript(strings.NewReader(test.script), test.kind)
+		if err != nil {
+			t.Fatalf("%s: %s", test.kind, err.Error())
+		}
+		for _, name := range names {
+			defer SetSpec(name, nil)
+		}
+		if result := strings.Join(names, " "); result != test.names {
+			t.Fatalf("%s: names %q != %q", test.kind, result, test.names)
+		}
+		for left, expect := range test.expect {
+			if result := testImported(t, left); result != expect {
+				t.Errorf("%s: %q: %q != %q", test.kind, left, result, expect)
+			}
+		}
+	}
+	if spec := GetSpec("tool"); spec.Subcommands["build"].Description != "Compile the package" ||
+		spec.Subcommands["test"].Description != "Test" {
+		t.Errorf("the descriptions of the subcommands: %q %q",
+			spec.Subcommands["build"].Description, spec.Subcommands["test"].Description)
+	}
+	if _, err := ImportScript(strings.NewReader(""), "csh"); err == nil {
+		t.Error("no error for the unknown kind")
+	}
+}
+
+func TestScriptKind(t *testing.T) {
+	tests := map[[2]string]string{
+		{"_git", ""}:                      ScriptZsh,
+		{"git.zsh", ""}:                   ScriptZsh,
+		{"completion.txt", "#compdef gh"}: ScriptZsh,
+		{`C:\fish\gh.fish`, ""}:           ScriptFish,
+		{"gh.bash", "# bash completion"}:  ScriptBash,
+	}
+	for source, expect := range tests {
+		if result := ScriptKind(source[0], source[1]); result != expect {
+			t.Errorf("%q: %s != %s", source, result, expect)
+		}
+	}
+}
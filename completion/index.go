@@ -0,0 +1,249 @@
+package completion
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zetamatta/nyagos/dos"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// IndexCheckInterval is how often the directories of the index are checked
+// whether they are updated.
+var IndexCheckInterval = 5 * time.Second
+
+// dirIndex is the executables in one directory of PATH or NYAGOSPATH.
+type dirIndex struct {
+	modTime time.Time
+	names   []string          // in the order of the directory
+	files   map[string]string // the names in upper case to the names
+}
+
+// The index is replaced as a whole by updateIndex and never modified.
+var (
+	indexMutex   sync.Mutex
+	indexDirs    = map[string]*dirIndex{} // the directories in upper case
+	indexedPath  = ""                     // PATH and NYAGOSPATH indexed
+	indexedTime  time.Time
+	indexDirty   = false
+	indexRunning = false
+)
+
+func currentPath() string {
+	return os.Getenv("PATH") + string(os.PathListSeparator) + os.Getenv("NYAGOSPATH")
+}
+
+// splitPath returns the directories of path without the empty and duplicated ones.
+func splitPath(path string) []string {
+	found := map[string]struct{}{}
+	dirs := []string{}
+	for _, dir := range filepath.SplitList(path) {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		if _, ok := found[strings.ToUpper(dir)]; !ok {
+			found[strings.ToUpper(dir)] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// readDirIndex reads the executables in dir unless it is not updated since old.
+func readDirIndex(dir string, old *dirIndex) *dirIndex {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil
+	}
+	if old != nil && old.modTime.Equal(stat.ModTime()) {
+		return old
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	d := &dirIndex{
+		modTime: stat.ModTime(),
+		files:   map[string]string{},
+	}
+	for _, file1 := range files {
+		if file1.IsDir() || !isExecutable(file1.Name()) {
+			continue
+		}
+		d.names = append(d.names, file1.Name())
+		d.files[strings.ToUpper(file1.Name())] = file1.Name()
+	}
+	return d
+}
+
+// updateIndex reads the directories of path which are updated
+// and forgets the directories not in path.
+func updateIndex(path string, old map[string]*dirIndex) {
+	dirs := map[string]*dirIndex{}
+	for _, dir := range splitPath(path) {
+		// nil means the directory can not be read.
+		key := strings.ToUpper(dir)
+		dirs[key] = readDirIndex(dir, old[key])
+	}
+	indexMutex.Lock()
+	indexDirs = dirs
+	indexedPath = path
+	indexedTime = time.Now()
+	indexMutex.Unlock()
+}
+
+// RefreshIndex updates the index of the executables in the background.
+func RefreshIndex() {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+	indexDirty = true
+	if indexRunning {
+		return
+	}
+	indexRunning = true
+	go func() {
+		for {
+			indexMutex.Lock()
+			if !indexDirty {
+				indexRunning = false
+				indexMutex.Unlock()
+				return
+			}
+			indexDirty = false
+			old := indexDirs
+			indexMutex.Unlock()
+
+			updateIndex(currentPath(), old)
+		}
+	}()
+}
+
+// Rehash reads all the directories of PATH and NYAGOSPATH again now.
+func Rehash() {
+	updateIndex(currentPath(), nil)
+}
+
+// EnvChanged refreshes the index when the environment variable is PATH or NYAGOSPATH.
+func EnvChanged(name string) {
+	if strings.EqualFold(name, "PATH") || strings.EqualFold(name, "NYAGOSPATH") {
+		RefreshIndex()
+	}
+}
+
+// getIndex returns the index and refreshes it in the background when
+// PATH is changed or IndexCheckInterval has passed.
+func getIndex() map[string]*dirIndex {
+	indexMutex.Lock()
+	dirs := indexDirs
+	stale := indexedPath != currentPath() || time.Since(indexedTime) > IndexCheckInterval
+	indexMutex.Unlock()
+	if stale {
+		RefreshIndex()
+	}
+	return dirs
+}
+
+// listUpIndexed returns the executables in the directories of the environment variable.
+func listUpIndexed(envName string) []Element {
+	indexMutex.Lock()
+	empty := indexedPath == ""
+	indexMutex.Unlock()
+	if empty {
+		Rehash()
+	}
+	dirs := getIndex()
+	list := make([]Element, 0, 100)
+	for _, dir := range splitPath(os.Getenv(envName)) {
+		if d := dirs[strings.ToUpper(dir)]; d != nil {
+			for _, name := range d.names {
+				list = append(list, Candidate{Text: name, Kind: KindExecutable})
+			}
+		}
+	}
+	return list
+}
+
+// find returns the name of the file for the command-name in the directory.
+func (d *dirIndex) find(name string) string {
+	NAME := strings.ToUpper(name)
+	if file, ok := d.files[NAME]; ok {
+		return file
+	}
+	for _, ext := range filepath.SplitList(os.Getenv("PATHEXT")) {
+		if file, ok := d.files[NAME+strings.ToUpper(ext)]; ok {
+			return file
+		}
+	}
+	return ""
+}
+
+// path returns the path of the executable for the command-name in dir,
+// which is resolved when it is a symbolic link.
+func (d *dirIndex) path(dir, name string) string {
+	file := d.find(name)
+	if file == "" {
+		return ""
+	}
+	path := filepath.Join(dir, file)
+	if linkTo, err := os.Readlink(path); err == nil && linkTo != "" {
+		if filepath.IsAbs(linkTo) {
+			return linkTo
+		}
+		return filepath.Join(dir, linkTo)
+	}
+	return path
+}
+
+// LookPath returns the path of the executable like dos.LookPath, but finds
+// it in the index for the directories of PATH and NYAGOSPATH.
+// The directories where the index misses are searched as before,
+// so the result is the same as dos.LookPath even if the index is old.
+func LookPath(name string) string {
+	return lookPath(name, false)
+}
+
+// LookPathCached is LookPath which trusts the index and does not search
+// the directories. It is for highlighting and completion, which are called
+// at every key, and may be wrong until the index is refreshed.
+func LookPathCached(name string) string {
+	return lookPath(name, true)
+}
+
+func lookPath(name string, cached bool) string {
+	name = strings.Replace(name, `"`, "", -1)
+	if strings.ContainsAny(name, `\/:`) {
+		return dos.LookPath(shell.LookCurdirOrder, name, "NYAGOSPATH")
+	}
+	curdir := "." + string(os.PathSeparator) + name
+	if shell.LookCurdirOrder == dos.LookCurdirFirst {
+		if path := dos.LookPath(dos.LookCurdirNever, curdir); path != "" {
+			return path
+		}
+	}
+	dirs := getIndex()
+	for _, dir := range splitPath(currentPath()) {
+		d, indexed := dirs[strings.ToUpper(dir)]
+		if d != nil {
+			if path := d.path(dir, name); path != "" {
+				if _, err := os.Stat(path); cached || err == nil {
+					return path
+				}
+			}
+		}
+		if indexed && cached {
+			continue
+		}
+		if path := dos.LookPath(dos.LookCurdirNever, filepath.Join(dir, name)); path != "" {
+			return path
+		}
+	}
+	if shell.LookCurdirOrder == dos.LookCurdirLast {
+		return dos.LookPath(dos.LookCurdirNever, curdir)
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package completion
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"foo.exe", "bar.exe", "readme.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := readDirIndex(dir, nil)
+	if d == nil || len(d.names) != 2 {
+		t.Fatalf("readDirIndex: %v", d)
+	}
+	if file := d.find("FOO.EXE"); file != "foo.exe" {
+		t.Errorf("find(FOO.EXE) = %q", file)
+	}
+	if file := d.find("readme.txt"); file != "" {
+		t.Errorf("find(readme.txt) = %q", file)
+	}
+	if d1 := readDirIndex(dir, d); d1 != d {
+		t.Error("readDirIndex read the directory not updated")
+	}
+	d.modTime = d.modTime.Add(-time.Second)
+	if d1 := readDirIndex(dir, d); d1 == d {
+		t.Error("readDirIndex did not read the directory updated")
+	}
+
+	if dirs := splitPath(dir + string(os.PathListSeparator) + " " +
+		string(os.PathListSeparator) + dir); len(dirs) != 1 {
+		t.Errorf("splitPath: %v", dirs)
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo.exe"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer os.Setenv("NYAGOSPATH", os.Getenv("NYAGOSPATH"))
+	defer os.Setenv("PATHEXT", os.Getenv("PATHEXT"))
+	os.Setenv("PATH", dir)
+	os.Setenv("NYAGOSPATH", "")
+	os.Setenv("PATHEXT", ".EXE")
+	defer func(interval time.Duration) { IndexCheckInterval = interval }(IndexCheckInterval)
+	IndexCheckInterval = time.Hour
+	Rehash()
+
+	// the index is not refreshed for the files below.
+	if err := os.Remove(filepath.Join(dir, "foo.exe")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bar.exe"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if path := LookPathCached("foo"); path != filepath.Join(dir, "foo.exe") {
+		t.Errorf("LookPathCached(foo) = %q", path)
+	}
+	if path := LookPathCached("bar"); path != "" {
+		t.Errorf("LookPathCached(bar) = %q", path)
+	}
+	if path := LookPath("foo"); path != "" {
+		t.Errorf("LookPath(foo) = %q for the removed file", path)
+	}
+	if path := LookPath("bar"); path != filepath.Join(dir, "bar.exe") {
+		t.Errorf("LookPath(bar) = %q for the new file", path)
+	}
+}
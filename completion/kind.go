@@ -0,0 +1,236 @@
+package completion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zetamatta/go-box"
+
+	"github.com/zetamatta/nyagos/readline"
+)
+
+// The kinds of Candidate in the order of the listing
+const (
+	KindOther = iota
+	KindOption
+	KindDir
+	KindFile
+	KindExecutable
+	KindAlias
+	KindBuiltIn
+	KindEnv
+	kindCount
+)
+
+// Candidate is the Element with the kind and the description.
+type Candidate struct {
+	Text        string // the text to insert
+	Shown       string // the text to list. "" means Text.
+	Kind        int
+	Description string
+}
+
+func (c Candidate) String() string { return c.Text }
+
+func (c Candidate) Display() string {
+	if c.Shown == "" {
+		return c.Text
+	}
+	return c.Shown
+}
+
+// kindNames are the names of the kinds for c.kind of nyagos.completion_hook
+var kindNames = [kindCount]string{
+	"", "option", "dir", "file", "executable", "alias", "builtin", "env",
+}
+
+var kindHeadings = [kindCount]string{
+	"Others", "Options", "Directories", "Files", "Executables",
+	"Aliases", "Built-in commands", "Environment variables",
+}
+
+// KindColors are the parameters of SGR to list the candidates of each kind.
+var KindColors = [kindCount]string{
+	KindOption:     "36",
+	KindDir:        "1;34",
+	KindExecutable: "1;32",
+	KindAlias:      "1;36",
+	KindBuiltIn:    "1;33",
+	KindEnv:        "35",
+}
+
+// KindName returns the name of the kind such as "file" and "dir".
+func KindName(kind int) string {
+	if kind < 0 || kind >= kindCount {
+		return ""
+	}
+	return kindNames[kind]
+}
+
+// ParseKind returns the kind of the name. Unknown names are KindOther.
+func ParseKind(name string) int {
+	for i, name1 := range kindNames {
+		if strings.EqualFold(name, name1) {
+			return i
+		}
+	}
+	return KindOther
+}
+
+func kindOf(e Element) int {
+	if c, ok := e.(Candidate); ok && c.Kind >= 0 && c.Kind < kindCount {
+		return c.Kind
+	}
+	return KindOther
+}
+
+func descriptionOf(e Element) string {
+	if c, ok := e.(Candidate); ok {
+		return c.Description
+	}
+	return ""
+}
+
+// withText returns the element whose text to insert is replaced.
+func withText(e Element, text string) Element {
+	if c, ok := e.(Candidate); ok {
+		c.Shown = c.Display()
+		c.Text = text
+		return c
+	}
+	return Element2{text, e.Display()}
+}
+
+// truncate cuts s within width.
+func truncate(s string, width int) (string, int) {
+	var buffer strings.Builder
+	w := 0
+	for _, ch := range s {
+		cw := readline.GetCharWidth(ch)
+		if w+cw > width {
+			break
+		}
+		buffer.WriteRune(ch)
+		w += cw
+	}
+	return buffer.String(), w
+}
+
+// printGroup lists the candidates of one kind in the columns, or with
+// the descriptions line by line when they exist and the width is enough.
+func printGroup(ctx context.Context, list []Element, width int, w io.Writer) {
+	nameWidth := 0
+	hasDescription := false
+	for _, e := range list {
+		if n := readline.GetStringWidth(e.Display()); n > nameWidth {
+			nameWidth = n
+		}
+		if descriptionOf(e) != "" {
+			hasDescription = true
+		}
+	}
+	if nameWidth > width-3 {
+		nameWidth = width - 3
+	}
+	paint := func(e Element, padding int) {
+		name, n := truncate(e.Display(), nameWidth)
+		if color := KindColors[kindOf(e)]; color != "" {
+			fmt.Fprintf(w, "\x1B[%sm%s\x1B[0m", color, name)
+		} else {
+			io.WriteString(w, name)
+		}
+		if padding > 0 {
+			fmt.Fprintf(w, "%*s", padding-n, "")
+		}
+	}
+	canceled := func() bool {
+		if ctx == nil {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return true
+		default:
+			return false
+		}
+	}
+	const minDescriptionWidth = 16
+	if hasDescription && nameWidth+2+minDescriptionWidth < width {
+		for _, e := range list {
+			if canceled() {
+				return
+			}
+			if d := descriptionOf(e); d != "" {
+				paint(e, nameWidth+2)
+				d, _ = truncate(d, width-1-nameWidth-2)
+				fmt.Fprintf(w, "\x1B[2m%s\x1B[0m\n", d)
+			} else {
+				paint(e, 0)
+				io.WriteString(w, "\n")
+			}
+		}
+		return
+	}
+	colWidth := nameWidth + 2
+	cols := (width - 1) / colWidth
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(list) + cols - 1) / cols
+	for row := 0; row < rows; row++ {
+		if canceled() {
+			return
+		}
+		for col := 0; col < cols; col++ {
+			i := col*rows + row
+			if i >= len(list) {
+				break
+			}
+			if i+rows < len(list) {
+				paint(list[i], colWidth)
+			} else {
+				paint(list[i], 0)
+			}
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// printList lists the candidates grouped by the kinds with the headings
+// and the colours. The candidates without the kinds and the descriptions
+// are listed by box.Print as before.
+func printList(ctx context.Context, list []Element, width int, w io.Writer) {
+	if width < 10 {
+		width = 80
+	}
+	var groups [kindCount][]Element
+	plain := true
+	for _, e := range list {
+		kind := kindOf(e)
+		groups[kind] = append(groups[kind], e)
+		if kind != KindOther || descriptionOf(e) != "" {
+			plain = false
+		}
+	}
+	if plain {
+		box.Print(ctx, toDisplay(list), w)
+		return
+	}
+	n := 0
+	for _, g := range groups {
+		if len(g) > 0 {
+			n++
+		}
+	}
+	for kind, g := range groups {
+		if len(g) <= 0 {
+			continue
+		}
+		if n > 1 {
+			fmt.Fprintf(w, "\x1B[1m%s:\x1B[0m\n", kindHeadings[kind])
+		}
+		printGroup(ctx, g, width, w)
+	}
+}
@@ -0,0 +1,34 @@
+package completion
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPrintList(t *testing.T) {
+	list := []Element{
+		Candidate{Text: "build", Description: "compile packages"},
+		Candidate{Text: "--verbose", Kind: KindOption, Description: "print more"},
+		Candidate{Text: "go.mod", Kind: KindFile},
+	}
+	KindColors[KindOption] = ""
+	defer func() { KindColors[KindOption] = "36" }()
+
+	var buffer strings.Builder
+	printList(context.Background(), list, 40, &buffer)
+	expect := "\x1B[1mOthers:\x1B[0m\n" +
+		"build  \x1B[2mcompile packages\x1B[0m\n" +
+		"\x1B[1mOptions:\x1B[0m\n" +
+		"--verbose  \x1B[2mprint more\x1B[0m\n" +
+		"\x1B[1mFiles:\x1B[0m\n" +
+		"go.mod\n"
+	if result := buffer.String(); result != expect {
+		t.Fatalf("printList: %q, expected %q", result, expect)
+	}
+	for _, name := range []string{"", "option", "dir", "file", "executable", "alias", "builtin", "env"} {
+		if result := KindName(ParseKind(name)); result != name {
+			t.Fatalf("KindName(ParseKind(%q)) = %q", name, result)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package completion
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/zetamatta/go-findfile"
+
+	"github.com/zetamatta/nyagos/dos"
+	"github.com/zetamatta/nyagos/readline"
+)
+
+// Matcher returns the score of the name for the word typed. The higher is
+// the better. ok is false when the name does not match.
+type Matcher func(name, word string) (score int, ok bool)
+
+// Matchers are the ways to match the candidates selected by MatchMode.
+var Matchers = map[string]Matcher{
+	"prefix":    matchPrefix,
+	"substring": matchSubstring,
+	"camel":     matchCamel,
+	"fuzzy":     matchFuzzy,
+}
+
+// MatchMode is the name of Matchers to list up the files, the commands
+// and the environment variables (`set -o completion_match=MODE`).
+var MatchMode = "prefix"
+
+func matcher() Matcher {
+	if m, ok := Matchers[MatchMode]; ok {
+		return m
+	}
+	return matchPrefix
+}
+
+// smartCase returns the comparison of the runes which ignores the case
+// unless the word contains upper-case letters.
+func smartCase(word string) func(a, b rune) bool {
+	if strings.ToLower(word) != word {
+		return func(a, b rune) bool { return a == b }
+	}
+	return func(a, b rune) bool { return unicode.ToLower(a) == unicode.ToLower(b) }
+}
+
+// matchPrefix matches the names starting with the word ignoring the case.
+func matchPrefix(name, word string) (int, bool) {
+	return 0, strings.HasPrefix(strings.ToUpper(name), strings.ToUpper(word))
+}
+
+// matchSubstring matches the names containing the word.
+// The earlier position is the better.
+func matchSubstring(name, word string) (int, bool) {
+	if strings.ToLower(word) == word {
+		name = strings.ToLower(name)
+	}
+	i := strings.Index(name, word)
+	return -i, i >= 0
+}
+
+// segmentSeparators are the runes between the segments of the names.
+const segmentSeparators = `/\_-.: `
+
+// isSegmentTop returns true when text[i] starts a segment or is a separator.
+func isSegmentTop(text []rune, i int) bool {
+	if i <= 0 || strings.ContainsRune(segmentSeparators, text[i]) {
+		return true
+	}
+	if strings.ContainsRune(segmentSeparators, text[i-1]) {
+		return true
+	}
+	return unicode.IsLower(text[i-1]) && unicode.IsUpper(text[i])
+}
+
+// camelFrom returns true when word matches the part of name from i, where
+// each rune continues the match or starts it again at the top of a segment.
+func camelFrom(name, word []rune, i int, equal func(a, b rune) bool) bool {
+	if len(word) <= 0 {
+		return true
+	}
+	if i < len(name) && equal(name[i], word[0]) && camelFrom(name, word[1:], i+1, equal) {
+		return true
+	}
+	for j := i + 1; j < len(name); j++ {
+		if isSegmentTop(name, j) && equal(name[j], word[0]) &&
+			camelFrom(name, word[1:], j+1, equal) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCamel matches the names whose segments start with the parts of
+// the word: `gN` matches `getName` and `ny.g` matches `nyagos.go`.
+// The names starting with the word are the better.
+func matchCamel(name, word string) (int, bool) {
+	equal := smartCase(word)
+	nameRunes := []rune(name)
+	wordRunes := []rune(word)
+	if len(wordRunes) <= 0 {
+		return 0, true
+	}
+	if len(nameRunes) <= 0 || !equal(nameRunes[0], wordRunes[0]) ||
+		!camelFrom(nameRunes, wordRunes[1:], 1, equal) {
+		return 0, false
+	}
+	if score, ok := matchPrefix(name, word); ok {
+		return score + 1, true
+	}
+	return 0, true
+}
+
+// matchFuzzy matches the names containing the runes of the word in order
+// with the score of the fuzzy finder.
+func matchFuzzy(name, word string) (int, bool) {
+	if word == "" {
+		return 0, true
+	}
+	score, _, ok := readline.FuzzyScore(word, name)
+	return score, ok
+}
+
+// ranking collects the candidates matched and their scores.
+type ranking struct {
+	list   []Element
+	scores []int
+}
+
+func (r *ranking) add(e Element, score int) {
+	r.list = append(r.list, e)
+	r.scores = append(r.scores, score)
+}
+
+// sorted returns the candidates in the order of the scores.
+// The candidates of the same score keep the order added.
+func (r *ranking) sorted() []Element {
+	index := make([]int, len(r.list))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return r.scores[index[i]] > r.scores[index[j]]
+	})
+	result := make([]Element, len(index))
+	for i, j := range index {
+		result[i] = r.list[j]
+	}
+	return result
+}
+
+// lastPart returns the part after the last separator of the directories,
+// `=` and `;`.
+func lastPart(s string) string {
+	s = strings.TrimRight(s, `/\`)
+	return s[strings.LastIndexAny(s, `/\=;`)+1:]
+}
+
+// matchWord returns true when the candidate matches the word being typed.
+// Except for the prefix mode, only the last parts of the paths are compared
+// because the directories may be matched by the segments.
+func matchWord(candidate, word string) bool {
+	if MatchMode == "prefix" {
+		_, ok := matchPrefix(filepath.ToSlash(candidate), filepath.ToSlash(word))
+		return ok
+	}
+	_, ok := matcher()(lastPart(candidate), lastPart(word))
+	return ok
+}
+
+func isDir(path string) bool {
+	stat, err := os.Stat(findfile.ExpandEnv(path))
+	return err == nil && stat.IsDir()
+}
+
+// maxSegmentDirs is the limit of the directories expandSegments returns.
+const maxSegmentDirs = 100
+
+// expandSegments returns the directories whose names match each part of
+// dir by matchCamel: `s\n\` is expanded to `src\nyagos\`. The parts which
+// exist as they are or have the drive, `~` and `%` are kept.
+func expandSegments(dir string) []string {
+	if dir == "" || isDir(dir) {
+		return []string{dir}
+	}
+	results := []string{""}
+	for _, part := range strings.SplitAfter(dir, STD_SLASH) {
+		if part == "" {
+			continue
+		}
+		segment := strings.TrimSuffix(part, STD_SLASH)
+		next := []string{}
+		for _, parent := range results {
+			literal := parent + part
+			if segment == "" || segment == "." || segment == ".." ||
+				strings.ContainsAny(segment, "%~:") || isDir(literal) {
+				next = append(next, literal)
+				continue
+			}
+			wildcard := dos.Join(findfile.ExpandEnv(parent), "*")
+			findfile.Walk(wildcard, func(fd *findfile.FileInfo) bool {
+				if !fd.IsDir() || fd.Name() == "." || fd.Name() == ".." {
+					return true
+				}
+				if !IncludeHidden && fd.IsHidden() {
+					return true
+				}
+				if _, ok := matchCamel(fd.Name(), segment); ok {
+					next = append(next, parent+fd.Name()+STD_SLASH)
+				}
+				return len(next) < maxSegmentDirs
+			})
+		}
+		results = next
+	}
+	return results
+}
@@ -0,0 +1,44 @@
+package completion
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		mode   string
+		name   string
+		word   string
+		expect bool
+	}{
+		{"prefix", "nyagos.go", "NYA", true},
+		{"prefix", "nyagos.go", "gos", false},
+		{"substring", "nyagos.go", "gos", true},
+		{"substring", "nyagos.go", "Gos", false},
+		{"camel", "nyagos.go", "ny", true},
+		{"camel", "nyagos.go", "ny.g", true},
+		{"camel", "nyagos.go", "nyg", true},
+		{"camel", "nyagos.go", "ago", false},
+		{"camel", "getName", "gN", true},
+		{"camel", "getName", "gn", true},
+		{"camel", "getName", "gA", false},
+		{"fuzzy", "nyagos.go", "ngg", true},
+		{"fuzzy", "nyagos.go", "gn", false},
+	}
+	for _, test := range tests {
+		if _, ok := Matchers[test.mode](test.name, test.word); ok != test.expect {
+			t.Errorf("%s(%q,%q) = %v, expected %v", test.mode, test.name, test.word, ok, test.expect)
+		}
+	}
+
+	var r ranking
+	for _, name := range []string{"legacy.go", "go.mod", "cgo", "gopher"} {
+		if score, ok := matchSubstring(name, "go"); ok {
+			r.add(Element1(name), score)
+		}
+	}
+	if result := toComplete(r.sorted()); fmt.Sprint(result) != "[go.mod gopher cgo legacy.go]" {
+		t.Errorf("ranking: %v", result)
+	}
+}
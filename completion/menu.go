@@ -0,0 +1,62 @@
+package completion
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/zetamatta/nyagos/readline"
+)
+
+// UseMenu is the switch to select the candidate in the menu
+// with the second Tab.
+var UseMenu = true
+
+// listedLine and listedCursor are the line and the cursor position
+// whose candidates the last Tab listed.
+var (
+	listedLine   string
+	listedCursor = -1
+)
+
+func unquote(word string) string {
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(readline.Delimiters, c) {
+			return -1
+		}
+		return c
+	}, word)
+}
+
+// menuItems returns the items of the menu for the candidates matching word.
+func menuItems(list []Element, word string, delimiter byte, slashToBackSlash bool) []readline.MenuItem {
+	quoted := strings.ContainsAny(word, readline.Delimiters)
+	word = unquote(word)
+	items := []readline.MenuItem{}
+	for _, element := range list {
+		value := element.String()
+		if !matchWord(value, word) {
+			continue
+		}
+		if quoted || strings.ContainsAny(value, " &!") {
+			value = quote(value, delimiter, !endWithRoot(value))
+		}
+		if slashToBackSlash {
+			value = filepath.FromSlash(value)
+		}
+		display := element.Display()
+		if d := descriptionOf(element); d != "" {
+			display += " (" + d + ")"
+		}
+		items = append(items, readline.MenuItem{Value: value, Display: display})
+	}
+	return items
+}
+
+// selectMenu replaces the word with the candidate selected in the menu.
+func selectMenu(this *readline.Buffer, comp *List, delimiter byte, slashToBackSlash bool) {
+	this.SelectMenu(comp.Pos,
+		menuItems(comp.List, comp.RawWord, delimiter, slashToBackSlash),
+		func(word string) []readline.MenuItem {
+			return menuItems(comp.List, word, delimiter, slashToBackSlash)
+		})
+}
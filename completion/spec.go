@@ -0,0 +1,342 @@
+package completion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The kinds of Source
+const (
+	SourceFiles   = iota // the files and the directories
+	SourceDirs           // the directories only
+	SourceEnv            // the names of the environment variables
+	SourceList           // the words of Source.Words
+	SourceCommand        // the lines of the output of Source.Command
+	SourceFunc           // the words returned by Source.Func
+)
+
+// Source is where the values of a flag or an argument come from.
+type Source struct {
+	Kind    int
+	Words   []string
+	Command string
+	Func    func(ctx context.Context) ([]string, error)
+}
+
+// Flag is an option of the command.
+type Flag struct {
+	Name        string  // such as "-v" or "--verbose"
+	Description string  // shown in the list of the candidates
+	Value       *Source // the value following the flag. nil means no value.
+}
+
+// Spec tells how to complete the arguments of the command.
+type Spec struct {
+	Description string // shown when the command is a subcommand
+	Flags       []*Flag
+	Subcommands map[string]*Spec
+	Args        []*Source // the sources for each position. The last one repeats.
+}
+
+// specs are the Spec for the command-names in lower case without the suffix.
+var specs = map[string]*Spec{}
+
+// specName returns the name of the command to find the spec.
+func specName(name string) string {
+	name = strings.ToLower(filepath.Base(strings.Replace(name, `"`, "", -1)))
+	if ext := filepath.Ext(name); isExecutable(name) {
+		name = name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+// SetSpec registers the spec for the command. nil removes it.
+func SetSpec(name string, spec *Spec) {
+	if spec == nil {
+		delete(specs, specName(name))
+	} else {
+		specs[specName(name)] = spec
+	}
+}
+
+// GetSpec returns the spec for the command or nil.
+func GetSpec(name string) *Spec {
+	return specs[specName(name)]
+}
+
+// SpecNames returns the names of the commands which have the spec.
+func SpecNames() []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Subcommand returns the subcommand and creates it when it does not exist.
+func (spec *Spec) Subcommand(name string) *Spec {
+	if spec.Subcommands == nil {
+		spec.Subcommands = map[string]*Spec{}
+	}
+	sub, ok := spec.Subcommands[name]
+	if !ok {
+		sub = &Spec{}
+		spec.Subcommands[name] = sub
+	}
+	return sub
+}
+
+// flag returns the flag of the argument such as "--name" or "--name=value".
+func (spec *Spec) flag(arg string) *Flag {
+	if i := strings.IndexByte(arg, '='); i > 0 {
+		arg = arg[:i]
+	}
+	for _, f := range spec.Flags {
+		if f.Name == arg {
+			return f
+		}
+	}
+	return nil
+}
+
+// ParseSource converts the text such as "files", "dirs", "env",
+// "list:WORD1 WORD2..." and "command:COMMAND-LINE" to Source.
+func ParseSource(text string) (*Source, error) {
+	kind := text
+	param := ""
+	if i := strings.IndexByte(text, ':'); i >= 0 {
+		kind = text[:i]
+		param = text[i+1:]
+	}
+	switch strings.ToLower(kind) {
+	case "files":
+		return &Source{Kind: SourceFiles}, nil
+	case "dirs":
+		return &Source{Kind: SourceDirs}, nil
+	case "env":
+		return &Source{Kind: SourceEnv}, nil
+	case "list":
+		return &Source{Kind: SourceList, Words: strings.Fields(param)}, nil
+	case "command":
+		return &Source{Kind: SourceCommand, Command: param}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown source", text)
+}
+
+// String returns the text for ParseSource.
+func (s *Source) String() string {
+	switch s.Kind {
+	case SourceDirs:
+		return "dirs"
+	case SourceEnv:
+		return "env"
+	case SourceList:
+		return "list:" + strings.Join(s.Words, " ")
+	case SourceCommand:
+		return "command:" + s.Command
+	case SourceFunc:
+		return "function"
+	}
+	return "files"
+}
+
+// CommandCacheTime is how long the output of the command of SourceCommand is reused.
+var CommandCacheTime = 10 * time.Second
+
+// CommandTimeout is how long the command of SourceCommand can run.
+var CommandTimeout = 5 * time.Second
+
+type commandOutput struct {
+	lines []string
+	time  time.Time
+}
+
+var commandCache = map[string]*commandOutput{}
+
+// runCommand returns the lines of the output of the command-line run by CMD.EXE.
+// The output is cached for CommandCacheTime.
+func runCommand(ctx context.Context, cmdline string) ([]string, error) {
+	if c, ok := commandCache[cmdline]; ok && time.Since(c.time) < CommandCacheTime {
+		return c.lines, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	comspec := os.Getenv("COMSPEC")
+	if comspec == "" {
+		comspec = "cmd.exe"
+	}
+	xcmd := exec.CommandContext(ctx, comspec, "/c", cmdline)
+	xcmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`%s /S /C "%s"`, comspec, cmdline),
+	}
+	output, err := xcmd.Output()
+	lines := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err == nil {
+		commandCache[cmdline] = &commandOutput{lines: lines, time: time.Now()}
+	}
+	return lines, err
+}
+
+// filterWords returns the words matching word in the order of the scores.
+func filterWords(words []string, word string) []Element {
+	var list ranking
+	match := matcher()
+	for _, w := range words {
+		if score, ok := match(w, word); ok {
+			list.add(Element1(w), score)
+		}
+	}
+	return list.sorted()
+}
+
+// listUp returns the values starting with word.
+func (s *Source) listUp(ctx context.Context, word string) ([]Element, error) {
+	switch s.Kind {
+	case SourceDirs:
+		files, err := listUpFiles(ctx, word)
+		list := make([]Element, 0, len(files))
+		for _, f := range files {
+			if endWithRoot(f.String()) {
+				list = append(list, f)
+			}
+		}
+		return list, err
+	case SourceEnv:
+		var list ranking
+		match := matcher()
+		for _, vars := range PercentVariables {
+			vars.EachKey(func(name string) {
+				if score, ok := match(name, word); ok {
+					list.add(Candidate{Text: name, Kind: KindEnv}, score)
+				}
+			})
+		}
+		return list.sorted(), nil
+	case SourceList:
+		return filterWords(s.Words, word), nil
+	case SourceCommand:
+		words, err := runCommand(ctx, s.Command)
+		return filterWords(words, word), err
+	case SourceFunc:
+		words, err := s.Func(ctx)
+		return filterWords(words, word), err
+	}
+	return listUpFiles(ctx, word)
+}
+
+// listUp returns the candidates of word after args following the command.
+func (spec *Spec) listUp(ctx context.Context, args []string, word string) ([]Element, error) {
+	var value *Source
+	position := 0
+	for _, arg := range args {
+		arg = strings.Replace(arg, `"`, "", -1)
+		if value != nil {
+			value = nil
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			if f := spec.flag(arg); f != nil && !strings.ContainsRune(arg, '=') {
+				value = f.Value
+			}
+			continue
+		}
+		if position == 0 {
+			if sub, ok := spec.Subcommands[arg]; ok {
+				spec = sub
+				continue
+			}
+		}
+		position++
+	}
+	// the part until the last `=` or `;` is kept by listUpComplete.
+	rest := word[strings.LastIndexAny(word, ";=")+1:]
+	if value != nil {
+		return value.listUp(ctx, rest)
+	}
+	if strings.HasPrefix(word, "-") {
+		if strings.ContainsRune(word, '=') {
+			if f := spec.flag(word); f != nil && f.Value != nil {
+				return f.Value.listUp(ctx, rest)
+			}
+		}
+		if len(spec.Flags) > 0 {
+			var list ranking
+			match := matcher()
+			for _, f := range spec.Flags {
+				if score, ok := match(f.Name, word); ok {
+					list.add(Candidate{Text: f.Name, Kind: KindOption, Description: f.Description}, score)
+				}
+			}
+			return list.sorted(), nil
+		}
+	}
+	if position == 0 && len(spec.Subcommands) > 0 {
+		var list ranking
+		match := matcher()
+		for _, name := range sortedKeys(spec.Subcommands) {
+			if score, ok := match(name, word); ok {
+				list.add(Candidate{Text: name, Description: spec.Subcommands[name].Description}, score)
+			}
+		}
+		return list.sorted(), nil
+	}
+	if len(spec.Args) <= 0 {
+		return listUpFiles(ctx, rest)
+	}
+	if position >= len(spec.Args) {
+		position = len(spec.Args) - 1
+	}
+	return spec.Args[position].listUp(ctx, rest)
+}
+
+func sortedKeys(m map[string]*Spec) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// listUpArgs sets the candidates of rv.Word with the spec of the command
+// or its `__complete` (Cobra). ok is false when the command has neither.
+func listUpArgs(ctx context.Context, rv *List) (ok bool, err error) {
+	fields := rv.Field
+	for i, f := range fields {
+		if isSeparator(f) {
+			fields = rv.Field[i+1:]
+		}
+	}
+	if !strings.HasSuffix(rv.Left, " ") && len(fields) > 0 {
+		// without the word being completed
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) < 1 {
+		return false, nil
+	}
+	if spec := GetSpec(fields[0]); spec != nil {
+		rv.List, err = spec.listUp(ctx, fields[1:], rv.Word)
+		return true, err
+	}
+	if UseCobra {
+		return listUpCobra(ctx, fields, rv)
+	}
+	return false, nil
+}
@@ -0,0 +1,149 @@
+package completion
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpec(t *testing.T) {
+	SetSpec("git", &Spec{
+		Flags: []*Flag{
+			{Name: "--version", Description: "print the version"},
+			{Name: "-c", Value: &Source{Kind: SourceList, Words: []string{"user.name", "user.email"}}},
+		},
+		Subcommands: map[string]*Spec{
+			"checkout": {
+				Description: "switch branches",
+				Args:        []*Source{{Kind: SourceList, Words: []string{"master", "develop"}}},
+			},
+			"commit": {
+				Flags: []*Flag{{Name: "--amend"}, {Name: "--message"}},
+			},
+		},
+	})
+	defer SetSpec("git", nil)
+	UseCobra = false
+	defer func() { UseCobra = true }()
+
+	tests := []struct {
+		left   string
+		word   string
+		expect string
+	}{
+		{"git ", "", "checkout commit"},
+		{"git c", "c", "checkout commit"},
+		{"git -", "-", "--version -c"},
+		{"git -c u", "u", "user.name user.email"},
+		{"git -c user.name=x ch", "ch", "checkout"},
+		{"git checkout ", "", "master develop"},
+		{"git checkout master d", "d", "develop"},
+		{"git commit --a", "--a", "--amend"},
+		{"GIT.EXE Co", "Co", "commit"},
+		{"echo|git checkout m", "m", ""},
+		{"echo | git checkout m", "m", "master"},
+		{"a && gi", "gi", ""},
+		{"a || gi", "gi", ""},
+		{"a |& gi", "gi", ""},
+		{"a && git checkout m", "m", "master"},
+		{"a || git ", "", "checkout commit"},
+	}
+	for _, test := range tests {
+		rv := &List{Field: strings.Fields(test.left), Left: test.left, Word: test.word}
+		ok, err := listUpArgs(context.Background(), rv)
+		if err != nil {
+			t.Fatalf("%q: %s", test.left, err.Error())
+		}
+		result := strings.Join(toComplete(rv.List), " ")
+		if !ok && test.expect == "" {
+			continue
+		}
+		if result != test.expect {
+			t.Fatalf("%q: %q != %q", test.left, result, test.expect)
+		}
+	}
+	if GetSpec("git.exe") == nil || GetSpec("Git") == nil {
+		t.Fatal("GetSpec does not ignore the case and the suffix")
+	}
+
+	MatchMode = "substring"
+	defer func() { MatchMode = "prefix" }()
+	for left, expect := range map[string]string{
+		"git mit":          "commit",
+		"git checkout vel": "develop",
+		"git -c mail":      "user.email",
+	} {
+		fields := strings.Fields(left)
+		rv := &List{Field: fields, Left: left, Word: fields[len(fields)-1]}
+		if _, err := listUpArgs(context.Background(), rv); err != nil {
+			t.Fatalf("%q: %s", left, err.Error())
+		}
+		if result := strings.Join(toComplete(rv.List), " "); result != expect {
+			t.Fatalf("%q: %q != %q", left, result, expect)
+		}
+	}
+}
+
+func TestRunCommandCache(t *testing.T) {
+	const cmdline = "nyagos-test-not-found"
+	commandCache[cmdline] = &commandOutput{lines: []string{"cached"}, time: time.Now()}
+	defer delete(commandCache, cmdline)
+	lines, err := runCommand(context.Background(), cmdline)
+	if err != nil || strings.Join(lines, " ") != "cached" {
+		t.Fatalf("%q,%v", lines, err)
+	}
+}
+
+func TestParseCobra(t *testing.T) {
+	output := "pods\tlist the pods\r\nservices\r\n_activeHelp_ hint\r\n:6\r\n"
+	r := parseCobra(strings.NewReader(output))
+	if strings.Join(r.values, ",") != "pods,services" ||
+		strings.Join(r.descriptions, ",") != "list the pods," {
+		t.Fatalf("%q %q", r.values, r.descriptions)
+	}
+	if r.directive != cobraNoSpace|cobraNoFileComp {
+		t.Fatalf("directive %d", r.directive)
+	}
+}
+
+func TestFindSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobra")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.exe")
+	for _, size := range []int{0, 1<<16 - 5, 1 << 16} {
+		for _, protocol := range []int{protocolCobra, protocolClap} {
+			data := append(bytes.Repeat([]byte{0}, size), protocolSignatures[protocol]...)
+			if err := ioutil.WriteFile(path, data, 0666); err != nil {
+				t.Fatal(err.Error())
+			}
+			if result := findSignature(path); result != protocol {
+				t.Fatalf("%d: %d != %d", size, result, protocol)
+			}
+		}
+	}
+	if findSignature(filepath.Join(dir, "none.exe")) != protocolNone {
+		t.Fatal("found in the file not existing")
+	}
+	defer func(limit int64) { signatureScanLimit = limit }(signatureScanLimit)
+	signatureScanLimit = 1 << 16
+	if findSignature(path) != protocolNone {
+		t.Fatal("found over signatureScanLimit")
+	}
+}
+
+func TestParseClap(t *testing.T) {
+	output := "build\tCompile the package\r\n--release\r\n\r\n"
+	r := parseClap(strings.NewReader(output))
+	if strings.Join(r.values, ",") != "build,--release" ||
+		strings.Join(r.descriptions, ",") != "Compile the package," {
+		t.Fatalf("%q %q", r.values, r.descriptions)
+	}
+}
@@ -17,6 +17,14 @@ import (
 	"github.com/zetamatta/nyagos/texts"
 )
 
+// ExitStatus is returned by the option `-c` when the command fails.
+// The process exits with it as the exit code.
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
 // OptionNorc is true, then rcfiles are not executed.
 var OptionNorc = false
 
@@ -83,13 +91,15 @@ var optionMap = map[string]optionT{
 		},
 	},
 	"-c": {
-		U: "\"COMMAND\"\nExecute `COMMAND` and quit.",
+		U: "\"COMMAND\"\nExecute `COMMAND` and quit with its errorlevel.",
 		V: func(p *optionArg) (func(context.Context) error, error) {
 			if len(p.args) <= 0 {
 				return nil, errors.New("-c: requires parameters")
 			}
 			return func(ctx context.Context) error {
-				p.sh.Interpret(ctx, p.args[0])
+				if errorlevel, _ := p.sh.Interpret(ctx, p.args[0]); errorlevel != 0 {
+					return ExitStatus(errorlevel)
+				}
 				return io.EOF
 			}, nil
 		},
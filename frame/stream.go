@@ -7,9 +7,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mattn/go-colorable"
 
+	"github.com/zetamatta/nyagos/commands"
 	"github.com/zetamatta/nyagos/dos"
 	"github.com/zetamatta/nyagos/history"
 	"github.com/zetamatta/nyagos/readline"
@@ -22,6 +24,8 @@ type CmdStreamConsole struct {
 	History  *history.Container
 	Editor   *readline.Editor
 	HistPath string
+	// pending is the rest of the lines typed in the multi-line mode.
+	pending []string
 }
 
 var console io.Writer
@@ -49,7 +53,16 @@ func NewCmdStreamConsole(doPrompt func() (int, error)) *CmdStreamConsole {
 		Editor: &readline.Editor{
 			History: history1,
 			Prompt:  doPrompt,
-			Writer:  bufio.NewWriter(GetConsole())},
+			Writer:  bufio.NewWriter(GetConsole()),
+			IsIncomplete: func(text string) bool {
+				lines, incomplete := shell.SplitLines(text)
+				return incomplete || commands.OpenBlocks(lines) > 0
+			},
+			Suggest: func(text string) string {
+				wd, _ := os.Getwd()
+				return history1.Suggest(text, wd)
+			},
+		},
 		HistPath: filepath.Join(AppDataDir(), "nyagos.history"),
 		CmdSeeker: shell.CmdSeeker{
 			PlainHistory: []string{},
@@ -69,9 +82,16 @@ func (this *CmdStreamConsole) ReadLine(ctx context.Context) (context.Context, st
 		}
 		this.Pointer = -1
 	}
+	if len(this.pending) > 0 {
+		line := this.pending[0]
+		this.pending = this.pending[1:]
+		this.PlainHistory = append(this.PlainHistory, line)
+		return ctx, line, nil
+	}
 	var line string
 	var err error
 	for {
+		shell.ReportDoneJobs(os.Stdout)
 		line, err = this.Editor.ReadLine(ctx)
 		if err != nil {
 			return ctx, line, err
@@ -97,6 +117,12 @@ func (this *CmdStreamConsole) ReadLine(ctx context.Context) (context.Context, st
 	} else {
 		fmt.Fprintln(os.Stderr, err.Error())
 	}
+	if strings.ContainsRune(line, '\n') {
+		// the block typed in the multi-line mode is one history entry.
+		lines, _ := shell.SplitLines(line)
+		line = lines[0]
+		this.pending = lines[1:]
+	}
 	this.PlainHistory = append(this.PlainHistory, line)
 	return ctx, line, err
 }
@@ -79,6 +79,35 @@ func CmdBox(this *Param) []any_t {
 	return []any_t{box.Choice(sources, this.Term)}
 }
 
+func CmdFuzzy(this *Param) []any_t {
+	args := this.Args
+	if len(args) < 1 {
+		return []any_t{nil, TooFewArguments}
+	}
+	t, ok := args[0].(map[any_t]any_t)
+	if !ok {
+		return []any_t{nil, "Not a table"}
+	}
+	sources := make([]string, 0, len(t))
+	for i, i_ := 1, len(t); i <= i_; i++ {
+		if val, ok := t[i]; ok {
+			sources = append(sources, fmt.Sprint(val))
+		}
+	}
+	finder := &readline.FuzzyFinder{
+		Writer: bufio.NewWriter(this.Term),
+		Prompt: "> ",
+	}
+	if len(args) >= 2 {
+		finder.Prompt = fmt.Sprint(args[1])
+	}
+	result, ok := finder.Select(sources)
+	if !ok {
+		return []any_t{nil}
+	}
+	return []any_t{result}
+}
+
 func CmdResetCharWidth(args []any_t) []any_t {
 	readline.ResetCharWidth()
 	return []any_t{}
@@ -225,6 +254,7 @@ func CmdSetEnv(args []any_t) []any_t {
 	} else {
 		os.Unsetenv(name)
 	}
+	completion.EnvChanged(name)
 	return []any_t{true}
 }
 
@@ -461,6 +491,9 @@ func GetOption(args []any_t) []any_t {
 		return []any_t{nil, "too few arguments"}
 	}
 	key := fmt.Sprint(args[1])
+	if ptr, ok := commands.StringOptions[key]; ok {
+		return []any_t{*ptr.V}
+	}
 	ptr, ok := commands.BoolOptions[key]
 	if !ok {
 		return []any_t{nil, fmt.Sprintf("key: %s: not found", key)}
@@ -473,6 +506,12 @@ func SetOption(args []any_t) []any_t {
 		return []any_t{nil, "too few arguments"}
 	}
 	key := fmt.Sprint(args[1])
+	if _, ok := commands.StringOptions[key]; ok {
+		if err := commands.SetStringOption(key, fmt.Sprint(args[2])); err != nil {
+			return []any_t{nil, err.Error()}
+		}
+		return []any_t{true}
+	}
 	ptr, ok := commands.BoolOptions[key]
 	if !ok || ptr == nil {
 		return []any_t{nil, "key: %s: not found"}
@@ -18,6 +18,9 @@ func setTitle(w io.Writer, s string) {
 	fmt.Fprintf(w, "\x1B]0;%s\007", s)
 }
 
+// PromptRows is the number of the newlines in the prompt printed last by PromptCore.
+var PromptRows = 0
+
 // Prompt is the body of the lua-function `nyagos.default_prompt`
 func Prompt(param *Param) []interface{} {
 	return []interface{}{PromptCore(param.Term, param.Args...)}
@@ -49,6 +52,7 @@ func PromptCore(console io.Writer, args ...interface{}) int {
 	text := frame.Format2Prompt(template)
 
 	io.WriteString(console, text)
+	PromptRows = strings.Count(text, "\n")
 
 	text = rxAnsiEscCode.ReplaceAllString(text, "")
 	lfPos := strings.LastIndex(text, "\n")
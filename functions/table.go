@@ -29,6 +29,7 @@ var Table = map[string]func([]interface{}) []interface{}{
 
 var Table2 = map[string]func(*Param) []interface{}{
 	"box":            CmdBox,
+	"fuzzy":          CmdFuzzy,
 	"raweval":        CmdRawEval,
 	"rawexec":        CmdRawExec,
 	"write":          CmdWrite,
@@ -308,7 +308,7 @@ func (hisObj *Container) LoadViaReader(reader io.Reader) {
 				}
 			}
 			hisObj.PushLine(Line{
-				Text:  p[0],
+				Text:  strings.Replace(p[0], newlineMark, "\n", -1),
 				Dir:   dir,
 				Stamp: stamp,
 				Pid:   pid})
@@ -103,3 +103,41 @@ cccc`
 // 		t.Fail()
 // 	}
 // }
+
+func TestMultiLineEntry(t *testing.T) {
+	var src Container
+	src.PushLine(NewHistoryLine("if a == a\n  echo yes\nend"))
+	var buffer strings.Builder
+	src.SaveViaWriter(&buffer)
+	if strings.Count(buffer.String(), "\n") != 1 {
+		t.Fatalf("one entry must be one line: %q", buffer.String())
+	}
+	var dst Container
+	dst.LoadViaReader(strings.NewReader(buffer.String()))
+	if dst.Len() != 1 || dst.At(0) != src.At(0) {
+		t.Fatalf("%q != %q", dst.At(0), src.At(0))
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	var c Container
+	c.PushLine(Line{Text: "git status", Dir: `C:\a`})
+	c.PushLine(Line{Text: "git stash", Dir: `C:\b`})
+	c.PushLine(Line{Text: "go build", Dir: `C:\a`})
+	tests := []struct {
+		prefix string
+		dir    string
+		expect string
+	}{
+		{"git st", `C:\a`, "git status"},
+		{"git st", `c:\B`, "git stash"},
+		{"git st", `C:\c`, "git stash"},
+		{"go build", `C:\a`, ""},
+		{"", `C:\a`, ""},
+	}
+	for _, test := range tests {
+		if s := c.Suggest(test.prefix, test.dir); s != test.expect {
+			t.Fatalf("Suggest(%q,%q): %q != %q", test.prefix, test.dir, s, test.expect)
+		}
+	}
+}
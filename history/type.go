@@ -3,6 +3,7 @@ package history
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -47,10 +48,36 @@ func (c *Container) PushLine(row Line) {
 	c.rows = append(c.rows, row)
 }
 
+// Suggest returns the newest history which starts with prefix and is
+// longer than it. The one run in the directory dir is preferred.
+func (c *Container) Suggest(prefix, dir string) string {
+	if prefix == "" {
+		return ""
+	}
+	other := ""
+	for i := len(c.rows) - 1; i >= 0; i-- {
+		row := &c.rows[i]
+		if len(row.Text) <= len(prefix) || !strings.HasPrefix(row.Text, prefix) {
+			continue
+		}
+		if dir == "" || strings.EqualFold(row.Dir, dir) {
+			return row.Text
+		}
+		if other == "" {
+			other = row.Text
+		}
+	}
+	return other
+}
+
+// newlineMark is the character for the newline of the text typed in the
+// multi-line mode. It is used in the history file of one entry per line.
+const newlineMark = "\x1E"
+
 // String returns self as printable text
 func (row *Line) String() string {
 	return fmt.Sprintf("%s\t%s\t%s\t%d",
-		row.Text,
+		strings.Replace(row.Text, "\n", newlineMark, -1),
 		row.Dir,
 		row.Stamp.Format("2006-01-02 15:04:05"),
 		row.Pid)
@@ -17,6 +17,9 @@ func main() {
 	frame.Version = version
 
 	if err := frame.Start(mains.Main); err != nil && err != io.EOF {
+		if status, ok := err.(frame.ExitStatus); ok {
+			os.Exit(int(status))
+		}
 		fmt.Fprintln(os.Stderr, err.Error())
 		if defined.DBG {
 			os.Stdin.Read(dummy[:])
@@ -0,0 +1,116 @@
+package mains
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// asyncResult is the output of the command run by nyagos.async_eval.
+type asyncResult struct {
+	output string
+	done   bool
+}
+
+var (
+	asyncMutex   sync.Mutex
+	asyncResults = map[string]*asyncResult{} // the commands run for the current prompt
+	asyncLast    = map[string]string{}       // the outputs for the previous prompts
+
+	// asyncRedraw draws the prompt again when a command has finished.
+	asyncRedraw func()
+)
+
+// resetAsync forgets the commands run for the previous prompt,
+// so that they run again for the new prompt.
+func resetAsync() {
+	asyncMutex.Lock()
+	defer asyncMutex.Unlock()
+	for key, r := range asyncResults {
+		if r.done {
+			asyncLast[key] = r.output
+		}
+	}
+	asyncResults = map[string]*asyncResult{}
+}
+
+// newAsyncCommand makes the command for the argument of nyagos.async_eval:
+// the table of the executable and the parameters, or the command-line for CMD.EXE.
+func newAsyncCommand(L Lua) (string, func() *exec.Cmd, bool) {
+	if table, ok := L.Get(1).(*lua.LTable); ok {
+		n := table.Len()
+		if n <= 0 {
+			return "", nil, false
+		}
+		args := make([]string, n)
+		for i := 0; i < n; i++ {
+			args[i] = L.GetTable(table, lua.LNumber(i+1)).String()
+		}
+		return strings.Join(args, "\t"), func() *exec.Cmd {
+			return exec.Command(args[0], args[1:]...)
+		}, true
+	}
+	if statement, ok := L.Get(1).(lua.LString); ok {
+		cmdline := string(statement)
+		return cmdline, func() *exec.Cmd {
+			comspec := os.Getenv("COMSPEC")
+			if comspec == "" {
+				comspec = "cmd.exe"
+			}
+			xcmd := exec.Command(comspec, "/c", cmdline)
+			xcmd.SysProcAttr = &syscall.SysProcAttr{
+				CmdLine: fmt.Sprintf(`%s /S /C "%s"`, comspec, cmdline),
+			}
+			return xcmd
+		}, true
+	}
+	return "", nil, false
+}
+
+// cmdAsyncEval is nyagos.async_eval(COMMAND), which runs COMMAND in the
+// background once for each prompt. It returns the output and true after the
+// command has finished. Until then, it returns the output for the previous
+// prompt (or nil) and false, and the prompt is drawn again when it finishes.
+func cmdAsyncEval(L Lua) int {
+	key, newCommand, ok := newAsyncCommand(L)
+	if !ok {
+		return lerror(L, "nyagos.async_eval: the 1st argument is neither a string nor a table")
+	}
+	asyncMutex.Lock()
+	defer asyncMutex.Unlock()
+
+	r, ok := asyncResults[key]
+	if ok && r.done {
+		L.Push(lua.LString(r.output))
+		L.Push(lua.LTrue)
+		return 2
+	}
+	if !ok {
+		r = &asyncResult{}
+		asyncResults[key] = r
+		go func(xcmd *exec.Cmd) {
+			output, _ := xcmd.Output()
+			asyncMutex.Lock()
+			r.output = string(bytes.Trim(output, "\r\n\t "))
+			r.done = true
+			current := asyncResults[key] == r
+			asyncMutex.Unlock()
+			if current && asyncRedraw != nil {
+				asyncRedraw()
+			}
+		}(newCommand())
+	}
+	if last, ok := asyncLast[key]; ok {
+		L.Push(lua.LString(last))
+	} else {
+		L.Push(lua.LNil)
+	}
+	L.Push(lua.LFalse)
+	return 2
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/yuin/gopher-lua"
@@ -29,9 +30,15 @@ func luaHookForComplete(ctx context.Context, this *readline.Buffer, rv *completi
 
 	list := L.NewTable()
 	shownlist := L.NewTable()
+	kinds := L.NewTable()
+	descriptions := L.NewTable()
 	for i, v := range rv.List {
 		L.SetTable(list, lua.LNumber(i+1), lua.LString(v.String()))
 		L.SetTable(shownlist, lua.LNumber(i+1), lua.LString(v.Display()))
+		if c, ok := v.(completion.Candidate); ok {
+			L.SetTable(kinds, lua.LNumber(i+1), lua.LString(completion.KindName(c.Kind)))
+			L.SetTable(descriptions, lua.LNumber(i+1), lua.LString(c.Description))
+		}
 	}
 	tbl := L.NewTable()
 	L.SetField(tbl, "rawword", lua.LString(rv.RawWord))
@@ -40,6 +47,8 @@ func luaHookForComplete(ctx context.Context, this *readline.Buffer, rv *completi
 	L.SetField(tbl, "word", lua.LString(rv.Word))
 	L.SetField(tbl, "list", list)
 	L.SetField(tbl, "shownlist", shownlist)
+	L.SetField(tbl, "kind", kinds)
+	L.SetField(tbl, "description", descriptions)
 	field := L.NewTable()
 	for key, val := range rv.Field {
 		L.SetTable(field, lua.LNumber(key+1), lua.LString(val))
@@ -79,8 +88,21 @@ func luaHookForComplete(ctx context.Context, this *readline.Buffer, rv *completi
 				if !ok {
 					listupStr = str
 				}
-				newList = append(newList, completion.Element2{
-					string(str), string(listupStr)})
+				candidate := completion.Candidate{
+					Text:  string(str),
+					Shown: string(listupStr),
+				}
+				if kinds, ok := L.GetField(tbl, "kind").(*lua.LTable); ok {
+					if kind, ok := L.GetTable(kinds, key).(lua.LString); ok {
+						candidate.Kind = completion.ParseKind(string(kind))
+					}
+				}
+				if descriptions, ok := L.GetField(tbl, "description").(*lua.LTable); ok {
+					if description, ok := L.GetTable(descriptions, key).(lua.LString); ok {
+						candidate.Description = string(description)
+					}
+				}
+				newList = append(newList, candidate)
 			}
 		}
 	})
@@ -89,3 +111,126 @@ func luaHookForComplete(ctx context.Context, this *readline.Buffer, rv *completi
 	}
 	return rv, nil
 }
+
+// luaSource converts the value of nyagos.complete_for to completion.Source:
+// the string for completion.ParseSource, the table of the words or
+// the function returning them.
+func luaSource(L Lua, value lua.LValue) (*completion.Source, error) {
+	switch v := value.(type) {
+	case lua.LString:
+		return completion.ParseSource(string(v))
+	case *lua.LTable:
+		words := []string{}
+		L.ForEach(v, func(_, val lua.LValue) {
+			words = append(words, val.String())
+		})
+		return &completion.Source{Kind: completion.SourceList, Words: words}, nil
+	case *lua.LFunction:
+		return &completion.Source{
+			Kind: completion.SourceFunc,
+			Func: func(ctx context.Context) ([]string, error) {
+				L, ok := ctx.Value(luaKey).(Lua)
+				if !ok {
+					return nil, errors.New("nyagos.complete_for: could not get lua instance")
+				}
+				defer setContext(L, getContext(L))
+				setContext(L, ctx)
+
+				L.Push(v)
+				if err := L.PCall(0, 1, nil); err != nil {
+					return nil, err
+				}
+				defer L.Pop(1)
+				words := []string{}
+				if table, ok := L.Get(-1).(*lua.LTable); ok {
+					L.ForEach(table, func(_, val lua.LValue) {
+						words = append(words, val.String())
+					})
+				}
+				return words, nil
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("%s: not a source", value.String())
+}
+
+// luaSpec converts the table of nyagos.complete_for to completion.Spec.
+func luaSpec(L Lua, table *lua.LTable) (*completion.Spec, error) {
+	var err error
+	spec := &completion.Spec{}
+	if s, ok := L.GetField(table, "description").(lua.LString); ok {
+		spec.Description = string(s)
+	}
+	if flags, ok := L.GetField(table, "flags").(*lua.LTable); ok {
+		L.ForEach(flags, func(key, val lua.LValue) {
+			flag := &completion.Flag{}
+			if _, ok := key.(lua.LNumber); ok {
+				flag.Name = val.String()
+			} else if t, ok := val.(*lua.LTable); ok {
+				flag.Name = key.String()
+				if s, ok := L.GetField(t, "description").(lua.LString); ok {
+					flag.Description = string(s)
+				}
+				if v := L.GetField(t, "value"); v != lua.LNil && err == nil {
+					flag.Value, err = luaSource(L, v)
+				}
+			} else {
+				flag.Name = key.String()
+				flag.Description = val.String()
+			}
+			spec.Flags = append(spec.Flags, flag)
+		})
+		sort.Slice(spec.Flags, func(i, j int) bool {
+			return spec.Flags[i].Name < spec.Flags[j].Name
+		})
+	}
+	if subcommands, ok := L.GetField(table, "subcommands").(*lua.LTable); ok {
+		L.ForEach(subcommands, func(key, val lua.LValue) {
+			if _, ok := key.(lua.LNumber); ok {
+				spec.Subcommand(val.String())
+			} else if t, ok := val.(*lua.LTable); ok {
+				if sub, err1 := luaSpec(L, t); err1 != nil {
+					err = err1
+				} else {
+					*spec.Subcommand(key.String()) = *sub
+				}
+			} else {
+				spec.Subcommand(key.String()).Description = val.String()
+			}
+		})
+	}
+	if args, ok := L.GetField(table, "args").(*lua.LTable); ok {
+		for i := 1; i <= args.Len() && err == nil; i++ {
+			var source *completion.Source
+			source, err = luaSource(L, L.GetTable(args, lua.LNumber(i)))
+			spec.Args = append(spec.Args, source)
+		}
+	}
+	return spec, err
+}
+
+// cmdCompleteFor is nyagos.complete_for(NAME,SPEC), which registers
+// the specification to complete the arguments of the command NAME.
+// SPEC=nil removes it.
+func cmdCompleteFor(L Lua) int {
+	name, ok := L.Get(1).(lua.LString)
+	if !ok {
+		return lerror(L, "nyagos.complete_for: the 1st argument is not a string")
+	}
+	if L.Get(2) == lua.LNil {
+		completion.SetSpec(string(name), nil)
+		L.Push(lua.LTrue)
+		return 1
+	}
+	table, ok := L.Get(2).(*lua.LTable)
+	if !ok {
+		return lerror(L, "nyagos.complete_for: the 2nd argument is not a table")
+	}
+	spec, err := luaSpec(L, table)
+	if err != nil {
+		return lerror(L, "nyagos.complete_for: "+err.Error())
+	}
+	completion.SetSpec(string(name), spec)
+	L.Push(lua.LTrue)
+	return 1
+}
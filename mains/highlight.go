@@ -0,0 +1,84 @@
+package mains
+
+import (
+	"strings"
+
+	"github.com/zetamatta/nyagos/alias"
+	"github.com/zetamatta/nyagos/commands"
+	"github.com/zetamatta/nyagos/completion"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// The colours of the command-line with `set -o highlight`.
+// They are the parameters of SGR such as "1;32" and set by
+// nyagos.highlight_XXXX . "" means the default colour.
+var (
+	highlightAlias    = "1;36"
+	highlightBuiltIn  = "1;33"
+	highlightCommand  = "1;32"
+	highlightNotFound = "1;31"
+	highlightQuote    = "33"
+	highlightVariable = "35"
+	highlightRedirect = "1;34"
+	highlightOperator = "1;35"
+	highlightError    = "31"
+)
+
+// commandColor returns the colour of the command-name by where it is found.
+func commandColor(name string) string {
+	name = strings.Replace(name, `"`, "", -1)
+	if name == "" || strings.ContainsAny(name, "%$`") {
+		// it can not be resolved before the expansion.
+		return ""
+	}
+	if _, ok := alias.Table[strings.ToLower(name)]; ok {
+		return highlightAlias
+	}
+	if commands.IsBuiltIn(name) {
+		return highlightBuiltIn
+	}
+	if completion.LookPathCached(name) != "" {
+		return highlightCommand
+	}
+	return highlightNotFound
+}
+
+// highlight returns the escape sequences to colour each character
+// of the command-line for readline.Editor.Highlight .
+func highlight(text string) []string {
+	// the indexes of the characters from the byte offsets
+	index := make([]int, len(text)+1)
+	n := 0
+	for i := range text {
+		index[i] = n
+		n++
+	}
+	index[len(text)] = n
+
+	colors := make([]string, n)
+	for _, span := range shell.Highlight(text) {
+		var color string
+		switch span.Kind {
+		case shell.HlCommand:
+			color = commandColor(text[span.Start:span.End])
+		case shell.HlQuote:
+			color = highlightQuote
+		case shell.HlVariable:
+			color = highlightVariable
+		case shell.HlRedirect:
+			color = highlightRedirect
+		case shell.HlOperator:
+			color = highlightOperator
+		case shell.HlError:
+			color = highlightError
+		}
+		if color == "" {
+			continue
+		}
+		sgr := "\x1B[" + color + "m"
+		for i := index[span.Start]; i < index[span.End] && i < n; i++ {
+			colors[i] = sgr
+		}
+	}
+	return colors
+}
@@ -33,10 +33,19 @@ func makeVirtualTable(L Lua, getter, setter func(Lua) int) lua.LValue {
 }
 
 var stringProperty = map[string]*string{
-	"antihistquot": &history.DisableMarks,
-	"histchar":     &history.Mark,
-	"quotation":    &readline.Delimiters,
-	"version":      &frame.Version,
+	"antihistquot":       &history.DisableMarks,
+	"histchar":           &history.Mark,
+	"quotation":          &readline.Delimiters,
+	"version":            &frame.Version,
+	"highlight_alias":    &highlightAlias,
+	"highlight_builtin":  &highlightBuiltIn,
+	"highlight_command":  &highlightCommand,
+	"highlight_notfound": &highlightNotFound,
+	"highlight_quote":    &highlightQuote,
+	"highlight_variable": &highlightVariable,
+	"highlight_redirect": &highlightRedirect,
+	"highlight_operator": &highlightOperator,
+	"highlight_error":    &highlightError,
 }
 
 var boolProperty = map[string]*bool{
@@ -59,6 +68,12 @@ func nyagosGetter(L Lua) int {
 		} else {
 			L.Push(lua.LFalse)
 		}
+	} else if key == "pipestatus" {
+		table := L.NewTable()
+		for _, rc := range shell.PipeStatus {
+			table.Append(lua.LNumber(rc))
+		}
+		L.Push(table)
 	} else {
 		L.Push(L.RawGet(L.Get(1).(*lua.LTable), keyTmp))
 	}
@@ -151,6 +166,8 @@ func NewLua() (Lua, error) {
 	L.SetField(nyagosTable, "bindkey", L.NewFunction(cmdBindKey))
 	L.SetField(nyagosTable, "exec", L.NewFunction(cmdExec))
 	L.SetField(nyagosTable, "eval", L.NewFunction(cmdEval))
+	L.SetField(nyagosTable, "async_eval", L.NewFunction(cmdAsyncEval))
+	L.SetField(nyagosTable, "complete_for", L.NewFunction(cmdCompleteFor))
 	L.SetField(nyagosTable, "prompt", L.NewFunction(lua2param(functions.Prompt)))
 	L.SetField(nyagosTable, "create_object", L.NewFunction(CreateObject))
 	L.SetField(nyagosTable, "goarch", lua.LString(runtime.GOARCH))
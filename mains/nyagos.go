@@ -167,9 +167,13 @@ func Main() error {
 
 	var stream1 shell.Stream
 	if !commands.ReadStdinAsFile && isatty.IsTerminal(os.Stdin.Fd()) {
-		constream := frame.NewCmdStreamConsole(
+		var constream *frame.CmdStreamConsole
+		constream = frame.NewCmdStreamConsole(
 			func() (int, error) {
 				if L != nil {
+					if !constream.Editor.Redrawing() {
+						resetAsync()
+					}
 					return printPrompt(ctx, sh, L)
 				} else {
 					functions.Prompt(
@@ -183,6 +187,24 @@ func Main() error {
 					return 0, nil
 				}
 			})
+		constream.Editor.Highlight = highlight
+		constream.Editor.PromptRows = func() int { return functions.PromptRows }
+		if L != nil {
+			constream.Editor.ViPrompt = func(state string) (int, error) {
+				return printViPrompt(ctx, sh, L, state)
+			}
+			defaultSuggest := constream.Editor.Suggest
+			constream.Editor.Suggest = func(text string) string {
+				return callSuggest(ctx, sh, L, text, defaultSuggest)
+			}
+			constream.Editor.RPrompt = func() (string, error) {
+				return getRPrompt(ctx, sh, L)
+			}
+			constream.Editor.TransientPrompt = func() (int, error) {
+				return printTransientPrompt(ctx, sh, L)
+			}
+			asyncRedraw = constream.Editor.Redraw
+		}
 		stream1 = constream
 		frame.DefaultHistory = constream.History
 		ctx = context.WithValue(ctx, history.PackageId, constream.History)
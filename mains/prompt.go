@@ -3,14 +3,18 @@ package mains
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 
 	"github.com/yuin/gopher-lua"
+	"github.com/zetamatta/nyagos/frame"
 	"github.com/zetamatta/nyagos/functions"
+	"github.com/zetamatta/nyagos/readline"
 	"github.com/zetamatta/nyagos/shell"
 )
 
 func printPrompt(ctx context.Context, sh *shell.Shell, L Lua) (int, error) {
+	functions.PromptRows = 0
 	nyagosTbl := L.GetGlobal("nyagos")
 	prompt := L.GetField(nyagosTbl, "prompt")
 	if promptHook, ok := prompt.(*lua.LFunction); ok {
@@ -36,3 +40,77 @@ func printPrompt(ctx context.Context, sh *shell.Shell, L Lua) (int, error) {
 	}
 	return functions.PromptCore(sh.Term(), promptStr), nil
 }
+
+// printViPrompt draws the state of the vi-mode with nyagos.vi_prompt
+// (function(state) returning the width) or the default mark.
+func printViPrompt(ctx context.Context, sh *shell.Shell, L Lua, state string) (int, error) {
+	nyagosTbl := L.GetGlobal("nyagos")
+	hook, ok := L.GetField(nyagosTbl, "vi_prompt").(*lua.LFunction)
+	if !ok {
+		mark := readline.DefaultViPrompt(state)
+		io.WriteString(sh.Term(), mark)
+		return readline.GetStringWidth(mark), nil
+	}
+	L.Push(hook)
+	L.Push(lua.LString(state))
+	if err := callCSL(ctx, sh, L, 1, 1); err != nil {
+		return 0, err
+	}
+	length, ok := L.Get(-1).(lua.LNumber)
+	L.Pop(1)
+	if ok {
+		return int(length), nil
+	}
+	return 0, errors.New("nyagos.vi_prompt: return-value(length) is not a number")
+}
+
+// getRPrompt returns the right prompt by nyagos.rprompt
+// (function returning the text, or the string of the macros of %PROMPT%).
+func getRPrompt(ctx context.Context, sh *shell.Shell, L Lua) (string, error) {
+	nyagosTbl := L.GetGlobal("nyagos")
+	rprompt := L.GetField(nyagosTbl, "rprompt")
+	if hook, ok := rprompt.(*lua.LFunction); ok {
+		L.Push(hook)
+		if err := callCSL(ctx, sh, L, 0, 1); err != nil {
+			return "", err
+		}
+		result := L.Get(-1)
+		L.Pop(1)
+		if result == lua.LNil {
+			return "", nil
+		}
+		if s, ok := result.(lua.LString); ok {
+			return string(s), nil
+		}
+		return "", errors.New("nyagos.rprompt: return-value is not a string")
+	}
+	if s, ok := rprompt.(lua.LString); ok && s != "" {
+		return frame.Format2Prompt(string(s)), nil
+	}
+	return "", nil
+}
+
+// printTransientPrompt draws the short prompt by nyagos.transient_prompt
+// (function returning the width, or the string of the macros of %PROMPT%).
+func printTransientPrompt(ctx context.Context, sh *shell.Shell, L Lua) (int, error) {
+	nyagosTbl := L.GetGlobal("nyagos")
+	prompt := L.GetField(nyagosTbl, "transient_prompt")
+	if hook, ok := prompt.(*lua.LFunction); ok {
+		L.Push(hook)
+		if err := callCSL(ctx, sh, L, 0, 1); err != nil {
+			return 0, err
+		}
+		length, ok := L.Get(-1).(lua.LNumber)
+		L.Pop(1)
+		if ok {
+			return int(length), nil
+		}
+		return 0, errors.New("nyagos.transient_prompt: return-value(length) is not a number")
+	}
+	text := readline.DefaultTransientPrompt
+	if s, ok := prompt.(lua.LString); ok && s != "" {
+		text = frame.Format2Prompt(string(s))
+	}
+	io.WriteString(sh.Term(), text)
+	return readline.GetStringWidth(text), nil
+}
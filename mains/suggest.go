@@ -0,0 +1,32 @@
+package mains
+
+import (
+	"context"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/zetamatta/nyagos/shell"
+)
+
+// callSuggest asks nyagos.suggest (function(text) returning the whole line)
+// for the suggestion. When it is not set or returns nil, defaultSuggest is used.
+func callSuggest(ctx context.Context, sh *shell.Shell, L Lua, text string, defaultSuggest func(string) string) string {
+	nyagosTbl := L.GetGlobal("nyagos")
+	hook, ok := L.GetField(nyagosTbl, "suggest").(*lua.LFunction)
+	if !ok {
+		return defaultSuggest(text)
+	}
+	L.Push(hook)
+	L.Push(lua.LString(text))
+	if err := callCSL(ctx, sh, L, 1, 1); err != nil {
+		return ""
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	if s, ok := result.(lua.LString); ok {
+		return string(s)
+	}
+	if result == lua.LNil {
+		return defaultSuggest(text)
+	}
+	return ""
+}
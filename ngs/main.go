@@ -12,6 +12,9 @@ func main() {
 	frame.Version = "without Lua"
 
 	if err := frame.Start(Main); err != nil && err != io.EOF {
+		if status, ok := err.(frame.ExitStatus); ok {
+			os.Exit(int(status))
+		}
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
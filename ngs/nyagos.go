@@ -48,7 +48,7 @@ func Main() error {
 		stream1 := shell.NewCmdStreamFile(fd)
 		_, err = sh.Loop(ctx, stream1)
 		fd.Close()
-		if err == io.EOF {
+		if err == io.EOF || err == shell.ErrReturn {
 			return nil
 		}
 		return err
@@ -31,6 +31,14 @@ nyagos.alias.lua_f=function(args)
 end
 
 nyagos.alias["for"]=function(args)
+    if args[2] == "in" and not string.match(args[1],"^[%%/]") then
+        -- `for VAR in ...` is the loop of nyagos itself.
+        local newargs = { [0]="__for__" }
+        for i=1,#args do
+            newargs[i] = args[i]
+        end
+        return newargs
+    end
     local batchpathu = nyagos.env.temp .. os.tmpname() .. ".cmd"
     local batchpatha = nyagos.utoa(batchpathu)
     local fd,fd_err = nyagos.open(batchpathu,"w")
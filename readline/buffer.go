@@ -10,6 +10,13 @@ import (
 var hasCache = map[rune]struct{}{}
 
 func (this *Buffer) PutRune(ch rune) {
+	if this.quiet {
+		return
+	}
+	this.putRune(ch)
+}
+
+func (this *Buffer) putRune(ch rune) {
 	if ch < ' ' {
 		this.Writer.WriteByte('^')
 		this.Writer.WriteByte(byte('A' + (ch - 1)))
@@ -19,7 +26,7 @@ func (this *Buffer) PutRune(ch rune) {
 }
 
 func (this *Buffer) PutRunes(ch rune, n int) {
-	if n <= 0 {
+	if n <= 0 || this.quiet {
 		return
 	}
 	this.PutRune(ch)
@@ -29,6 +36,9 @@ func (this *Buffer) PutRunes(ch rune, n int) {
 }
 
 func (this *Buffer) Backspace(n int) {
+	if this.quiet {
+		return
+	}
 	if n > 1 {
 		fmt.Fprintf(this.Writer, "\x1B[%dD", n)
 	} else if n == 1 {
@@ -37,6 +47,9 @@ func (this *Buffer) Backspace(n int) {
 }
 
 func (this *Buffer) Eraseline() {
+	if this.quiet {
+		return
+	}
 	io.WriteString(this.Writer, "\x1B[0K")
 }
 
@@ -53,9 +66,45 @@ type Buffer struct {
 	TermWidth      int // == TopColumn + ViewWidth + FORBIDDEN_WIDTH
 	TopColumn      int // == width of Prompt
 	HistoryPointer int
+
+	// for the multi-line mode
+	multiLine bool
+	quiet     bool // true while key-functions run not to draw by themselves.
+	cursorRow int  // the row of the cursor from the row of the prompt.
+	lastRow   int  // the last row drawn.
+
+	// for the undo and the kill-ring
+	undoStack   []undoState
+	redoStack   []undoState
+	undoing     bool // true when the last key-function was UNDO or REDO.
+	lastTyping  bool // true when the last key-function inserted one character.
+	mark        int
+	yanked      bool // true when the current key-function yanked.
+	lastWasYank bool // true when the last key-function yanked.
+	yankStart   int
+	yankIndex   int
+
+	// for the vi-mode
+	viMode      bool
+	vi          viState
+	pending     []Event // the key-events to replay for `.` or pushed back
+	promptWidth int     // the width of the prompt without the mark of the vi-mode.
+
+	// for the highlight
+	colors    []string // the escape sequences for each character
+	lastColor string   // the escape sequence written last by paintRune
+
+	suggestion string // the rest of the line suggested after the cursor
+
+	// for the right prompt
+	rprompt      string
+	rpromptWidth int
 }
 
 func (this *Buffer) ViewWidth() int {
+	if this.quiet {
+		return maxViewWidth
+	}
 	return this.TermWidth - this.TopColumn - FORBIDDEN_WIDTH
 }
 
@@ -133,7 +182,7 @@ func (this *Buffer) ReplaceAndRepaint(pos int, str string) {
 	// Repaint
 	w := 0
 	for i := this.ViewStart; i < this.Cursor; i++ {
-		this.PutRune(this.Buffer[i])
+		this.paintRune(i)
 		w += GetCharWidth(this.Buffer[i])
 	}
 	bs := 0
@@ -142,10 +191,11 @@ func (this *Buffer) ReplaceAndRepaint(pos int, str string) {
 		if w+w1 >= this.ViewWidth() {
 			break
 		}
-		this.PutRune(this.Buffer[i])
+		this.paintRune(i)
 		w += w1
 		bs += w1
 	}
+	this.resetColor()
 	this.Eraseline()
 	if bs > 0 {
 		this.Backspace(bs)
@@ -169,10 +219,11 @@ func (this *Buffer) Repaint(pos int, del int) {
 		if vp+w1 >= this.ViewWidth() {
 			break
 		}
-		this.PutRune(this.Buffer[i])
+		this.paintRune(i)
 		vp += w1
 		bs += w1
 	}
+	this.resetColor()
 	this.Eraseline()
 	if del > 0 {
 		this.Backspace(bs)
@@ -185,14 +236,22 @@ func (this *Buffer) Repaint(pos int, del int) {
 func (this *Buffer) RepaintAfterPrompt() {
 	this.ResetViewStart()
 	for i := this.ViewStart; i < this.Cursor; i++ {
-		this.PutRune(this.Buffer[i])
+		this.paintRune(i)
 	}
 	this.Repaint(this.Cursor, 0)
 }
 
 func (this *Buffer) RepaintAll() {
 	this.Writer.Flush()
-	this.TopColumn, _ = this.Prompt()
+	this.TopColumn, _ = this.printPrompt()
+	if this.multiLine {
+		this.cursorRow = 0
+		this.lastRow = 0
+		if !this.quiet {
+			this.repaintMultiLine()
+		}
+		return
+	}
 	this.RepaintAfterPrompt()
 }
 
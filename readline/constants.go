@@ -3,164 +3,182 @@ package readline
 import "context"
 
 const (
-	K_BACKSPACE     = "BACKSPACE"
-	K_CAPSLOCK      = "CAPSLOCK"
-	K_CLEAR         = "CLEAR"
-	K_CTRL          = "CTRL"
-	K_CTRL_A        = "C_A"
-	K_CTRL_B        = "C_B"
-	K_CTRL_BREAK    = "C_BREAK"
-	K_CTRL_C        = "C_C"
-	K_CTRL_D        = "C_D"
-	K_CTRL_E        = "C_E"
-	K_CTRL_F        = "C_F"
-	K_CTRL_G        = "C_G"
-	K_CTRL_H        = "C_H"
-	K_CTRL_I        = "C_I"
-	K_CTRL_J        = "C_J"
-	K_CTRL_K        = "C_K"
-	K_CTRL_L        = "C_L"
-	K_CTRL_M        = "C_M"
-	K_CTRL_N        = "C_N"
-	K_CTRL_O        = "C_O"
-	K_CTRL_P        = "C_P"
-	K_CTRL_Q        = "C_Q"
-	K_CTRL_R        = "C_R"
-	K_CTRL_S        = "C_S"
-	K_CTRL_T        = "C_T"
-	K_CTRL_U        = "C_U"
-	K_CTRL_V        = "C_V"
-	K_CTRL_W        = "C_W"
-	K_CTRL_X        = "C_X"
-	K_CTRL_Y        = "C_Y"
-	K_CTRL_Z        = "C_Z"
-	K_DELETE        = "DEL"
-	K_DOWN          = "DOWN"
-	K_END           = "END"
-	K_ENTER         = "ENTER"
-	K_ESCAPE        = "ESCAPE"
-	K_F1            = "F1"
-	K_F10           = "F10"
-	K_F11           = "F11"
-	K_F12           = "F12"
-	K_F13           = "F13"
-	K_F14           = "F14"
-	K_F15           = "F15"
-	K_F16           = "F16"
-	K_F17           = "F17"
-	K_F18           = "F18"
-	K_F19           = "F19"
-	K_F2            = "F2"
-	K_F20           = "F20"
-	K_F21           = "F21"
-	K_F22           = "F22"
-	K_F23           = "F23"
-	K_F24           = "F24"
-	K_F3            = "F3"
-	K_F4            = "F4"
-	K_F5            = "F5"
-	K_F6            = "F6"
-	K_F7            = "F7"
-	K_F8            = "F8"
-	K_F9            = "F9"
-	K_HOME          = "HOME"
-	K_LEFT          = "LEFT"
-	K_PAGEDOWN      = "PAGEDOWN"
-	K_PAGEUP        = "PAGEUP"
-	K_PAUSE         = "PAUSE"
-	K_RIGHT         = "RIGHT"
-	K_SHIFT         = "SHIFT"
-	K_UP            = "UP"
-	K_ALT_A         = "M_A"
-	K_ALT_B         = "M_B"
-	K_ALT_BACKSPACE = "M_BACKSPACE"
-	K_ALT_BREAK     = "M_BREAK"
-	K_ALT_C         = "M_C"
-	K_ALT_D         = "M_D"
-	K_ALT_E         = "M_E"
-	K_ALT_F         = "M_F"
-	K_ALT_G         = "M_G"
-	K_ALT_H         = "M_H"
-	K_ALT_I         = "M_I"
-	K_ALT_J         = "M_J"
-	K_ALT_K         = "M_K"
-	K_ALT_L         = "M_L"
-	K_ALT_M         = "M_M"
-	K_ALT_N         = "M_N"
-	K_ALT_O         = "M_O"
-	K_ALT_P         = "M_P"
-	K_ALT_Q         = "M_Q"
-	K_ALT_R         = "M_R"
-	K_ALT_S         = "M_S"
-	K_ALT_T         = "M_T"
-	K_ALT_U         = "M_U"
-	K_ALT_V         = "M_V"
-	K_ALT_W         = "M_W"
-	K_ALT_X         = "M_X"
-	K_ALT_Y         = "M_Y"
-	K_ALT_Z         = "M_Z"
-	K_ALT_OEM_2     = "M_OEM_2"
+	K_BACKSPACE       = "BACKSPACE"
+	K_CAPSLOCK        = "CAPSLOCK"
+	K_CLEAR           = "CLEAR"
+	K_CTRL            = "CTRL"
+	K_CTRL_A          = "C_A"
+	K_CTRL_B          = "C_B"
+	K_CTRL_BREAK      = "C_BREAK"
+	K_CTRL_C          = "C_C"
+	K_CTRL_D          = "C_D"
+	K_CTRL_E          = "C_E"
+	K_CTRL_F          = "C_F"
+	K_CTRL_G          = "C_G"
+	K_CTRL_H          = "C_H"
+	K_CTRL_I          = "C_I"
+	K_CTRL_J          = "C_J"
+	K_CTRL_K          = "C_K"
+	K_CTRL_L          = "C_L"
+	K_CTRL_M          = "C_M"
+	K_CTRL_N          = "C_N"
+	K_CTRL_O          = "C_O"
+	K_CTRL_P          = "C_P"
+	K_CTRL_Q          = "C_Q"
+	K_CTRL_R          = "C_R"
+	K_CTRL_S          = "C_S"
+	K_CTRL_T          = "C_T"
+	K_CTRL_U          = "C_U"
+	K_CTRL_V          = "C_V"
+	K_CTRL_W          = "C_W"
+	K_CTRL_X          = "C_X"
+	K_CTRL_Y          = "C_Y"
+	K_CTRL_Z          = "C_Z"
+	K_CTRL_UNDERSCORE = "C_UNDERSCORE"
+	K_DELETE          = "DEL"
+	K_DOWN            = "DOWN"
+	K_END             = "END"
+	K_ENTER           = "ENTER"
+	K_ESCAPE          = "ESCAPE"
+	K_F1              = "F1"
+	K_F10             = "F10"
+	K_F11             = "F11"
+	K_F12             = "F12"
+	K_F13             = "F13"
+	K_F14             = "F14"
+	K_F15             = "F15"
+	K_F16             = "F16"
+	K_F17             = "F17"
+	K_F18             = "F18"
+	K_F19             = "F19"
+	K_F2              = "F2"
+	K_F20             = "F20"
+	K_F21             = "F21"
+	K_F22             = "F22"
+	K_F23             = "F23"
+	K_F24             = "F24"
+	K_F3              = "F3"
+	K_F4              = "F4"
+	K_F5              = "F5"
+	K_F6              = "F6"
+	K_F7              = "F7"
+	K_F8              = "F8"
+	K_F9              = "F9"
+	K_HOME            = "HOME"
+	K_LEFT            = "LEFT"
+	K_PAGEDOWN        = "PAGEDOWN"
+	K_PAGEUP          = "PAGEUP"
+	K_PAUSE           = "PAUSE"
+	K_RIGHT           = "RIGHT"
+	K_SHIFT           = "SHIFT"
+	K_UP              = "UP"
+	K_ALT_A           = "M_A"
+	K_ALT_B           = "M_B"
+	K_ALT_BACKSPACE   = "M_BACKSPACE"
+	K_ALT_BREAK       = "M_BREAK"
+	K_ALT_C           = "M_C"
+	K_ALT_D           = "M_D"
+	K_ALT_E           = "M_E"
+	K_ALT_F           = "M_F"
+	K_ALT_G           = "M_G"
+	K_ALT_H           = "M_H"
+	K_ALT_I           = "M_I"
+	K_ALT_J           = "M_J"
+	K_ALT_K           = "M_K"
+	K_ALT_L           = "M_L"
+	K_ALT_M           = "M_M"
+	K_ALT_N           = "M_N"
+	K_ALT_O           = "M_O"
+	K_ALT_P           = "M_P"
+	K_ALT_Q           = "M_Q"
+	K_ALT_R           = "M_R"
+	K_ALT_S           = "M_S"
+	K_ALT_T           = "M_T"
+	K_ALT_U           = "M_U"
+	K_ALT_V           = "M_V"
+	K_ALT_W           = "M_W"
+	K_ALT_X           = "M_X"
+	K_ALT_Y           = "M_Y"
+	K_ALT_Z           = "M_Z"
+	K_ALT_OEM_2       = "M_OEM_2"
 )
 
 const (
-	F_ACCEPT_LINE          = "ACCEPT_LINE"
-	F_BACKWARD_CHAR        = "BACKWARD_CHAR"
-	F_BACKWARD_DELETE_CHAR = "BACKWARD_DELETE_CHAR"
-	F_BEGINNING_OF_LINE    = "BEGINNING_OF_LINE"
-	F_CLEAR_SCREEN         = "CLEAR_SCREEN"
-	F_DELETE_CHAR          = "DELETE_CHAR"
-	F_DELETE_OR_ABORT      = "DELETE_OR_ABORT"
-	F_END_OF_LINE          = "END_OF_LINE"
-	F_FORWARD_CHAR         = "FORWARD_CHAR"
-	F_HISTORY_DOWN         = "HISTORY_DOWN" // for compatible
-	F_HISTORY_UP           = "HISTORY_UP"   // for compatible
-	F_NEXT_HISTORY         = "NEXT_HISTORY"
-	F_PREVIOUS_HISTORY     = "PREVIOUS_HISTORY"
-	F_INTR                 = "INTR"
-	F_ISEARCH_BACKWARD     = "ISEARCH_BACKWARD"
-	F_KILL_LINE            = "KILL_LINE"
-	F_KILL_WHOLE_LINE      = "KILL_WHOLE_LINE"
-	F_PASS                 = "PASS"
-	F_QUOTED_INSERT        = "QUOTED_INSERT"
-	F_REPAINT_ON_NEWLINE   = "REPAINT_ON_NEWLINE"
-	F_SWAPCHAR             = "SWAPCHAR"
-	F_UNIX_LINE_DISCARD    = "UNIX_LINE_DISCARD"
-	F_UNIX_WORD_RUBOUT     = "UNIX_WORD_RUBOUT"
-	F_YANK                 = "YANK"
-	F_YANK_WITH_QUOTE      = "YANK_WITH_QUOTE"
+	F_ACCEPT_LINE             = "ACCEPT_LINE"
+	F_BACKWARD_CHAR           = "BACKWARD_CHAR"
+	F_BACKWARD_DELETE_CHAR    = "BACKWARD_DELETE_CHAR"
+	F_BACKWARD_KILL_WORD      = "BACKWARD_KILL_WORD"
+	F_BACKWARD_WORD           = "BACKWARD_WORD"
+	F_BEGINNING_OF_LINE       = "BEGINNING_OF_LINE"
+	F_CD_HISTORY_SELECT       = "CD_HISTORY_SELECT"
+	F_CLEAR_SCREEN            = "CLEAR_SCREEN"
+	F_DELETE_CHAR             = "DELETE_CHAR"
+	F_DELETE_OR_ABORT         = "DELETE_OR_ABORT"
+	F_END_OF_LINE             = "END_OF_LINE"
+	F_EXCHANGE_POINT_AND_MARK = "EXCHANGE_POINT_AND_MARK"
+	F_FILE_SELECT             = "FILE_SELECT"
+	F_FORWARD_CHAR            = "FORWARD_CHAR"
+	F_FORWARD_WORD            = "FORWARD_WORD"
+	F_HISTORY_DOWN            = "HISTORY_DOWN" // for compatible
+	F_HISTORY_UP              = "HISTORY_UP"   // for compatible
+	F_HISTORY_SELECT          = "HISTORY_SELECT"
+	F_NEXT_HISTORY            = "NEXT_HISTORY"
+	F_PREVIOUS_HISTORY        = "PREVIOUS_HISTORY"
+	F_INTR                    = "INTR"
+	F_ISEARCH_BACKWARD        = "ISEARCH_BACKWARD"
+	F_ISEARCH_FORWARD         = "ISEARCH_FORWARD"
+	F_KILL_LINE               = "KILL_LINE"
+	F_KILL_WHOLE_LINE         = "KILL_WHOLE_LINE"
+	F_KILL_WORD               = "KILL_WORD"
+	F_PASS                    = "PASS"
+	F_QUOTED_INSERT           = "QUOTED_INSERT"
+	F_REDO                    = "REDO"
+	F_REPAINT_ON_NEWLINE      = "REPAINT_ON_NEWLINE"
+	F_SET_MARK                = "SET_MARK"
+	F_SWAPCHAR                = "SWAPCHAR"
+	F_TRANSPOSE_WORDS         = "TRANSPOSE_WORDS"
+	F_UNDO                    = "UNDO"
+	F_UNIX_LINE_DISCARD       = "UNIX_LINE_DISCARD"
+	F_UNIX_WORD_RUBOUT        = "UNIX_WORD_RUBOUT"
+	F_UPCASE_WORD             = "UPCASE_WORD"
+	F_VI_COMMAND_MODE         = "VI_COMMAND_MODE"
+	F_YANK                    = "YANK"
+	F_YANK_POP                = "YANK_POP"
+	F_YANK_WITH_QUOTE         = "YANK_WITH_QUOTE"
 )
 
 var name2char = map[string]rune{
-	K_BACKSPACE: '\b',
-	K_CTRL_A:    rune('a' & 0x1F),
-	K_CTRL_B:    rune('b' & 0x1F),
-	K_CTRL_C:    rune('c' & 0x1F),
-	K_CTRL_D:    rune('d' & 0x1F),
-	K_CTRL_E:    rune('e' & 0x1F),
-	K_CTRL_F:    rune('f' & 0x1F),
-	K_CTRL_G:    rune('g' & 0x1F),
-	K_CTRL_H:    rune('h' & 0x1F),
-	K_CTRL_I:    rune('i' & 0x1F),
-	K_CTRL_J:    rune('j' & 0x1F),
-	K_CTRL_K:    rune('k' & 0x1F),
-	K_CTRL_L:    rune('l' & 0x1F),
-	K_CTRL_M:    rune('m' & 0x1F),
-	K_CTRL_N:    rune('n' & 0x1F),
-	K_CTRL_O:    rune('o' & 0x1F),
-	K_CTRL_P:    rune('p' & 0x1F),
-	K_CTRL_Q:    rune('q' & 0x1F),
-	K_CTRL_R:    rune('r' & 0x1F),
-	K_CTRL_S:    rune('s' & 0x1F),
-	K_CTRL_T:    rune('t' & 0x1F),
-	K_CTRL_U:    rune('u' & 0x1F),
-	K_CTRL_V:    rune('v' & 0x1F),
-	K_CTRL_W:    rune('w' & 0x1F),
-	K_CTRL_X:    rune('x' & 0x1F),
-	K_CTRL_Y:    rune('y' & 0x1F),
-	K_CTRL_Z:    rune('z' & 0x1F),
-	K_DELETE:    '\x7F',
-	K_ENTER:     '\r',
-	K_ESCAPE:    rune('[' & 0x1F),
+	K_BACKSPACE:       '\b',
+	K_CTRL_A:          rune('a' & 0x1F),
+	K_CTRL_B:          rune('b' & 0x1F),
+	K_CTRL_C:          rune('c' & 0x1F),
+	K_CTRL_D:          rune('d' & 0x1F),
+	K_CTRL_E:          rune('e' & 0x1F),
+	K_CTRL_F:          rune('f' & 0x1F),
+	K_CTRL_G:          rune('g' & 0x1F),
+	K_CTRL_H:          rune('h' & 0x1F),
+	K_CTRL_I:          rune('i' & 0x1F),
+	K_CTRL_J:          rune('j' & 0x1F),
+	K_CTRL_K:          rune('k' & 0x1F),
+	K_CTRL_L:          rune('l' & 0x1F),
+	K_CTRL_M:          rune('m' & 0x1F),
+	K_CTRL_N:          rune('n' & 0x1F),
+	K_CTRL_O:          rune('o' & 0x1F),
+	K_CTRL_P:          rune('p' & 0x1F),
+	K_CTRL_Q:          rune('q' & 0x1F),
+	K_CTRL_R:          rune('r' & 0x1F),
+	K_CTRL_S:          rune('s' & 0x1F),
+	K_CTRL_T:          rune('t' & 0x1F),
+	K_CTRL_U:          rune('u' & 0x1F),
+	K_CTRL_V:          rune('v' & 0x1F),
+	K_CTRL_W:          rune('w' & 0x1F),
+	K_CTRL_X:          rune('x' & 0x1F),
+	K_CTRL_Y:          rune('y' & 0x1F),
+	K_CTRL_Z:          rune('z' & 0x1F),
+	K_CTRL_UNDERSCORE: rune('_' & 0x1F),
+	K_DELETE:          '\x7F',
+	K_ENTER:           '\r',
+	K_ESCAPE:          rune('[' & 0x1F),
 }
 
 // KeyCode from
@@ -240,31 +258,47 @@ var name2alt = map[string]uint16{
 }
 
 var NAME2FUNC = map[string]func(context.Context, *Buffer) Result{
-	F_ACCEPT_LINE:          KeyFuncEnter,
-	F_BACKWARD_CHAR:        KeyFuncBackword,
-	F_BACKWARD_DELETE_CHAR: KeyFuncBackSpace,
-	F_BEGINNING_OF_LINE:    KeyFuncHead,
-	F_CLEAR_SCREEN:         KeyFuncCLS,
-	F_DELETE_CHAR:          KeyFuncDelete,
-	F_DELETE_OR_ABORT:      KeyFuncDeleteOrAbort,
-	F_END_OF_LINE:          KeyFuncTail,
-	F_FORWARD_CHAR:         KeyFuncForward,
-	F_HISTORY_DOWN:         KeyFuncHistoryDown, // for compatible
-	F_HISTORY_UP:           KeyFuncHistoryUp,   // for compatible
-	F_NEXT_HISTORY:         KeyFuncHistoryDown,
-	F_PREVIOUS_HISTORY:     KeyFuncHistoryUp,
-	F_INTR:                 KeyFuncIntr,
-	F_ISEARCH_BACKWARD:     KeyFuncIncSearch,
-	F_KILL_LINE:            KeyFuncClearAfter,
-	F_KILL_WHOLE_LINE:      KeyFuncClear,
-	F_PASS:                 nil,
-	F_QUOTED_INSERT:        KeyFuncQuotedInsert,
-	F_UNIX_LINE_DISCARD:    KeyFuncClearBefore,
-	F_UNIX_WORD_RUBOUT:     KeyFuncWordRubout,
-	F_YANK:                 KeyFuncPaste,
-	F_YANK_WITH_QUOTE:      KeyFuncPasteQuote,
-	F_SWAPCHAR:             KeyFuncSwapChar,
-	F_REPAINT_ON_NEWLINE:   KeyFuncRepaintOnNewline,
+	F_ACCEPT_LINE:             KeyFuncEnter,
+	F_BACKWARD_CHAR:           KeyFuncBackword,
+	F_BACKWARD_DELETE_CHAR:    KeyFuncBackSpace,
+	F_BEGINNING_OF_LINE:       KeyFuncHead,
+	F_CLEAR_SCREEN:            KeyFuncCLS,
+	F_DELETE_CHAR:             KeyFuncDelete,
+	F_DELETE_OR_ABORT:         KeyFuncDeleteOrAbort,
+	F_END_OF_LINE:             KeyFuncTail,
+	F_FORWARD_CHAR:            KeyFuncForward,
+	F_HISTORY_DOWN:            KeyFuncHistoryDown, // for compatible
+	F_HISTORY_UP:              KeyFuncHistoryUp,   // for compatible
+	F_NEXT_HISTORY:            KeyFuncHistoryDown,
+	F_PREVIOUS_HISTORY:        KeyFuncHistoryUp,
+	F_INTR:                    KeyFuncIntr,
+	F_ISEARCH_BACKWARD:        KeyFuncIncSearch,
+	F_ISEARCH_FORWARD:         KeyFuncIncSearchForward,
+	F_KILL_LINE:               KeyFuncClearAfter,
+	F_KILL_WHOLE_LINE:         KeyFuncClear,
+	F_PASS:                    nil,
+	F_QUOTED_INSERT:           KeyFuncQuotedInsert,
+	F_UNIX_LINE_DISCARD:       KeyFuncClearBefore,
+	F_UNIX_WORD_RUBOUT:        KeyFuncWordRubout,
+	F_YANK:                    KeyFuncPaste,
+	F_YANK_WITH_QUOTE:         KeyFuncPasteQuote,
+	F_SWAPCHAR:                KeyFuncSwapChar,
+	F_REPAINT_ON_NEWLINE:      KeyFuncRepaintOnNewline,
+	F_FORWARD_WORD:            KeyFuncForwardWord,
+	F_BACKWARD_WORD:           KeyFuncBackwardWord,
+	F_KILL_WORD:               KeyFuncKillWord,
+	F_BACKWARD_KILL_WORD:      KeyFuncBackwardKillWord,
+	F_UPCASE_WORD:             KeyFuncUpcaseWord,
+	F_TRANSPOSE_WORDS:         KeyFuncTransposeWords,
+	F_SET_MARK:                KeyFuncSetMark,
+	F_EXCHANGE_POINT_AND_MARK: KeyFuncExchangePointAndMark,
+	F_UNDO:                    KeyFuncUndo,
+	F_REDO:                    KeyFuncRedo,
+	F_YANK_POP:                KeyFuncYankPop,
+	F_VI_COMMAND_MODE:         KeyFuncViCommandMode,
+	F_HISTORY_SELECT:          KeyFuncHistorySelect,
+	F_FILE_SELECT:             KeyFuncFileSelect,
+	F_CD_HISTORY_SELECT:       KeyFuncCdHistorySelect,
 }
 
 func name2func(keyName string) KeyFuncT {
@@ -0,0 +1,392 @@
+package readline
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FuzzyMatch is a candidate matched with the pattern of the fuzzy finder.
+type FuzzyMatch struct {
+	Text      string
+	Index     int   // the index in the list of candidates
+	Score     int   // the higher is the better
+	Positions []int // the indexes of the runes matched
+}
+
+func isFuzzyBoundary(prev, ch rune) bool {
+	if strings.ContainsRune(`/\_-.: `, prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(ch)
+}
+
+// fuzzyScoreTerm matches one word of the pattern as a subsequence of text.
+func fuzzyScoreTerm(term, text []rune, ignoreCase bool) (int, []int, bool) {
+	equal := func(a, b rune) bool {
+		if ignoreCase {
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+	// find the first end of the match, and then the shortest span back from it.
+	j := 0
+	end := -1
+	for i := 0; i < len(text) && j < len(term); i++ {
+		if equal(text[i], term[j]) {
+			j++
+			if j == len(term) {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions := make([]int, len(term))
+	j = len(term) - 1
+	for i := end; i >= 0 && j >= 0; i-- {
+		if equal(text[i], term[j]) {
+			positions[j] = i
+			j--
+		}
+	}
+	score := 0
+	for k, pos := range positions {
+		score += 16
+		if pos == 0 || isFuzzyBoundary(text[pos-1], text[pos]) {
+			score += 8
+		}
+		if k > 0 {
+			if gap := pos - positions[k-1] - 1; gap == 0 {
+				score += 4
+			} else {
+				score -= gap
+			}
+		}
+	}
+	return score, positions, true
+}
+
+// FuzzyScore returns the score of text for the pattern. The words of
+// the pattern separated by spaces must all match as subsequences of text.
+// The case is ignored unless the pattern contains upper-case letters.
+func FuzzyScore(pattern, text string) (int, []int, bool) {
+	ignoreCase := strings.ToLower(pattern) == pattern
+	runes := []rune(text)
+	total := 0
+	var positions []int
+	for _, term := range strings.Fields(pattern) {
+		score, pos, ok := fuzzyScoreTerm([]rune(term), runes, ignoreCase)
+		if !ok {
+			return 0, nil, false
+		}
+		total += score
+		positions = append(positions, pos...)
+	}
+	sort.Ints(positions)
+	return total, positions, true
+}
+
+// FuzzyFilter returns the candidates matched with the pattern sorted by
+// the score. The shorter and the earlier candidates come first among the same score.
+// With the empty pattern, all candidates are returned in the original order.
+func FuzzyFilter(pattern string, list []string) []FuzzyMatch {
+	result := make([]FuzzyMatch, 0, len(list))
+	if strings.TrimSpace(pattern) == "" {
+		for i, text := range list {
+			result = append(result, FuzzyMatch{Text: text, Index: i})
+		}
+		return result
+	}
+	for i, text := range list {
+		if score, positions, ok := FuzzyScore(pattern, text); ok {
+			result = append(result, FuzzyMatch{
+				Text:      text,
+				Index:     i,
+				Score:     score,
+				Positions: positions,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return len(result[i].Text) < len(result[j].Text)
+	})
+	return result
+}
+
+// FuzzyFinder is the interactive list to select one of candidates
+// by typing a part of it. It is drawn from the row of the cursor.
+type FuzzyFinder struct {
+	Terminal Terminal // nil means the console
+	Writer   *bufio.Writer
+	Prompt   string
+	Query    string // the initial pattern
+	Height   int    // the maximum rows of the list. 0 means 10.
+}
+
+type fuzzyView struct {
+	*FuzzyFinder
+	pattern  []rune
+	matches  []FuzzyMatch
+	selected int
+	offset   int
+	total    int
+}
+
+func (f *fuzzyView) draw(width, height int) {
+	w := f.Writer
+	io.WriteString(w, "\r\x1B[0J")
+	input := fmt.Sprintf("%s%s", f.Prompt, string(f.pattern))
+	fmt.Fprintf(w, "%s  %d/%d", input, len(f.matches), f.total)
+
+	if f.selected < f.offset {
+		f.offset = f.selected
+	} else if f.selected >= f.offset+height {
+		f.offset = f.selected - height + 1
+	}
+	rows := 0
+	for i := f.offset; i < len(f.matches) && rows < height; i++ {
+		m := f.matches[i]
+		io.WriteString(w, "\r\n")
+		if i == f.selected {
+			io.WriteString(w, "\x1B[7m> ")
+		} else {
+			io.WriteString(w, "  ")
+		}
+		col := 2
+		p := 0
+		for j, ch := range []rune(m.Text) {
+			cw := GetCharWidth(ch)
+			if col+cw >= width-1 {
+				break
+			}
+			if ch < ' ' {
+				ch = ' '
+			}
+			if p < len(m.Positions) && m.Positions[p] == j {
+				fmt.Fprintf(w, "\x1B[1m%c\x1B[22m", ch)
+				p++
+			} else {
+				w.WriteRune(ch)
+			}
+			col += cw
+		}
+		io.WriteString(w, "\x1B[0m\x1B[0K")
+		rows++
+	}
+	if rows > 0 {
+		fmt.Fprintf(w, "\x1B[%dA", rows)
+	}
+	fmt.Fprintf(w, "\r\x1B[%dG", GetStringWidth(input)+1)
+	w.Flush()
+}
+
+// Select shows the candidates and returns the one selected with Enter.
+// It returns false when the selection is canceled with ESC, Ctrl-C or Ctrl-G.
+func (f *FuzzyFinder) Select(list []string) (string, bool) {
+	term := f.Terminal
+	if term == nil {
+		term = ConsoleTerminal
+	}
+	view := &fuzzyView{
+		FuzzyFinder: f,
+		pattern:     []rune(f.Query),
+		total:       len(list),
+	}
+	view.matches = FuzzyFilter(f.Query, list)
+	defer func() {
+		io.WriteString(f.Writer, "\r\x1B[0J")
+		f.Writer.Flush()
+	}()
+	for {
+		width, height := term.Size()
+		rows := f.Height
+		if rows <= 0 {
+			rows = 10
+		}
+		if height > 2 && rows > height-2 {
+			rows = height - 2
+		}
+		view.draw(width, rows)
+
+		e, err := term.ReadEvent()
+		if err != nil {
+			return "", false
+		}
+		if e.Key == nil {
+			continue
+		}
+		changed := false
+		switch e.Key.Rune {
+		case 0:
+			switch e.Key.Scan {
+			case name2scan[K_UP]:
+				view.selected--
+			case name2scan[K_DOWN]:
+				view.selected++
+			case name2scan[K_PAGEUP]:
+				view.selected -= rows
+			case name2scan[K_PAGEDOWN]:
+				view.selected += rows
+			}
+		case '\r', '\n':
+			if view.selected < len(view.matches) {
+				return view.matches[view.selected].Text, true
+			}
+			return "", false
+		case rune(0x1B), rune('c' & 0x1F), rune('g' & 0x1F):
+			return "", false
+		case '\b', '\x7F':
+			if len(view.pattern) > 0 {
+				view.pattern = view.pattern[:len(view.pattern)-1]
+				changed = true
+			}
+		case rune('u' & 0x1F):
+			view.pattern = view.pattern[:0]
+			changed = true
+		case rune('p' & 0x1F), rune('k' & 0x1F):
+			view.selected--
+		case rune('n' & 0x1F), '\t':
+			view.selected++
+		default:
+			if !unicode.IsControl(e.Key.Rune) {
+				view.pattern = append(view.pattern, e.Key.Rune)
+				changed = true
+			}
+		}
+		if changed {
+			view.matches = FuzzyFilter(string(view.pattern), list)
+			view.selected = 0
+			view.offset = 0
+		}
+		if view.selected >= len(view.matches) {
+			view.selected = len(view.matches) - 1
+		}
+		if view.selected < 0 {
+			view.selected = 0
+		}
+	}
+}
+
+// fuzzySelect runs the fuzzy finder under the current line and
+// returns the candidate selected.
+func (this *Buffer) fuzzySelect(list []string, prompt, query string) (string, bool) {
+	if this.multiLine {
+		this.moveToLastRow()
+	}
+	io.WriteString(this.Writer, "\n")
+	finder := &FuzzyFinder{
+		Terminal: this.terminal(),
+		Writer:   this.Writer,
+		Prompt:   prompt,
+		Query:    query,
+	}
+	result, ok := finder.Select(list)
+	io.WriteString(this.Writer, "\x1B[A")
+	if !this.multiLine {
+		fmt.Fprintf(this.Writer, "\x1B[%dG",
+			this.TopColumn+this.GetWidthBetween(this.ViewStart, this.Cursor)+1)
+	}
+	return result, ok
+}
+
+func quoteIfSpace(s string) string {
+	if strings.ContainsRune(s, ' ') && !strings.HasPrefix(s, `"`) {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// KeyFuncHistorySelect replaces the line with the history selected
+// with the fuzzy finder.
+func KeyFuncHistorySelect(ctx context.Context, this *Buffer) Result {
+	list := []string{}
+	uniq := map[string]struct{}{}
+	for i := this.History.Len() - 1; i >= 0; i-- {
+		line := this.History.At(i)
+		if _, ok := uniq[line]; line == "" || ok {
+			continue
+		}
+		uniq[line] = struct{}{}
+		list = append(list, line)
+	}
+	if result, ok := this.fuzzySelect(list, "history> ", this.String()); ok {
+		this.setText(result, len([]rune(result)))
+	}
+	return CONTINUE
+}
+
+// FileSelectLimit is the maximum number of files FILE_SELECT lists.
+var FileSelectLimit = 10000
+
+// listFiles returns the files under root recursively.
+// The directories whose names start with `.` are skipped.
+func listFiles(root string) []string {
+	list := []string{}
+	errLimit := errors.New("limit")
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if root == "." {
+			path = strings.TrimPrefix(path, "."+string(os.PathSeparator))
+		}
+		list = append(list, path)
+		if len(list) >= FileSelectLimit {
+			return errLimit
+		}
+		return nil
+	})
+	return list
+}
+
+// KeyFuncFileSelect replaces the word on the cursor with the file selected
+// with the fuzzy finder. When the word is a directory, files under it are listed.
+func KeyFuncFileSelect(ctx context.Context, this *Buffer) Result {
+	word, start := this.CurrentWord()
+	word = strings.Replace(word, `"`, "", -1)
+	root := "."
+	query := word
+	if word != "" {
+		if stat, err := os.Stat(word); err == nil && stat.IsDir() {
+			root = word
+			query = ""
+		}
+	}
+	if result, ok := this.fuzzySelect(listFiles(root), "file> ", query); ok {
+		this.ReplaceAndRepaint(start, quoteIfSpace(result))
+	}
+	return CONTINUE
+}
+
+// CdHistory returns the directories moved with `cd` (the newest first)
+// for CD_HISTORY_SELECT.
+var CdHistory func() []string
+
+// KeyFuncCdHistorySelect replaces the word on the cursor with the
+// directory selected from the history of `cd` with the fuzzy finder.
+func KeyFuncCdHistorySelect(ctx context.Context, this *Buffer) Result {
+	if CdHistory == nil {
+		return CONTINUE
+	}
+	word, start := this.CurrentWord()
+	query := strings.Replace(word, `"`, "", -1)
+	if result, ok := this.fuzzySelect(CdHistory(), "cd> ", query); ok {
+		this.ReplaceAndRepaint(start, quoteIfSpace(result))
+	}
+	return CONTINUE
+}
@@ -0,0 +1,60 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+)
+
+// HighlightMode is the switch to colour the command-line with
+// Editor.Highlight while typing.
+var HighlightMode = false
+
+// highlight returns true when the command-line should be coloured.
+func (this *Buffer) highlight() bool {
+	return HighlightMode && this.Highlight != nil
+}
+
+// updateColors makes the escape sequences for each character of the text.
+func (this *Buffer) updateColors() {
+	if !this.highlight() {
+		this.colors = nil
+		return
+	}
+	this.colors = this.Highlight(this.String())
+}
+
+// paintRune draws the i-th character with its colour.
+func (this *Buffer) paintRune(i int) {
+	if this.quiet {
+		return
+	}
+	color := ""
+	if i < len(this.colors) {
+		color = this.colors[i]
+	}
+	if color != this.lastColor {
+		io.WriteString(this.Writer, "\x1B[0m")
+		io.WriteString(this.Writer, color)
+		this.lastColor = color
+	}
+	this.putRune(this.Buffer[i])
+}
+
+// resetColor restores the default colour after paintRune.
+func (this *Buffer) resetColor() {
+	if this.lastColor != "" {
+		io.WriteString(this.Writer, "\x1B[0m")
+		this.lastColor = ""
+	}
+}
+
+// repaintHighlight draws the whole line again with the colours
+// after the key-function changed the text.
+func (this *Buffer) repaintHighlight() {
+	this.updateColors()
+	if this.multiLine {
+		return
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG", this.TopColumn+1)
+	this.RepaintAfterPrompt()
+}
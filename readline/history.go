@@ -3,6 +3,7 @@ package readline
 import (
 	"bufio"
 	"context"
+	"sync"
 )
 
 type IHistory interface {
@@ -16,9 +17,41 @@ type Editor struct {
 	Prompt  func() (int, error)
 	Default string
 	Cursor  int
+	// Terminal is the source of key-events. nil means the console.
+	Terminal Terminal
+	// IsIncomplete returns true when Enter should insert a newline
+	// instead of accepting the text in the multi-line mode.
+	IsIncomplete func(text string) bool
+	// ViPrompt draws the mark of the state of the vi-mode ("insert" or
+	// "command") after the prompt and returns its width.
+	// nil means DefaultViPrompt.
+	ViPrompt func(state string) (int, error)
+	// Highlight returns the escape sequences to colour each character
+	// of the text while HighlightMode is true. "" means the default colour.
+	Highlight func(text string) []string
+	// Suggest returns the whole line to suggest for the text typed
+	// while SuggestMode is true. The rest of it is drawn after the cursor.
+	Suggest func(text string) string
+	// RPrompt returns the text drawn at the right end of the row of the prompt.
+	RPrompt func() (string, error)
+	// TransientPrompt draws the short prompt which replaces the prompt of
+	// the line accepted while TransientPromptMode is true, and returns its width.
+	// nil means DefaultTransientPrompt.
+	TransientPrompt func() (int, error)
+	// PromptRows returns the number of the rows of the prompt drawn last
+	// above the row of the cursor. nil means zero.
+	PromptRows func() int
+
+	killRing  []string
+	mutex     sync.Mutex // locked except while ReadLine waits for a key.
+	waiting   *Buffer    // the buffer waiting for a key.
+	redrawing bool
 }
 
 func KeyFuncHistoryUp(ctx context.Context, this *Buffer) Result {
+	if this.moveRow(-1) {
+		return CONTINUE
+	}
 	if this.History.Len() <= 0 {
 		return CONTINUE
 	}
@@ -37,6 +70,9 @@ func KeyFuncHistoryUp(ctx context.Context, this *Buffer) Result {
 }
 
 func KeyFuncHistoryDown(ctx context.Context, this *Buffer) Result {
+	if this.moveRow(1) {
+		return CONTINUE
+	}
 	if this.History.Len() <= 0 {
 		return CONTINUE
 	}
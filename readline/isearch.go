@@ -2,141 +2,249 @@ package readline
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"unicode"
 
 	"github.com/zetamatta/go-getch"
 )
 
-func KeyFuncIncSearch(ctx context.Context, this *Buffer) Result {
-	var searchBuf strings.Builder
-	foundStr := ""
-	searchStr := ""
-	lastDrawWidth := 0
-	lastFoundPos := this.History.Len() - 1
-	this.Backspace(this.Cursor - this.ViewStart)
+// isearch is the state of the incremental search of the history.
+type isearch struct {
+	*Buffer
+	pattern    []rune
+	forward    bool
+	ignoreCase bool
+	regex      bool
+	failing    bool
+	pos        int    // the index of the history found
+	found      string // the history found
+	matchStart int    // the byte offset of the matched span in found
+	matchEnd   int
+	orgText    string // the text before the search
+	orgCursor  int
+}
 
-	update := func() {
-		for i := this.History.Len() - 1; ; i-- {
-			if i < 0 {
-				foundStr = ""
-				break
-			}
-			line := this.History.At(i)
-			if strings.Contains(line, searchStr) {
-				foundStr = line
-				lastFoundPos = i
-				break
-			}
+// match returns the byte offsets of the span of line matched with the pattern.
+func (this *isearch) match(line string) (int, int, bool) {
+	pattern := string(this.pattern)
+	if !this.regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if this.ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, 0, false
+	}
+	loc := rx.FindStringIndex(line)
+	if loc == nil {
+		return 0, 0, false
+	}
+	return loc[0], loc[1], true
+}
+
+// search looks for the history matched from the index `from`.
+// When skipSame is true, the history same as the current one is skipped.
+func (this *isearch) search(from int, skipSame bool) {
+	step := -1
+	if this.forward {
+		step = 1
+	}
+	for i := from; 0 <= i && i < this.History.Len(); i += step {
+		line := this.History.At(i)
+		if skipSame && line == this.found {
+			continue
+		}
+		if start, end, ok := this.match(line); ok {
+			this.pos = i
+			this.found = line
+			this.matchStart = start
+			this.matchEnd = end
+			this.failing = false
+			return
 		}
 	}
-	for {
-		drawStr := fmt.Sprintf("(i-search)[%s]:%s", searchStr, foundStr)
-		drawWidth := 0
-		for _, ch := range drawStr {
-			w1 := GetCharWidth(ch)
-			if drawWidth+w1 >= this.ViewWidth() {
-				break
-			}
-			this.PutRune(ch)
-			drawWidth += w1
+	this.failing = true
+}
+
+// research looks for the history again after the pattern or the options changed.
+func (this *isearch) research() {
+	from := this.pos
+	if this.found == "" {
+		if this.forward {
+			from++
+		} else {
+			from--
+		}
+	}
+	this.search(from, false)
+}
+
+func (this *isearch) label() string {
+	var label strings.Builder
+	label.WriteRune('(')
+	if this.failing {
+		label.WriteString("failing ")
+	}
+	label.WriteString("i-search")
+	if this.forward {
+		label.WriteString("-forward")
+	}
+	if this.ignoreCase {
+		label.WriteString(" nocase")
+	}
+	if this.regex {
+		label.WriteString(" regexp")
+	}
+	label.WriteRune(')')
+	return label.String()
+}
+
+// draw prints the pattern and the history found with the matched span
+// highlighted, and returns the width drawn.
+func (this *isearch) draw() int {
+	drawWidth := 0
+	put := func(ch rune) bool {
+		w1 := GetCharWidth(ch)
+		if drawWidth+w1 >= this.ViewWidth() {
+			return false
+		}
+		this.PutRune(ch)
+		drawWidth += w1
+		return true
+	}
+	for _, ch := range this.label() + "[" + string(this.pattern) + "]:" {
+		if !put(ch) {
+			break
+		}
+	}
+	highlight := !this.failing && this.matchStart < this.matchEnd
+	for i, ch := range this.found {
+		if highlight && i == this.matchStart {
+			io.WriteString(this.Writer, "\x1B[7m")
 		}
-		if lastDrawWidth > drawWidth {
-			n := lastDrawWidth - drawWidth
-			this.PutRunes(' ', n)
-			this.Backspace(n)
+		if highlight && i == this.matchEnd {
+			io.WriteString(this.Writer, "\x1B[0m")
 		}
-		lastDrawWidth = drawWidth
+		if !put(ch) {
+			break
+		}
+	}
+	if highlight {
+		io.WriteString(this.Writer, "\x1B[0m")
+	}
+	this.Eraseline()
+	return drawWidth
+}
+
+// accept replaces the text with the history found and moves the cursor
+// to the matched span.
+func (this *isearch) accept() {
+	if this.found == "" {
+		this.restore(this.orgText, this.orgCursor)
+		return
+	}
+	this.HistoryPointer = this.pos
+	this.restore(this.found, len([]rune(this.found[:this.matchStart])))
+}
+
+func (this *isearch) restore(text string, cursor int) {
+	this.Length = 0
+	this.InsertString(0, text)
+	this.Cursor = cursor
+	this.ViewStart = 0
+	this.RepaintAfterPrompt()
+}
+
+func (this *Buffer) incSearch(ctx context.Context, forward bool) Result {
+	is := &isearch{
+		Buffer:    this,
+		forward:   forward,
+		pos:       this.HistoryPointer,
+		orgText:   this.String(),
+		orgCursor: this.Cursor,
+	}
+	if this.multiLine {
+		this.beginSingleRow()
+	} else {
+		this.Backspace(this.GetWidthBetween(this.ViewStart, this.Cursor))
+	}
+	this.ViewStart = 0
+	this.Cursor = 0
+
+	for {
+		drawWidth := is.draw()
 		io.WriteString(this.Writer, CURSOR_ON)
 		this.Writer.Flush()
-		charcode := getch.Rune()
+		key, err := this.GetKey()
 		io.WriteString(this.Writer, CURSOR_OFF)
 		this.Backspace(drawWidth)
-		switch charcode {
-		case '\b':
-			searchBuf.Reset()
-			// chop last char
-			var lastchar rune
-			for i, c := range searchStr {
-				if i > 0 {
-					searchBuf.WriteRune(lastchar)
-				}
-				lastchar = c
-			}
-			searchStr = searchBuf.String()
-			update()
-		case '\r': // ENTER
-			this.ViewStart = 0
-			this.Length = 0
-			this.Cursor = 0
-			this.ReplaceAndRepaint(0, foundStr)
+		if err != nil {
+			// cancel as Ctrl-G typed.
+			is.restore(is.orgText, is.orgCursor)
 			return CONTINUE
-		case rune('c' & 0x1F), rune('g' & 0x1F), rune(0x1B):
-			w := 0
-			var i int
-			for i = this.ViewStart; i < this.Cursor; i++ {
-				w += GetCharWidth(this.Buffer[i])
-				this.PutRune(this.Buffer[i])
+		}
+		if (key.Shift&getch.ALT_PRESSED) != 0 && (key.Shift&getch.CTRL_PRESSED) == 0 {
+			switch key.Scan {
+			case name2alt[K_ALT_C]:
+				is.ignoreCase = !is.ignoreCase
+				is.research()
+			case name2alt[K_ALT_R]:
+				is.regex = !is.regex
+				is.research()
 			}
-			bs := 0
-			for {
-				if i >= this.Length {
-					if drawWidth > w {
-						this.PutRunes(' ', drawWidth-w)
-						bs += (drawWidth - w)
-					}
-					break
-				}
-				w1 := GetCharWidth(this.Buffer[i])
-				if w+w1 >= this.ViewWidth() {
-					break
-				}
-				this.PutRune(this.Buffer[i])
-				w += w1
-				bs += w1
-				i++
+			continue
+		}
+		switch key.Rune {
+		case 0:
+			switch key.Scan {
+			case name2scan[K_CTRL], name2scan[K_SHIFT], name2scan[K_CAPSLOCK]:
+				continue
 			}
-			this.Backspace(bs)
+			// arrow keys and so on: accept and do the function of the key.
+			is.accept()
+			this.unreadKey(key)
 			return CONTINUE
-		case rune('r' & 0x1F):
-			for i := lastFoundPos - 1; ; i-- {
-				if i < 0 {
-					i = this.History.Len() - 1
-				}
-				if i == lastFoundPos {
-					break
-				}
-				line := this.History.At(i)
-				if strings.Contains(line, searchStr) && foundStr != line {
-					foundStr = line
-					lastFoundPos = i
-					break
-				}
+		case '\b':
+			if len(is.pattern) > 0 {
+				is.pattern = is.pattern[:len(is.pattern)-1]
+				is.research()
 			}
+		case '\r':
+			is.accept()
+			return ENTER
+		case rune(0x1B):
+			is.accept()
+			return CONTINUE
+		case rune('c' & 0x1F), rune('g' & 0x1F):
+			is.restore(is.orgText, is.orgCursor)
+			return CONTINUE
+		case rune('r' & 0x1F):
+			is.forward = false
+			is.search(is.pos-1, true)
 		case rune('s' & 0x1F):
-			for i := lastFoundPos + 1; ; i++ {
-				if i >= this.History.Len() {
-					break
-				}
-				if i == lastFoundPos {
-					break
-				}
-				line := this.History.At(i)
-				if strings.Contains(line, searchStr) && foundStr != line {
-					foundStr = line
-					lastFoundPos = i
-					break
-				}
-			}
+			is.forward = true
+			is.search(is.pos+1, true)
 		default:
-			if unicode.IsControl(charcode) {
-				break
+			if unicode.IsControl(key.Rune) {
+				// other control keys: accept and do the function of the key.
+				is.accept()
+				this.unreadKey(key)
+				return CONTINUE
 			}
-			searchBuf.WriteRune(charcode)
-			searchStr = searchBuf.String()
-			update()
+			is.pattern = append(is.pattern, key.Rune)
+			is.research()
 		}
 	}
 }
+
+func KeyFuncIncSearch(ctx context.Context, this *Buffer) Result {
+	return this.incSearch(ctx, false)
+}
+
+func KeyFuncIncSearchForward(ctx context.Context, this *Buffer) Result {
+	return this.incSearch(ctx, true)
+}
@@ -8,10 +8,13 @@ import (
 	"unicode"
 
 	"github.com/atotto/clipboard"
-	"github.com/zetamatta/go-getch"
 )
 
 func KeyFuncEnter(ctx context.Context, this *Buffer) Result { // Ctrl-M
+	if this.multiLine && this.IsIncomplete != nil && this.IsIncomplete(this.String()) {
+		this.Unicode = '\n'
+		return KeyFuncInsertSelf(ctx, this)
+	}
 	return ENTER
 }
 
@@ -45,6 +48,9 @@ func KeyFuncBackword(ctx context.Context, this *Buffer) Result { // Ctrl-B
 }
 
 func KeyFuncTail(ctx context.Context, this *Buffer) Result { // Ctrl-E
+	if this.acceptSuggestion(false) {
+		return CONTINUE
+	}
 	allength := this.GetWidthBetween(this.ViewStart, this.Length)
 	if allength < this.ViewWidth() {
 		for ; this.Cursor < this.Length; this.Cursor++ {
@@ -74,6 +80,9 @@ func KeyFuncTail(ctx context.Context, this *Buffer) Result { // Ctrl-E
 }
 
 func KeyFuncForward(ctx context.Context, this *Buffer) Result { // Ctrl-F
+	if this.acceptSuggestion(false) {
+		return CONTINUE
+	}
 	if this.Cursor >= this.Length {
 		return CONTINUE
 	}
@@ -153,7 +162,7 @@ func KeyFuncInsertReport(ctx context.Context, this *Buffer) Result {
 }
 
 func KeyFuncClearAfter(ctx context.Context, this *Buffer) Result {
-	clipboard.WriteAll(this.SubString(this.Cursor, this.Length))
+	this.kill(this.SubString(this.Cursor, this.Length))
 
 	this.Eraseline()
 	this.Length = this.Cursor
@@ -176,7 +185,7 @@ func KeyFuncWordRubout(ctx context.Context, this *Buffer) Result {
 		this.Cursor--
 	}
 	i := this.CurrentWordTop()
-	clipboard.WriteAll(this.SubString(i, org_cursor))
+	this.kill(this.SubString(i, org_cursor))
 	keta := this.Delete(i, org_cursor-i)
 	if i >= this.ViewStart {
 		this.Backspace(keta)
@@ -190,7 +199,7 @@ func KeyFuncWordRubout(ctx context.Context, this *Buffer) Result {
 
 func KeyFuncClearBefore(ctx context.Context, this *Buffer) Result {
 	keta := this.GetWidthBetween(this.ViewStart, this.Cursor)
-	clipboard.WriteAll(this.SubString(0, this.Cursor))
+	this.kill(this.SubString(0, this.Cursor))
 	this.Delete(0, this.Cursor)
 	this.Backspace(keta)
 	this.Cursor = 0
@@ -214,23 +223,13 @@ func KeyFuncRepaintOnNewline(ctx context.Context, this *Buffer) Result {
 func KeyFuncQuotedInsert(ctx context.Context, this *Buffer) Result {
 	io.WriteString(this.Writer, CURSOR_ON)
 	defer io.WriteString(this.Writer, CURSOR_OFF)
-	for {
-		this.Writer.Flush()
-		e := getch.All()
-		if e.Key != nil && e.Key.Rune != 0 {
-			this.Unicode = e.Key.Rune
-			return KeyFuncInsertSelf(ctx, this)
-		}
-	}
-}
-
-func KeyFuncPaste(ctx context.Context, this *Buffer) Result {
-	text, err := clipboard.ReadAll()
+	this.Writer.Flush()
+	ch, err := this.GetRune()
 	if err != nil {
 		return CONTINUE
 	}
-	this.InsertAndRepaint(text)
-	return CONTINUE
+	this.Unicode = ch
+	return KeyFuncInsertSelf(ctx, this)
 }
 
 func KeyFuncPasteQuote(ctx context.Context, this *Buffer) Result {
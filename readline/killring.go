@@ -0,0 +1,68 @@
+package readline
+
+import (
+	"context"
+
+	"github.com/atotto/clipboard"
+)
+
+// KillRingMax is the number of texts the kill-ring holds.
+var KillRingMax = 60
+
+// kill pushes the text removed by KILL_LINE, UNIX_WORD_RUBOUT and so on
+// into the kill-ring and copies it to the clipboard.
+func (this *Buffer) kill(text string) {
+	if text == "" {
+		return
+	}
+	this.pushKillRing(text)
+	clipboard.WriteAll(text)
+}
+
+func (this *Buffer) pushKillRing(text string) {
+	this.killRing = append(this.killRing, text)
+	if len(this.killRing) > KillRingMax {
+		this.killRing = this.killRing[len(this.killRing)-KillRingMax:]
+	}
+}
+
+// currentKill returns the newest text of the kill-ring.
+// The text copied into the clipboard by other applications is pushed first.
+func (this *Buffer) currentKill() (string, bool) {
+	if text, err := clipboard.ReadAll(); err == nil && text != "" {
+		if len(this.killRing) <= 0 || this.killRing[len(this.killRing)-1] != text {
+			this.pushKillRing(text)
+		}
+	}
+	if len(this.killRing) <= 0 {
+		return "", false
+	}
+	return this.killRing[len(this.killRing)-1], true
+}
+
+func KeyFuncPaste(ctx context.Context, this *Buffer) Result {
+	text, ok := this.currentKill()
+	if !ok {
+		return CONTINUE
+	}
+	start := this.Cursor
+	this.InsertAndRepaint(text)
+	this.yanked = true
+	this.yankStart = start
+	this.yankIndex = len(this.killRing) - 1
+	return CONTINUE
+}
+
+// KeyFuncYankPop replaces the text just yanked with the older one in the kill-ring.
+func KeyFuncYankPop(ctx context.Context, this *Buffer) Result {
+	if !this.lastWasYank || len(this.killRing) <= 0 {
+		return CONTINUE
+	}
+	this.yankIndex--
+	if this.yankIndex < 0 {
+		this.yankIndex = len(this.killRing) - 1
+	}
+	this.ReplaceAndRepaint(this.yankStart, this.killRing[this.yankIndex])
+	this.yanked = true
+	return CONTINUE
+}
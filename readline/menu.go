@@ -0,0 +1,233 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// shiftPressed is SHIFT_PRESSED of KeyEvent.Shift (Shift-Tab)
+const shiftPressed = 0x10
+
+// MenuHeight is the maximum rows of the menu drawn under the line.
+var MenuHeight = 10
+
+// MenuItem is a candidate of the menu.
+type MenuItem struct {
+	Value   string // the text to replace the word with
+	Display string // the text shown in the menu
+}
+
+type menuView struct {
+	items    []MenuItem
+	selected int // -1 means no item is selected.
+	offset   int // the first row drawn
+	rows     int
+	cols     int
+	width    int // the width of one column
+}
+
+// layout arranges the items from top to bottom and then left to right
+// like `ls`.
+func (m *menuView) layout(termWidth int) {
+	m.width = 1
+	for _, item := range m.items {
+		if w := GetStringWidth(item.Display) + 2; w > m.width {
+			m.width = w
+		}
+	}
+	if m.width > termWidth-1 {
+		m.width = termWidth - 1
+	}
+	m.cols = (termWidth - 1) / m.width
+	if m.cols < 1 {
+		m.cols = 1
+	}
+	m.rows = (len(m.items) + m.cols - 1) / m.cols
+	m.selected = -1
+	m.offset = 0
+}
+
+// move selects the item delta away from the current one.
+func (m *menuView) move(delta int) {
+	n := len(m.items)
+	if m.selected < 0 {
+		if delta > 0 {
+			m.selected = 0
+		} else {
+			m.selected = n - 1
+		}
+		return
+	}
+	m.selected = ((m.selected+delta)%n + n) % n
+}
+
+// drawItem draws the i-th item and pads it to the width of the column.
+func (m *menuView) drawItem(w io.Writer, i int) {
+	if i == m.selected {
+		io.WriteString(w, "\x1B[7m")
+	}
+	col := 0
+	for _, ch := range m.items[i].Display {
+		cw := GetCharWidth(ch)
+		if col+cw > m.width-2 {
+			break
+		}
+		if ch < ' ' {
+			ch = ' '
+		}
+		fmt.Fprintf(w, "%c", ch)
+		col += cw
+	}
+	io.WriteString(w, "\x1B[0m")
+	if i+m.rows < len(m.items) {
+		fmt.Fprintf(w, "%*s", m.width-col, "")
+	}
+}
+
+// drawMenu draws the menu under the last row of the text within height rows
+// and returns the number of the rows drawn.
+func (this *Buffer) drawMenu(m *menuView, height int) int {
+	if this.multiLine {
+		this.moveToLastRow()
+	}
+	if m.selected >= 0 {
+		row := m.selected % m.rows
+		if row < m.offset {
+			m.offset = row
+		} else if row >= m.offset+height {
+			m.offset = row - height + 1
+		}
+	}
+	drawn := 0
+	for row := m.offset; row < m.rows && drawn < height; row++ {
+		io.WriteString(this.Writer, "\r\n")
+		for col := 0; col < m.cols; col++ {
+			i := col*m.rows + row
+			if i >= len(m.items) {
+				break
+			}
+			m.drawItem(this.Writer, i)
+		}
+		io.WriteString(this.Writer, "\x1B[0K")
+		drawn++
+	}
+	io.WriteString(this.Writer, "\x1B[0J")
+	return drawn
+}
+
+// returnFromMenu moves the cursor back from rows under the last row of the text.
+func (this *Buffer) returnFromMenu(rows int) {
+	var column int
+	if this.multiLine {
+		cursorRow, cursorCol := this.locate(this.Cursor)
+		rows += this.lastRow - cursorRow
+		this.cursorRow = cursorRow
+		column = cursorCol + 1
+	} else {
+		column = this.TopColumn + this.GetWidthBetween(this.ViewStart, this.Cursor) + 1
+	}
+	if rows > 0 {
+		fmt.Fprintf(this.Writer, "\x1B[%dA", rows)
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG", column)
+}
+
+// replaceWord replaces the text from pos to the cursor and draws the line
+// while the menu is shown.
+func (this *Buffer) replaceWord(pos int, text string) {
+	this.ReplaceAndRepaint(pos, text)
+	if this.multiLine {
+		this.updateColors()
+		this.quiet = false
+		this.repaintMultiLine()
+		this.quiet = true
+	} else if this.highlight() {
+		this.repaintHighlight()
+	}
+}
+
+// SelectMenu shows items in the columns under the line and replaces
+// the word from pos to the cursor with the item selected by Tab, Shift-Tab
+// and the arrow keys. Typing a character or Backspace edits the original word
+// and narrows the items with narrow(the word). Enter accepts the item and Esc restores
+// the original word. The other keys accept it and are given to the editor.
+func (this *Buffer) SelectMenu(pos int, items []MenuItem, narrow func(word string) []MenuItem) {
+	if len(items) <= 0 {
+		return
+	}
+	original := this.SubString(pos, this.Cursor)
+	word := []rune(original)
+	m := &menuView{items: items}
+	m.layout(this.TermWidth)
+	m.move(1)
+	this.replaceWord(pos, m.items[m.selected].Value)
+loop:
+	for {
+		_, height := this.terminal().Size()
+		rows := MenuHeight
+		if limit := height - 2 - this.lastRow; rows > limit {
+			rows = limit
+		}
+		if rows < 1 {
+			rows = 1
+		}
+		this.returnFromMenu(this.drawMenu(m, rows))
+		this.Writer.Flush()
+
+		key, err := this.GetKey()
+		if err != nil {
+			break
+		}
+		delta := 0
+		switch {
+		case key.Rune == '\t' && (key.Shift&shiftPressed) != 0:
+			delta = -1
+		case key.Rune == '\t':
+			delta = 1
+		case key.Rune == 0 && key.Scan == name2scan[K_DOWN]:
+			delta = 1
+		case key.Rune == 0 && key.Scan == name2scan[K_UP]:
+			delta = -1
+		case key.Rune == 0 && key.Scan == name2scan[K_RIGHT]:
+			delta = m.rows
+		case key.Rune == 0 && key.Scan == name2scan[K_LEFT]:
+			delta = -m.rows
+		case key.Rune == 0 && (key.Scan == name2scan[K_CTRL] ||
+			key.Scan == name2scan[K_SHIFT] ||
+			key.Scan == name2scan[K_CAPSLOCK]):
+			continue
+		case key.Rune == '\r' || key.Rune == '\n':
+			break loop
+		case key.Rune == rune(0x1B) || key.Rune == rune('g'&0x1F):
+			this.replaceWord(pos, original)
+			break loop
+		case key.Rune == '\b' || key.Rune == '\x7F':
+			if len(word) <= 0 {
+				break loop
+			}
+			word = word[:len(word)-1]
+		case key.Rune != 0 && !unicode.IsControl(key.Rune):
+			word = append(word, key.Rune)
+		default:
+			this.unreadKey(key)
+			break loop
+		}
+		if delta != 0 {
+			m.move(delta)
+			this.replaceWord(pos, m.items[m.selected].Value)
+			continue
+		}
+		this.replaceWord(pos, string(word))
+		m.items = narrow(string(word))
+		if len(m.items) <= 0 {
+			break
+		}
+		m.layout(this.TermWidth)
+	}
+	if this.multiLine {
+		this.moveToLastRow()
+	}
+	io.WriteString(this.Writer, "\r\n\x1B[0J")
+	this.returnFromMenu(1)
+}
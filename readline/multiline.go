@@ -0,0 +1,135 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+)
+
+// MultiLineMode is the switch to wrap the long line at the width of
+// the terminal instead of scrolling it horizontally.
+// In this mode, Up/Down move the cursor between the display rows and
+// Enter inserts a newline while Editor.IsIncomplete returns true.
+var MultiLineMode = false
+
+// maxViewWidth is ViewWidth while the key-functions run in the multi-line mode,
+// so that they never scroll.
+const maxViewWidth = 1 << 30
+
+// locate returns the row and the column where the pos-th character is drawn
+// in the multi-line mode. The row of the prompt is zero.
+func (this *Buffer) locate(pos int) (row, col int) {
+	col = this.TopColumn
+	for i := 0; i < pos && i < this.Length; i++ {
+		ch := this.Buffer[i]
+		if ch == '\n' {
+			row++
+			col = 0
+			continue
+		}
+		w := GetCharWidth(ch)
+		if col+w > this.TermWidth-1 {
+			row++
+			col = 0
+		}
+		col += w
+	}
+	return
+}
+
+// indexAt returns the position of the character drawn at (row,col)
+// or the nearest one at the left of it on the same row.
+func (this *Buffer) indexAt(row, col int) int {
+	result := -1
+	for i := 0; i <= this.Length; i++ {
+		r, c := this.locate(i)
+		if r > row {
+			break
+		}
+		if r == row && (c <= col || result < 0) {
+			result = i
+		}
+	}
+	if result < 0 {
+		return this.Length
+	}
+	return result
+}
+
+// repaintMultiLine draws the whole text from the row of the prompt
+// and moves the cursor.
+func (this *Buffer) repaintMultiLine() {
+	if this.cursorRow > 0 {
+		fmt.Fprintf(this.Writer, "\x1B[%dA", this.cursorRow)
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG", this.TopColumn+1)
+	row, col := 0, this.TopColumn
+	for i := 0; i < this.Length; i++ {
+		ch := this.Buffer[i]
+		if ch == '\n' {
+			this.resetColor()
+			io.WriteString(this.Writer, "\x1B[0K\r\n")
+			row++
+			col = 0
+			continue
+		}
+		w := GetCharWidth(ch)
+		if col+w > this.TermWidth-1 {
+			this.resetColor()
+			io.WriteString(this.Writer, "\x1B[0K\r\n")
+			row++
+			col = 0
+		}
+		this.paintRune(i)
+		col += w
+	}
+	this.resetColor()
+	if this.suggestion != "" && this.Cursor == this.Length {
+		this.drawSuggestion(this.TermWidth - 1 - col)
+	}
+	io.WriteString(this.Writer, "\x1B[0J")
+	this.lastRow = row
+
+	cursorRow, cursorCol := this.locate(this.Cursor)
+	if row > cursorRow {
+		fmt.Fprintf(this.Writer, "\x1B[%dA", row-cursorRow)
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG", cursorCol+1)
+	this.cursorRow = cursorRow
+}
+
+// moveToLastRow moves the cursor to the last row drawn
+// before leaving the editor in the multi-line mode.
+func (this *Buffer) moveToLastRow() {
+	if this.lastRow > this.cursorRow {
+		fmt.Fprintf(this.Writer, "\x1B[%dB", this.lastRow-this.cursorRow)
+	}
+	this.cursorRow = this.lastRow
+}
+
+// beginSingleRow clears the text and moves the cursor just after the prompt,
+// so that the key-functions (incremental search) can draw in one row by themselves.
+func (this *Buffer) beginSingleRow() {
+	if this.cursorRow > 0 {
+		fmt.Fprintf(this.Writer, "\x1B[%dA", this.cursorRow)
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG\x1B[0J", this.TopColumn+1)
+	this.cursorRow = 0
+	this.lastRow = 0
+	this.ViewStart = 0
+	this.quiet = false
+}
+
+// moveRow moves the cursor to the next (delta=1) or the previous (delta=-1)
+// display row. It returns false when there is no such row.
+func (this *Buffer) moveRow(delta int) bool {
+	if !this.multiLine {
+		return false
+	}
+	row, col := this.locate(this.Cursor)
+	lastRow, _ := this.locate(this.Length)
+	if row+delta < 0 || row+delta > lastRow {
+		return false
+	}
+	this.Cursor = this.indexAt(row+delta, col)
+	return true
+}
@@ -0,0 +1,127 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// TransientPromptMode is the switch to replace the prompt of the line
+// accepted with the short one (Editor.TransientPrompt).
+var TransientPromptMode = false
+
+// DefaultTransientPrompt is the transient prompt when Editor.TransientPrompt is nil.
+const DefaultTransientPrompt = "> "
+
+var rxEscape = regexp.MustCompile("\x1B\\[[0-9;?]*[A-Za-z]")
+
+// promptRows returns the number of rows of the prompt above the row of the cursor.
+func (this *Buffer) promptRows() int {
+	if this.PromptRows == nil {
+		return 0
+	}
+	return this.PromptRows()
+}
+
+// updateRPrompt gets the text of the right prompt.
+func (this *Buffer) updateRPrompt() {
+	this.rprompt = ""
+	this.rpromptWidth = 0
+	if this.RPrompt == nil {
+		return
+	}
+	this.Writer.Flush()
+	rprompt, err := this.RPrompt()
+	if err != nil {
+		rprompt = err.Error()
+	}
+	this.rprompt = rprompt
+	this.rpromptWidth = GetStringWidth(rxEscape.ReplaceAllString(rprompt, ""))
+}
+
+// drawRPrompt draws the right prompt at the right end of the row of the
+// prompt while the text does not reach it. The cursor does not move.
+func (this *Buffer) drawRPrompt() {
+	if this.rprompt == "" {
+		return
+	}
+	var used int
+	if this.multiLine {
+		if this.lastRow > 0 {
+			return
+		}
+		_, used = this.locate(this.Length)
+	} else {
+		used = this.TopColumn + this.GetWidthBetween(this.ViewStart, this.Length)
+	}
+	used += GetStringWidth(this.suggestion)
+	column := this.TermWidth - this.rpromptWidth - 1
+	if column <= used+1 {
+		return
+	}
+	fmt.Fprintf(this.Writer, "\x1B[s\x1B[%dG%s\x1B[0m\x1B[u", column+1, this.rprompt)
+}
+
+// goPromptTop moves the cursor to the top of the prompt and clears the screen after it.
+func (this *Buffer) goPromptTop() {
+	rows := this.promptRows()
+	if this.multiLine {
+		rows += this.cursorRow
+	}
+	io.WriteString(this.Writer, "\r")
+	if rows > 0 {
+		fmt.Fprintf(this.Writer, "\x1B[%dA", rows)
+	}
+	io.WriteString(this.Writer, "\x1B[0J")
+}
+
+// redraw draws the prompt and the text again.
+func (this *Buffer) redraw() {
+	this.goPromptTop()
+	this.RepaintAll()
+	this.updateRPrompt()
+	if !this.multiLine && this.suggestion != "" {
+		width := this.ViewWidth() - this.GetWidthBetween(this.ViewStart, this.Length)
+		this.Backspace(this.drawSuggestion(width))
+	}
+	this.drawRPrompt()
+}
+
+// Redraw draws the prompt and the line being edited again. It is for the
+// goroutines which have computed the prompt in the background.
+// It does nothing unless the editor is waiting for a key.
+func (session *Editor) Redraw() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if this := session.waiting; this != nil {
+		session.redrawing = true
+		this.redraw()
+		session.redrawing = false
+		this.Writer.Flush()
+	}
+}
+
+// Redrawing returns true while Redraw is calling Prompt, so that Prompt
+// can tell it from the prompt of the new line.
+func (session *Editor) Redrawing() bool {
+	return session.redrawing
+}
+
+// collapsePrompt replaces the prompt and the text of the line accepted
+// with the transient prompt and the text.
+func (this *Buffer) collapsePrompt() {
+	this.goPromptTop()
+	this.Writer.Flush()
+	if this.TransientPrompt == nil {
+		io.WriteString(this.Writer, DefaultTransientPrompt)
+	} else if _, err := this.TransientPrompt(); err != nil {
+		fmt.Fprintf(this.Writer, "%s ", err.Error())
+	}
+	for _, ch := range this.String() {
+		if ch == '\n' {
+			io.WriteString(this.Writer, "\r\n")
+		} else {
+			this.putRune(ch)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"strings"
 
-	"github.com/zetamatta/go-box"
 	"github.com/zetamatta/go-getch"
 )
 
@@ -58,28 +57,30 @@ func (this KeyGoFuncT) String() string {
 }
 
 var keyMap = map[rune]KeyFuncT{
-	name2char[K_CTRL_A]: name2func(F_BEGINNING_OF_LINE),
-	name2char[K_CTRL_B]: name2func(F_BACKWARD_CHAR),
-	name2char[K_CTRL_C]: name2func(F_INTR),
-	name2char[K_CTRL_D]: name2func(F_DELETE_OR_ABORT),
-	name2char[K_CTRL_E]: name2func(F_END_OF_LINE),
-	name2char[K_CTRL_F]: name2func(F_FORWARD_CHAR),
-	name2char[K_CTRL_H]: name2func(F_BACKWARD_DELETE_CHAR),
-	name2char[K_CTRL_K]: name2func(F_KILL_LINE),
-	name2char[K_CTRL_L]: name2func(F_CLEAR_SCREEN),
-	name2char[K_CTRL_M]: name2func(F_ACCEPT_LINE),
-	name2char[K_CTRL_R]: name2func(F_ISEARCH_BACKWARD),
-	name2char[K_CTRL_U]: name2func(F_UNIX_LINE_DISCARD),
-	name2char[K_CTRL_Y]: name2func(F_YANK),
-	name2char[K_DELETE]: name2func(F_DELETE_CHAR),
-	name2char[K_ENTER]:  name2func(F_ACCEPT_LINE),
-	name2char[K_ESCAPE]: name2func(F_KILL_WHOLE_LINE),
-	name2char[K_CTRL_N]: name2func(F_HISTORY_DOWN),
-	name2char[K_CTRL_P]: name2func(F_HISTORY_UP),
-	name2char[K_CTRL_Q]: name2func(F_QUOTED_INSERT),
-	name2char[K_CTRL_T]: name2func(F_SWAPCHAR),
-	name2char[K_CTRL_V]: name2func(F_QUOTED_INSERT),
-	name2char[K_CTRL_W]: name2func(F_UNIX_WORD_RUBOUT),
+	name2char[K_CTRL_A]:          name2func(F_BEGINNING_OF_LINE),
+	name2char[K_CTRL_B]:          name2func(F_BACKWARD_CHAR),
+	name2char[K_CTRL_C]:          name2func(F_INTR),
+	name2char[K_CTRL_D]:          name2func(F_DELETE_OR_ABORT),
+	name2char[K_CTRL_E]:          name2func(F_END_OF_LINE),
+	name2char[K_CTRL_F]:          name2func(F_FORWARD_CHAR),
+	name2char[K_CTRL_H]:          name2func(F_BACKWARD_DELETE_CHAR),
+	name2char[K_CTRL_K]:          name2func(F_KILL_LINE),
+	name2char[K_CTRL_L]:          name2func(F_CLEAR_SCREEN),
+	name2char[K_CTRL_M]:          name2func(F_ACCEPT_LINE),
+	name2char[K_CTRL_R]:          name2func(F_ISEARCH_BACKWARD),
+	name2char[K_CTRL_S]:          name2func(F_ISEARCH_FORWARD),
+	name2char[K_CTRL_U]:          name2func(F_UNIX_LINE_DISCARD),
+	name2char[K_CTRL_Y]:          name2func(F_YANK),
+	name2char[K_DELETE]:          name2func(F_DELETE_CHAR),
+	name2char[K_ENTER]:           name2func(F_ACCEPT_LINE),
+	name2char[K_ESCAPE]:          name2func(F_KILL_WHOLE_LINE),
+	name2char[K_CTRL_N]:          name2func(F_HISTORY_DOWN),
+	name2char[K_CTRL_P]:          name2func(F_HISTORY_UP),
+	name2char[K_CTRL_Q]:          name2func(F_QUOTED_INSERT),
+	name2char[K_CTRL_T]:          name2func(F_SWAPCHAR),
+	name2char[K_CTRL_V]:          name2func(F_QUOTED_INSERT),
+	name2char[K_CTRL_W]:          name2func(F_UNIX_WORD_RUBOUT),
+	name2char[K_CTRL_UNDERSCORE]: name2func(F_UNDO),
 }
 
 var scanMap = map[uint16]KeyFuncT{
@@ -95,8 +96,14 @@ var scanMap = map[uint16]KeyFuncT{
 }
 
 var altMap = map[uint16]KeyFuncT{
-	name2alt[K_ALT_V]: name2func(F_YANK),
-	name2alt[K_ALT_Y]: name2func(F_YANK_WITH_QUOTE),
+	name2alt[K_ALT_B]:         name2func(F_BACKWARD_WORD),
+	name2alt[K_ALT_BACKSPACE]: name2func(F_BACKWARD_KILL_WORD),
+	name2alt[K_ALT_D]:         name2func(F_KILL_WORD),
+	name2alt[K_ALT_F]:         name2func(F_FORWARD_WORD),
+	name2alt[K_ALT_T]:         name2func(F_TRANSPOSE_WORDS),
+	name2alt[K_ALT_U]:         name2func(F_UPCASE_WORD),
+	name2alt[K_ALT_V]:         name2func(F_YANK),
+	name2alt[K_ALT_Y]:         name2func(F_YANK_WITH_QUOTE),
 }
 
 func normWord(src string) string {
@@ -187,16 +194,19 @@ func (session *Editor) ReadLine(ctx context.Context) (string, error) {
 	if session.History == nil {
 		session.History = new(EmptyHistory)
 	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 	this := Buffer{
 		Editor:         session,
 		Buffer:         make([]rune, 20),
 		HistoryPointer: session.History.Len(),
 	}
 
-	this.TermWidth, _ = box.GetScreenBufferInfo().ViewSize()
+	this.TermWidth, _ = session.terminal().Size()
 
+	this.viMode = ViMode
 	var err1 error
-	this.TopColumn, err1 = session.Prompt()
+	this.TopColumn, err1 = this.printPrompt()
 	if err1 != nil {
 		// unable to get prompt-string.
 		fmt.Fprintf(this.Writer, "%s\n$ ", err1.Error())
@@ -206,32 +216,61 @@ func (session *Editor) ReadLine(ctx context.Context) (string, error) {
 		io.WriteString(this.Writer, "\n")
 		this.TopColumn = 0
 	}
+	this.updateRPrompt()
 	this.InsertString(0, session.Default)
 	if this.Cursor > this.Length {
 		this.Cursor = this.Length
 	}
-	this.RepaintAfterPrompt()
+	this.multiLine = MultiLineMode
+	this.updateColors()
+	if this.multiLine {
+		this.repaintMultiLine()
+	} else {
+		this.RepaintAfterPrompt()
+	}
+	this.drawRPrompt()
 
 	if FlushBeforeReadline {
-		getch.Flush()
+		session.terminal().Flush()
 	}
 
 	cursorOnSwitch := false
 	for {
-		var e getch.Event
+		var e Event
 		if !cursorOnSwitch {
 			io.WriteString(this.Writer, CURSOR_ON)
 			cursorOnSwitch = true
 		}
 		this.Writer.Flush()
 		for e.Key == nil {
-			e = getch.All()
+			var err error
+			if len(this.pending) > 0 {
+				e, err = this.readEvent()
+			} else {
+				session.waiting = &this
+				session.mutex.Unlock()
+				e, err = this.readEvent()
+				session.mutex.Lock()
+				session.waiting = nil
+			}
+			if err != nil {
+				if this.multiLine {
+					this.moveToLastRow()
+				}
+				this.Writer.WriteByte('\n')
+				return this.String(), err
+			}
 			if e.Resize != nil {
-				w := int(e.Resize.Width)
+				w := e.Resize.Width
 				if this.TermWidth != w {
 					this.TermWidth = w
-					fmt.Fprintf(this.Writer, "\x1B[%dG", this.TopColumn+1)
-					this.RepaintAfterPrompt()
+					if this.multiLine {
+						this.repaintMultiLine()
+					} else {
+						fmt.Fprintf(this.Writer, "\x1B[%dG", this.TopColumn+1)
+						this.RepaintAfterPrompt()
+					}
+					this.drawRPrompt()
 				}
 			}
 		}
@@ -247,7 +286,10 @@ func (session *Editor) ReadLine(ctx context.Context) (string, error) {
 				continue
 			}
 		} else if this.Unicode != 0 {
-			f, ok = keyMap[this.Unicode]
+			f, ok = this.viKeyFunc()
+			if !ok {
+				f, ok = keyMap[this.Unicode]
+			}
 			if !ok {
 				//f = KeyFuncInsertReport
 				f = &KeyGoFuncT{Func: KeyFuncInsertSelf, Name: fmt.Sprintf("%v", this.Unicode)}
@@ -262,7 +304,35 @@ func (session *Editor) ReadLine(ctx context.Context) (string, error) {
 			io.WriteString(this.Writer, CURSOR_OFF)
 			cursorOnSwitch = false
 		}
+		this.quiet = this.multiLine
+		this.lastWasYank, this.yanked = this.yanked, false
+		before, beforeCursor := this.String(), this.Cursor
+		this.viBeforeCommand(e)
 		rc := f.Call(ctx, &this)
+		this.viAfterCommand()
+		this.recordUndo(before, beforeCursor)
+		this.quiet = false
+		if this.highlight() && this.String() != before {
+			this.repaintHighlight()
+		}
+		if rc == CONTINUE {
+			this.updateSuggestion()
+		} else {
+			this.eraseSuggestion()
+		}
+		if this.multiLine {
+			this.ViewStart = 0
+			if rc == CONTINUE {
+				this.repaintMultiLine()
+			} else {
+				this.moveToLastRow()
+			}
+		}
+		if rc == CONTINUE {
+			this.drawRPrompt()
+		} else if rc == ENTER && TransientPromptMode {
+			this.collapsePrompt()
+		}
 		if rc != CONTINUE {
 			this.Writer.WriteByte('\n')
 			if !cursorOnSwitch {
@@ -0,0 +1,483 @@
+package readline
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newScriptedEditor(term *ScriptedTerminal, output io.Writer) *Editor {
+	return &Editor{
+		Writer:   bufio.NewWriter(output),
+		Terminal: term,
+		Prompt: func() (int, error) {
+			io.WriteString(output, "$ ")
+			return 2, nil
+		},
+	}
+}
+
+var rxEscapeSequence = regexp.MustCompile("\x1B\\[[^A-Za-z]*[A-Za-z]")
+
+func screenText(output string) string {
+	return rxEscapeSequence.ReplaceAllString(output, "")
+}
+
+// keyTerminal returns the terminal which sends the keys: the names for
+// ScriptedTerminal.Key, "S_TAB" (Shift+Tab) or the text to type.
+func keyTerminal(width int, keys []string) *ScriptedTerminal {
+	term := NewScriptedTerminal(width, 25)
+	for _, key := range keys {
+		if key == "S_TAB" {
+			term.Events = append(term.Events,
+				Event{Key: &KeyEvent{Rune: '\t', Shift: shiftPressed}})
+		} else if err := term.Key(key); err != nil {
+			term.Type(key)
+		}
+	}
+	return term
+}
+
+// testReadLine reads a line from the editor made by newScriptedEditor
+// and setup (nil is allowed) with the keys, and tests that it is expect.
+// It returns the output to the screen.
+func testReadLine(t *testing.T, width int, keys []string, expect string, setup func(*Editor)) string {
+	t.Helper()
+	var output strings.Builder
+	editor := newScriptedEditor(keyTerminal(width, keys), &output)
+	if setup != nil {
+		setup(editor)
+	}
+	result, err := editor.ReadLine(context.Background())
+	if err != nil {
+		t.Fatalf("%v: %s", keys, err.Error())
+	}
+	if result != expect {
+		t.Fatalf("%v: %q != %q", keys, result, expect)
+	}
+	return output.String()
+}
+
+func TestScriptedTerminal(t *testing.T) {
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"abc", "LEFT", "X", "ENTER"}, "abXc"},
+		{[]string{"hello", "C_A", "DEL", "C_E", "!", "C_M"}, "ello!"},
+		{[]string{"foo bar", "C_W", "C_A", "C_K", "baz", "ENTER"}, "baz"},
+		{[]string{"a", "C_V", "C_B", "ENTER"}, "a\x02"},
+	}
+	for _, test := range tests {
+		output := testReadLine(t, 80, test.keys, test.expect, nil)
+		if !strings.HasPrefix(output, "$ ") {
+			t.Fatalf("%v: prompt is not printed: %q", test.keys, output)
+		}
+	}
+}
+
+func TestScriptedTerminalEOF(t *testing.T) {
+	term := NewScriptedTerminal(80, 25)
+	term.Type("abc")
+	var output strings.Builder
+	result, err := newScriptedEditor(term, &output).ReadLine(context.Background())
+	if err != io.EOF {
+		t.Fatalf("err == %v (expect io.EOF)", err)
+	}
+	if result != "abc" {
+		t.Fatalf("`%s` != `abc`", result)
+	}
+	if screen := screenText(output.String()); screen != "$ abc\n" {
+		t.Fatalf("screen: %q != %q", screen, "$ abc\n")
+	}
+}
+
+func TestMultiLineMode(t *testing.T) {
+	MultiLineMode = true
+	defer func() { MultiLineMode = false }()
+
+	tests := []struct {
+		width  int
+		keys   []string
+		expect string
+	}{
+		{80, []string{`echo "a`, "ENTER", `b"`, "ENTER"}, "echo \"a\nb\""},
+		{80, []string{`ab"`, "ENTER", `cd"`, "UP", "X", "ENTER"}, "aXb\"\ncd\""},
+		{10, []string{"abcdefghijkl", "UP", "X", "DOWN", "Y", "ENTER"}, "abcXdefghijklY"},
+	}
+	for _, test := range tests {
+		testReadLine(t, test.width, test.keys, test.expect, func(editor *Editor) {
+			editor.IsIncomplete = func(text string) bool {
+				return strings.Count(text, `"`)%2 != 0
+			}
+		})
+	}
+}
+
+func TestKillRingUndoAndWords(t *testing.T) {
+	BindKeySymbol("C_X", F_REDO)
+	BindKeySymbol("F2", F_YANK_POP)
+	BindKeySymbol("F3", F_SET_MARK)
+	BindKeySymbol("F4", F_EXCHANGE_POINT_AND_MARK)
+	defer func() {
+		delete(keyMap, name2char[K_CTRL_X])
+		delete(scanMap, name2scan[K_F2])
+		delete(scanMap, name2scan[K_F3])
+		delete(scanMap, name2scan[K_F4])
+	}()
+
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"foo bar baz", "M_B", "M_B", "X", "ENTER"}, "foo Xbar baz"},
+		{[]string{"foo bar baz", "C_A", "M_F", "M_D", "ENTER"}, "foo baz"},
+		{[]string{"foo bar", "C_A", "M_U", "ENTER"}, "FOO bar"},
+		{[]string{"foo bar", "C_A", "M_F", "M_T", "ENTER"}, "bar foo"},
+		{[]string{"abc def", "C_UNDERSCORE", "ENTER"}, ""},
+		{[]string{"abc", "C_A", "C_K", "def", "C_UNDERSCORE", "C_UNDERSCORE", "ENTER"}, "abc"},
+		{[]string{"abc", "C_UNDERSCORE", "C_X", "ENTER"}, "abc"},
+		{[]string{"one two", "C_W", "C_W", "C_Y", "F2", "ENTER"}, "two"},
+		{[]string{"abc", "C_A", "F3", "C_E", "F4", "X", "ENTER"}, "Xabc"},
+	}
+	for _, test := range tests {
+		testReadLine(t, 80, test.keys, test.expect, nil)
+	}
+}
+
+func TestViMode(t *testing.T) {
+	ViMode = true
+	defer func() { ViMode = false }()
+
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"foo bar baz", "ESCAPE", "0", "dw", "ENTER"}, "bar baz"},
+		{[]string{"foo bar baz", "ESCAPE", "0", "2dw", "ENTER"}, "baz"},
+		{[]string{"foo bar baz", "ESCAPE", "0", "d2w", "ENTER"}, "baz"},
+		{[]string{"foo bar baz", "ESCAPE", "bcwqux", "ESCAPE", "ENTER"}, "foo bar qux"},
+		{[]string{"foo bar baz", "ESCAPE", "0wyw$p", "ENTER"}, "foo bar bazbar "},
+		{[]string{"a,b,c", "ESCAPE", "0f,x;.", "ENTER"}, "abc"},
+		{[]string{"abc def", "ESCAPE", "0dt ", "ENTER"}, " def"},
+		{[]string{"abc def", "ESCAPE", "0de", "ENTER"}, " def"},
+		{[]string{"abc", "ESCAPE", "0iX", "ESCAPE", "ll.", "ENTER"}, "XaXbc"},
+		{[]string{"abc", "ESCAPE", "0ccxyz", "ESCAPE", "ENTER"}, "xyz"},
+		{[]string{"abc", "ESCAPE", "0xxu", "ENTER"}, "bc"},
+		{[]string{"abc", "ESCAPE", "0AZ", "ENTER"}, "abcZ"},
+		{[]string{"echo foo", "ESCAPE", "0", "/", "ls", "ENTER", "ENTER"}, "ls -l"},
+	}
+	for _, test := range tests {
+		output := testReadLine(t, 80, test.keys, test.expect, func(editor *Editor) {
+			editor.History = testHistory{"dir", "ls -l", "echo"}
+		})
+		if !strings.Contains(output, "(cmd) ") {
+			t.Fatalf("%v: the state is not drawn: %q", test.keys, output)
+		}
+	}
+}
+
+type testHistory []string
+
+func (h testHistory) Len() int        { return len(h) }
+func (h testHistory) At(i int) string { return h[i] }
+
+func TestIncrementalSearch(t *testing.T) {
+	history := testHistory{"echo foo", "ls -l", "echo bar", "Echo Baz", "dir"}
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"C_R", "echo", "ESCAPE", "ENTER"}, "echo bar"},
+		{[]string{"C_R", "echo", "C_R", "ESCAPE", "ENTER"}, "echo foo"},
+		{[]string{"C_R", "echo", "C_R", "C_S", "ESCAPE", "ENTER"}, "echo bar"},
+		{[]string{"C_R", "M_C", "echo b", "ESCAPE", "ENTER"}, "Echo Baz"},
+		{[]string{"C_R", "M_R", "o.*o", "ENTER"}, "echo foo"},
+		{[]string{"C_R", "ls", "RIGHT", "X", "ENTER"}, "lXs -l"},
+		{[]string{"C_R", "ls", "C_E", "X", "ENTER"}, "ls -lX"},
+		{[]string{"abc", "C_R", "ls", "C_G", "ENTER"}, "abc"},
+		{[]string{"C_R", "nothing", "ESCAPE", "ENTER"}, ""},
+		{[]string{"UP", "UP", "UP", "C_S", "dir", "ESCAPE", "ENTER"}, "dir"},
+	}
+	for _, test := range tests {
+		testReadLine(t, 80, test.keys, test.expect, func(editor *Editor) {
+			editor.History = history
+		})
+	}
+}
+
+func TestIncrementalSearchHighlight(t *testing.T) {
+	term := NewScriptedTerminal(80, 25)
+	term.Key("C_R")
+	term.Type("bar")
+	term.Key("ESCAPE", "ENTER")
+	var output strings.Builder
+	editor := newScriptedEditor(term, &output)
+	editor.History = testHistory{"echo bar"}
+	if _, err := editor.ReadLine(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(output.String(), "echo \x1B[7mbar\x1B[0m") {
+		t.Fatalf("the matched span is not highlighted: %q", output.String())
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	list := []string{"README.md", "readline/readline.go", "shell/parser.go", "rl.go"}
+	tests := []struct {
+		pattern string
+		expect  []string
+	}{
+		{"rl", []string{"rl.go", "readline/readline.go"}},
+		{"sh par", []string{"shell/parser.go"}},
+		{"README", []string{"README.md"}},
+		{"", list},
+		{"xyz", []string{}},
+	}
+	for _, test := range tests {
+		matches := FuzzyFilter(test.pattern, list)
+		result := []string{}
+		for _, m := range matches {
+			result = append(result, m.Text)
+		}
+		if strings.Join(result, "|") != strings.Join(test.expect, "|") {
+			t.Fatalf("%q: %v != %v", test.pattern, result, test.expect)
+		}
+	}
+	if _, positions, _ := FuzzyScore("rdm", "README.md"); len(positions) != 3 ||
+		positions[0] != 0 || positions[1] != 3 || positions[2] != 4 {
+		t.Fatalf("positions of `rdm` in `README.md`: %v", positions)
+	}
+}
+
+func TestFuzzyFinder(t *testing.T) {
+	tests := []struct {
+		keys   []string
+		expect string
+		ok     bool
+	}{
+		{[]string{"par", "ENTER"}, "shell/parser.go", true},
+		{[]string{"DOWN", "ENTER"}, "bar", true},
+		{[]string{"b", "C_N", "C_P", "ENTER"}, "bar", true},
+		{[]string{"zzz", "BACKSPACE", "BACKSPACE", "BACKSPACE", "ENTER"}, "foo", true},
+		{[]string{"foo", "ESCAPE"}, "", false},
+	}
+	for _, test := range tests {
+		var output strings.Builder
+		finder := &FuzzyFinder{
+			Terminal: keyTerminal(80, test.keys),
+			Writer:   bufio.NewWriter(&output),
+			Prompt:   "> ",
+		}
+		result, ok := finder.Select([]string{"foo", "bar", "shell/parser.go"})
+		if result != test.expect || ok != test.ok {
+			t.Fatalf("%v: (%q,%v) != (%q,%v)", test.keys, result, ok, test.expect, test.ok)
+		}
+	}
+}
+
+func TestHistorySelect(t *testing.T) {
+	BindKeySymbol("M_R", F_HISTORY_SELECT)
+	defer delete(altMap, name2alt[K_ALT_R])
+
+	term := NewScriptedTerminal(80, 25)
+	term.Key("M_R")
+	term.Type("lsl")
+	term.Key("ENTER", "ENTER")
+	var output strings.Builder
+	editor := newScriptedEditor(term, &output)
+	editor.History = testHistory{"ls -l", "echo", "ls -l", "dir"}
+	result, err := editor.ReadLine(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != "ls -l" {
+		t.Fatalf("%q != %q", result, "ls -l")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	HighlightMode = true
+	defer func() { HighlightMode = false }()
+
+	term := NewScriptedTerminal(80, 25)
+	term.Type("ab1")
+	term.Key("LEFT")
+	term.Type("2")
+	term.Key("ENTER")
+	var output strings.Builder
+	editor := newScriptedEditor(term, &output)
+	editor.Highlight = func(text string) []string {
+		colors := []string{}
+		for _, ch := range text {
+			if '0' <= ch && ch <= '9' {
+				colors = append(colors, "\x1B[31m")
+			} else {
+				colors = append(colors, "")
+			}
+		}
+		return colors
+	}
+	result, err := editor.ReadLine(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != "ab21" {
+		t.Fatalf("`%s` != `ab21`", result)
+	}
+	lastLine := output.String()[strings.LastIndex(output.String(), "\x1B[3G"):]
+	if !strings.Contains(lastLine, "ab\x1B[0m\x1B[31m21\x1B[0m") {
+		t.Fatalf("digits are not coloured: %q", lastLine)
+	}
+}
+
+func TestSuggestion(t *testing.T) {
+	SuggestMode = true
+	defer func() { SuggestMode = false }()
+
+	suggest := func(text string) string {
+		if strings.HasPrefix("git status --short", text) {
+			return "git status --short"
+		}
+		return ""
+	}
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"gi", "RIGHT", "ENTER"}, "git status --short"},
+		{[]string{"gi", "END", "ENTER"}, "git status --short"},
+		{[]string{"gi", "M_F", "M_F", "ENTER"}, "git status"},
+		{[]string{"gi", "LEFT", "RIGHT", "ENTER"}, "gi"},
+		{[]string{"gi", "x", "RIGHT", "ENTER"}, "gix"},
+	}
+	for _, test := range tests {
+		testReadLine(t, 80, test.keys, test.expect, func(editor *Editor) {
+			editor.Suggest = suggest
+		})
+	}
+
+	term := NewScriptedTerminal(80, 25)
+	term.Type("gi")
+	term.Key("ENTER")
+	var output strings.Builder
+	editor := newScriptedEditor(term, &output)
+	editor.Suggest = suggest
+	editor.ReadLine(context.Background())
+	if !strings.Contains(output.String(), "\x1B[2mt status --short\x1B[0m") {
+		t.Fatalf("the suggestion is not drawn: %q", output.String())
+	}
+	if out := output.String(); !strings.HasSuffix(out, CURSOR_OFF+"\x1B[0K\n"+CURSOR_ON+CURSOR_ON) {
+		t.Fatalf("the suggestion is not erased: %q", out)
+	}
+}
+
+// redrawTerminal calls Editor.Redraw from another goroutine before
+// the first key is read.
+type redrawTerminal struct {
+	*ScriptedTerminal
+	editor *Editor
+	done   bool
+}
+
+func (t *redrawTerminal) ReadEvent() (Event, error) {
+	if !t.done {
+		t.done = true
+		finished := make(chan struct{})
+		go func() {
+			t.editor.Redraw()
+			close(finished)
+		}()
+		<-finished
+	}
+	return t.ScriptedTerminal.ReadEvent()
+}
+
+func TestPromptRedrawAndTransient(t *testing.T) {
+	TransientPromptMode = true
+	defer func() { TransientPromptMode = false }()
+
+	term := NewScriptedTerminal(40, 25)
+	term.Type("ls")
+	term.Key("ENTER")
+	var output strings.Builder
+	editor := newScriptedEditor(term, &output)
+	prompts := 0
+	editor.Prompt = func() (int, error) {
+		if !editor.Redrawing() {
+			prompts++
+		}
+		io.WriteString(&output, "top\n$ ")
+		return 2, nil
+	}
+	editor.PromptRows = func() int { return 1 }
+	// the value computed in the background is ready at the redraw.
+	rprompt := "[wait]"
+	editor.RPrompt = func() (string, error) {
+		value := rprompt
+		rprompt = "[master]"
+		return value, nil
+	}
+	editor.Terminal = &redrawTerminal{ScriptedTerminal: term, editor: editor}
+	result, err := editor.ReadLine(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != "ls" {
+		t.Fatalf("`%s` != `ls`", result)
+	}
+	if prompts != 1 {
+		t.Fatalf("the prompt for the new line is called %d times", prompts)
+	}
+	out := output.String()
+	if !strings.Contains(out, "\x1B[s\x1B[34G[wait]") {
+		t.Fatalf("the right prompt is not drawn: %q", out)
+	}
+	if !strings.Contains(out, "\r\x1B[1A\x1B[0Jtop\n$ ") ||
+		!strings.Contains(out, "\x1B[32G[master]") {
+		t.Fatalf("the prompt is not redrawn: %q", out)
+	}
+	if !strings.HasSuffix(out, "\r\x1B[1A\x1B[0J> ls\n"+CURSOR_ON+CURSOR_ON) {
+		t.Fatalf("the prompt is not collapsed: %q", out)
+	}
+}
+
+func TestSelectMenu(t *testing.T) {
+	candidates := []string{"foo.txt", "foobar", "fuga"}
+	narrow := func(word string) []MenuItem {
+		items := []MenuItem{}
+		for _, s := range candidates {
+			if strings.HasPrefix(s, word) {
+				items = append(items, MenuItem{Value: s, Display: s})
+			}
+		}
+		return items
+	}
+	BindKeyClosure("F2", func(ctx context.Context, this *Buffer) Result {
+		_, pos := this.CurrentWord()
+		this.SelectMenu(pos, narrow(this.SubString(pos, this.Cursor)), narrow)
+		return CONTINUE
+	})
+	defer delete(scanMap, name2scan[K_F2])
+
+	tests := []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"cat f", "F2", "ENTER", "ENTER"}, "cat foo.txt"},
+		{[]string{"cat f", "F2", "C_I", "DOWN", "UP", "ENTER", "ENTER"}, "cat foobar"},
+		{[]string{"cat f", "F2", "S_TAB", "ENTER", "ENTER"}, "cat fuga"},
+		{[]string{"cat f", "F2", "RIGHT", "RIGHT", "ENTER", "ENTER"}, "cat fuga"},
+		{[]string{"cat f", "F2", "C_I", "ESCAPE", "ENTER"}, "cat f"},
+		{[]string{"cat f", "F2", "u", "C_I", "ENTER", "ENTER"}, "cat fuga"},
+		{[]string{"cat f", "F2", "oo", "S_TAB", "ENTER", "ENTER"}, "cat foobar"},
+		{[]string{"cat f", "F2", "x", "ENTER"}, "cat fx"},
+		{[]string{"cat f", "F2", "C_I", "C_A", "X", "ENTER"}, "Xcat foobar"},
+	}
+	for _, test := range tests {
+		testReadLine(t, 40, test.keys, test.expect, nil)
+	}
+}
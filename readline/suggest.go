@@ -0,0 +1,89 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SuggestMode is the switch to show the suggestion of Editor.Suggest
+// after the cursor.
+var SuggestMode = false
+
+// updateSuggestion asks Editor.Suggest for the line while the cursor is
+// at the end of the text, and repaints the line when the suggestion changed.
+func (this *Buffer) updateSuggestion() {
+	old := this.suggestion
+	this.suggestion = ""
+	if SuggestMode && this.Suggest != nil && this.Length > 0 && this.Cursor == this.Length {
+		text := this.String()
+		if s := this.Suggest(text); strings.HasPrefix(s, text) {
+			this.suggestion = s[len(text):]
+		}
+		if !this.multiLine && strings.ContainsRune(this.suggestion, '\n') {
+			this.suggestion = ""
+		}
+	}
+	if this.multiLine || (old == "" && this.suggestion == "") {
+		// the multi-line mode draws it in repaintMultiLine.
+		return
+	}
+	if old != "" {
+		fmt.Fprintf(this.Writer, "\x1B[%dG", this.TopColumn+1)
+		this.RepaintAfterPrompt()
+	}
+	if this.suggestion != "" {
+		width := this.ViewWidth() - this.GetWidthBetween(this.ViewStart, this.Length)
+		this.Backspace(this.drawSuggestion(width))
+	}
+}
+
+// drawSuggestion draws the suggestion dimmed within the width
+// and returns the width drawn.
+func (this *Buffer) drawSuggestion(width int) int {
+	drawn := 0
+	io.WriteString(this.Writer, "\x1B[2m")
+	for _, ch := range this.suggestion {
+		if ch == '\n' {
+			break
+		}
+		w := GetCharWidth(ch)
+		if drawn+w >= width {
+			break
+		}
+		this.putRune(ch)
+		drawn += w
+	}
+	io.WriteString(this.Writer, "\x1B[0m\x1B[0K")
+	return drawn
+}
+
+// eraseSuggestion erases the suggestion before the line is accepted.
+func (this *Buffer) eraseSuggestion() {
+	if this.suggestion != "" {
+		this.suggestion = ""
+		io.WriteString(this.Writer, "\x1B[0K")
+	}
+}
+
+// acceptSuggestion inserts the suggestion until the end of the next word
+// (word=true) or the whole of it. It returns false when there is
+// no suggestion.
+func (this *Buffer) acceptSuggestion(word bool) bool {
+	if this.suggestion == "" || this.Cursor != this.Length {
+		return false
+	}
+	runes := []rune(this.suggestion)
+	n := len(runes)
+	if word {
+		n = 0
+		for n < len(runes) && !isWordRune(runes[n]) {
+			n++
+		}
+		for n < len(runes) && isWordRune(runes[n]) {
+			n++
+		}
+	}
+	this.InsertAndRepaint(string(runes[:n]))
+	return true
+}
@@ -0,0 +1,183 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/zetamatta/go-box"
+	"github.com/zetamatta/go-getch"
+)
+
+// KeyEvent is the key typed on the terminal.
+type KeyEvent struct {
+	// Rune is the character of the key. It is zero for the special keys.
+	Rune rune
+	// Scan is the virtual key code.
+	Scan uint16
+	// Shift is the state of ALT, CTRL and SHIFT (the same bits with go-getch).
+	Shift uint32
+}
+
+// ResizeEvent is sent when the size of the terminal is changed.
+type ResizeEvent struct {
+	Width  int
+	Height int
+}
+
+// Event is the event read from Terminal. Either of Key or Resize is set.
+type Event struct {
+	Key    *KeyEvent
+	Resize *ResizeEvent
+}
+
+// Terminal is the source of key-events and the information of the screen
+// for Editor. When Editor.Terminal is nil, the console of Windows
+// (go-getch and go-box) is used.
+type Terminal interface {
+	// ReadEvent waits and returns the next event.
+	ReadEvent() (Event, error)
+	// Size returns the width and the height of the view.
+	Size() (int, int)
+	// Flush discards the key-events not read yet.
+	Flush()
+}
+
+type consoleTerminal struct{}
+
+func (consoleTerminal) ReadEvent() (Event, error) {
+	for {
+		e := getch.All()
+		if e.Key != nil {
+			return Event{
+				Key: &KeyEvent{Rune: e.Key.Rune, Scan: e.Key.Scan, Shift: e.Key.Shift},
+			}, nil
+		}
+		if e.Resize != nil {
+			return Event{
+				Resize: &ResizeEvent{Width: int(e.Resize.Width), Height: int(e.Resize.Height)},
+			}, nil
+		}
+	}
+}
+
+func (consoleTerminal) Size() (int, int) {
+	return box.GetScreenBufferInfo().ViewSize()
+}
+
+func (consoleTerminal) Flush() {
+	getch.Flush()
+}
+
+// ConsoleTerminal is the default Terminal with the console of Windows.
+var ConsoleTerminal Terminal = consoleTerminal{}
+
+func (session *Editor) terminal() Terminal {
+	if session.Terminal == nil {
+		return ConsoleTerminal
+	}
+	return session.Terminal
+}
+
+// GetKey waits the next key typed. The resize-events are ignored.
+func (this *Buffer) GetKey() (*KeyEvent, error) {
+	for {
+		e, err := this.readEvent()
+		if err != nil {
+			return nil, err
+		}
+		if e.Key != nil {
+			return e.Key, nil
+		}
+	}
+}
+
+// unreadKey pushes back the key so that the editor reads it next.
+func (this *Buffer) unreadKey(key *KeyEvent) {
+	this.pending = append([]Event{{Key: key}}, this.pending...)
+}
+
+// GetRune waits the next key which has a character.
+func (this *Buffer) GetRune() (rune, error) {
+	for {
+		key, err := this.GetKey()
+		if err != nil {
+			return 0, err
+		}
+		if key.Rune != 0 {
+			return key.Rune, nil
+		}
+	}
+}
+
+// ScriptedTerminal is the Terminal which replays the events given in advance.
+// It is used to drive Editor from tests or programs without the console.
+// When all events are read, ReadEvent returns io.EOF.
+type ScriptedTerminal struct {
+	Events []Event
+	Width  int
+	Height int
+}
+
+// NewScriptedTerminal returns ScriptedTerminal of the size width x height.
+func NewScriptedTerminal(width, height int) *ScriptedTerminal {
+	return &ScriptedTerminal{Width: width, Height: height}
+}
+
+func (t *ScriptedTerminal) ReadEvent() (Event, error) {
+	if len(t.Events) <= 0 {
+		return Event{}, io.EOF
+	}
+	e := t.Events[0]
+	t.Events = t.Events[1:]
+	if e.Resize != nil {
+		t.Width = e.Resize.Width
+		t.Height = e.Resize.Height
+	}
+	return e, nil
+}
+
+func (t *ScriptedTerminal) Size() (int, int) {
+	return t.Width, t.Height
+}
+
+// Flush does nothing, because the events of ScriptedTerminal are
+// not typed ahead but scripted.
+func (t *ScriptedTerminal) Flush() {}
+
+// Type appends the key-events for the characters of s.
+func (t *ScriptedTerminal) Type(s string) *ScriptedTerminal {
+	for len(s) > 0 {
+		ch, size := utf8.DecodeRuneInString(s)
+		t.Events = append(t.Events, Event{Key: &KeyEvent{Rune: ch}})
+		s = s[size:]
+	}
+	return t
+}
+
+// Key appends the key-events for the key-names like "C_A", "LEFT" or "M_Y"
+// (the same names with `bindkey`).
+func (t *ScriptedTerminal) Key(names ...string) error {
+	for _, name := range names {
+		name_ := normWord(name)
+		var key KeyEvent
+		if ch, ok := name2char[name_]; ok {
+			key.Rune = ch
+		} else if scan, ok := name2scan[name_]; ok {
+			key.Scan = scan
+		} else if scan, ok := name2alt[name_]; ok {
+			key.Scan = scan
+			key.Shift = getch.ALT_PRESSED
+		} else {
+			return fmt.Errorf("%s: no such keyname", name)
+		}
+		t.Events = append(t.Events, Event{Key: &key})
+	}
+	return nil
+}
+
+// Resize appends the event to change the size of the terminal.
+func (t *ScriptedTerminal) Resize(width, height int) *ScriptedTerminal {
+	t.Events = append(t.Events, Event{Resize: &ResizeEvent{Width: width, Height: height}})
+	return t
+}
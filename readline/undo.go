@@ -0,0 +1,66 @@
+package readline
+
+import "context"
+
+type undoState struct {
+	text   string
+	cursor int
+}
+
+// setText replaces the whole text, moves the cursor to pos and repaints.
+func (this *Buffer) setText(text string, pos int) {
+	this.Backspace(this.GetWidthBetween(this.ViewStart, this.Cursor))
+	this.Length = 0
+	this.InsertString(0, text)
+	if pos > this.Length {
+		pos = this.Length
+	}
+	this.Cursor = pos
+	this.RepaintAfterPrompt()
+}
+
+// recordUndo saves the text before the key-function was called
+// when the function has changed it. Characters typed in a row are
+// undone at once.
+func (this *Buffer) recordUndo(before string, cursor int) {
+	if this.undoing {
+		this.undoing = false
+		return
+	}
+	after := this.String()
+	if after == before {
+		return
+	}
+	typing := this.Length == len([]rune(before))+1 && this.Cursor == cursor+1
+	if !typing || !this.lastTyping {
+		this.undoStack = append(this.undoStack, undoState{text: before, cursor: cursor})
+	}
+	this.lastTyping = typing
+	this.redoStack = this.redoStack[:0]
+}
+
+func KeyFuncUndo(ctx context.Context, this *Buffer) Result {
+	if len(this.undoStack) <= 0 {
+		return CONTINUE
+	}
+	last := this.undoStack[len(this.undoStack)-1]
+	this.undoStack = this.undoStack[:len(this.undoStack)-1]
+	this.redoStack = append(this.redoStack, undoState{text: this.String(), cursor: this.Cursor})
+	this.setText(last.text, last.cursor)
+	this.undoing = true
+	this.lastTyping = false
+	return CONTINUE
+}
+
+func KeyFuncRedo(ctx context.Context, this *Buffer) Result {
+	if len(this.redoStack) <= 0 {
+		return CONTINUE
+	}
+	last := this.redoStack[len(this.redoStack)-1]
+	this.redoStack = this.redoStack[:len(this.redoStack)-1]
+	this.undoStack = append(this.undoStack, undoState{text: this.String(), cursor: this.Cursor})
+	this.setText(last.text, last.cursor)
+	this.undoing = true
+	this.lastTyping = false
+	return CONTINUE
+}
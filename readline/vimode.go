@@ -0,0 +1,692 @@
+package readline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ViMode is the switch to edit the command-line with the keys of vi
+// instead of those of Emacs.
+var ViMode = false
+
+// The states of the vi-mode passed to Editor.ViPrompt.
+const (
+	ViInsert  = "insert"
+	ViCommand = "command"
+)
+
+// DefaultViPrompt returns the mark of the state of the vi-mode
+// drawn after the prompt when Editor.ViPrompt is nil.
+func DefaultViPrompt(state string) string {
+	if state == ViCommand {
+		return "(cmd) "
+	}
+	return "(ins) "
+}
+
+// how the vi-command called last changed the text.
+const (
+	viNoChange  = iota // motions, yank and search: not repeated by `.`
+	viPending          // counts: the command continues to the next key.
+	viChanged          // the command changed the text and finished.
+	viInserting        // the command changed the text and started the insert-state.
+)
+
+type viFind struct {
+	kind rune // one of f,t,F and T
+	ch   rune
+}
+
+// viState is the state of the vi-mode of Buffer.
+type viState struct {
+	command   bool
+	count     int
+	change    int
+	recording bool
+	record    []Event
+	repeat    []Event
+	find      viFind
+	search    string
+}
+
+// readEvent returns the event scripted by `.` or read from the terminal.
+// While a vi-command is recorded, the key-events are saved for `.`.
+func (this *Buffer) readEvent() (Event, error) {
+	var e Event
+	if len(this.pending) > 0 {
+		e = this.pending[0]
+		this.pending = this.pending[1:]
+	} else {
+		var err error
+		e, err = this.terminal().ReadEvent()
+		if err != nil {
+			return e, err
+		}
+	}
+	if this.vi.recording && e.Key != nil {
+		this.vi.record = append(this.vi.record, e)
+	}
+	return e, nil
+}
+
+// printPrompt draws the prompt and the mark of the vi-mode,
+// and returns the width of them.
+func (this *Buffer) printPrompt() (int, error) {
+	width, err := this.Prompt()
+	this.promptWidth = width
+	if err != nil || !this.viMode {
+		return width, err
+	}
+	return width + this.printViPrompt(), nil
+}
+
+func (this *Buffer) viStateName() string {
+	if this.vi.command {
+		return ViCommand
+	}
+	return ViInsert
+}
+
+func (this *Buffer) printViPrompt() int {
+	if this.ViPrompt == nil {
+		mark := DefaultViPrompt(this.viStateName())
+		io.WriteString(this.Writer, mark)
+		return GetStringWidth(mark)
+	}
+	this.Writer.Flush()
+	width, err := this.ViPrompt(this.viStateName())
+	if err != nil {
+		fmt.Fprintf(this.Writer, "%s ", err.Error())
+		return GetStringWidth(err.Error()) + 1
+	}
+	return width
+}
+
+// setViState switches the insert-state and the command-state
+// and redraws the mark after the prompt.
+func (this *Buffer) setViState(command bool) {
+	if this.vi.command == command {
+		return
+	}
+	this.vi.command = command
+	if this.multiLine {
+		if this.cursorRow > 0 {
+			fmt.Fprintf(this.Writer, "\x1B[%dA", this.cursorRow)
+		}
+		this.cursorRow = 0
+	}
+	fmt.Fprintf(this.Writer, "\x1B[%dG", this.promptWidth+1)
+	this.TopColumn = this.promptWidth + this.printViPrompt()
+	if !this.multiLine {
+		this.ViewStart = 0
+		this.RepaintAfterPrompt()
+	}
+}
+
+// viCount returns the count typed before the command and clears it.
+func (this *Buffer) viCount() int {
+	n := this.vi.count
+	this.vi.count = 0
+	if n <= 0 {
+		return 1
+	}
+	return n
+}
+
+// viClass returns 0 for spaces, 1 for the characters of words and 2 for others.
+// With big, it returns 1 for all characters except spaces.
+func (this *Buffer) viClass(pos int, big bool) int {
+	ch := this.Buffer[pos]
+	if unicode.IsSpace(ch) {
+		return 0
+	}
+	if big || ch == '_' || isWordRune(ch) {
+		return 1
+	}
+	return 2
+}
+
+func (this *Buffer) viNextWordStart(pos int, big bool) int {
+	if pos >= this.Length {
+		return this.Length
+	}
+	if class := this.viClass(pos, big); class != 0 {
+		for pos < this.Length && this.viClass(pos, big) == class {
+			pos++
+		}
+	}
+	for pos < this.Length && this.viClass(pos, big) == 0 {
+		pos++
+	}
+	return pos
+}
+
+func (this *Buffer) viPrevWordStart(pos int, big bool) int {
+	if pos <= 0 {
+		return 0
+	}
+	pos--
+	for pos > 0 && this.viClass(pos, big) == 0 {
+		pos--
+	}
+	class := this.viClass(pos, big)
+	for pos > 0 && this.viClass(pos-1, big) == class {
+		pos--
+	}
+	return pos
+}
+
+func (this *Buffer) viWordEnd(pos int, big bool) int {
+	if pos+1 >= this.Length {
+		return pos
+	}
+	pos++
+	for pos+1 < this.Length && this.viClass(pos, big) == 0 {
+		pos++
+	}
+	class := this.viClass(pos, big)
+	for pos+1 < this.Length && this.viClass(pos+1, big) == class {
+		pos++
+	}
+	return pos
+}
+
+func (this *Buffer) viFindChar(find viFind, count int, repeat bool) (int, bool) {
+	pos := this.Cursor
+	for ; count > 0; count-- {
+		switch find.kind {
+		case 'f', 't':
+			start := pos + 1
+			if find.kind == 't' && repeat && start < this.Length && this.Buffer[start] == find.ch {
+				// `t` does not stay at the same place when repeated by `;`.
+				start++
+			}
+			pos = -1
+			for i := start; i < this.Length; i++ {
+				if this.Buffer[i] == find.ch {
+					pos = i
+					break
+				}
+			}
+		case 'F', 'T':
+			start := pos - 1
+			if find.kind == 'T' && repeat && start >= 0 && this.Buffer[start] == find.ch {
+				start--
+			}
+			pos = -1
+			for i := start; i >= 0; i-- {
+				if this.Buffer[i] == find.ch {
+					pos = i
+					break
+				}
+			}
+		}
+		if pos < 0 {
+			return this.Cursor, false
+		}
+	}
+	switch find.kind {
+	case 't':
+		pos--
+	case 'T':
+		pos++
+	}
+	return pos, true
+}
+
+// viMotion returns the position where the motion-key ch moves the cursor to.
+// inclusive is true when the character at the position is included in
+// the range for the operators.
+func (this *Buffer) viMotion(ch rune, count int) (pos int, inclusive bool, ok bool) {
+	pos = this.Cursor
+	switch ch {
+	case 'h', '\b':
+		pos -= count
+		if pos < 0 {
+			pos = 0
+		}
+	case 'l', ' ':
+		pos += count
+		if pos > this.Length {
+			pos = this.Length
+		}
+	case 'w', 'W':
+		for ; count > 0; count-- {
+			pos = this.viNextWordStart(pos, ch == 'W')
+		}
+	case 'b', 'B':
+		for ; count > 0; count-- {
+			pos = this.viPrevWordStart(pos, ch == 'B')
+		}
+	case 'e', 'E':
+		for ; count > 0; count-- {
+			pos = this.viWordEnd(pos, ch == 'E')
+		}
+		inclusive = true
+	case '0':
+		pos = 0
+	case '^':
+		for pos = 0; pos < this.Length && unicode.IsSpace(this.Buffer[pos]); pos++ {
+		}
+	case '$':
+		pos = this.Length - 1
+		inclusive = true
+		if pos < 0 {
+			pos = 0
+			inclusive = false
+		}
+	case 'f', 't', 'F', 'T':
+		target, err := this.GetRune()
+		if err != nil {
+			return this.Cursor, false, false
+		}
+		this.vi.find = viFind{kind: ch, ch: target}
+		pos, ok = this.viFindChar(this.vi.find, count, false)
+		return pos, ch == 'f' || ch == 't', ok
+	case ';', ',':
+		find := this.vi.find
+		if find.kind == 0 {
+			return this.Cursor, false, false
+		}
+		if ch == ',' {
+			find.kind = map[rune]rune{'f': 'F', 't': 'T', 'F': 'f', 'T': 't'}[find.kind]
+		}
+		pos, ok = this.viFindChar(find, count, true)
+		return pos, find.kind == 'f' || find.kind == 't', ok
+	default:
+		return this.Cursor, false, false
+	}
+	return pos, inclusive, true
+}
+
+// viClampCursor keeps the cursor on a character in the command-state.
+func (this *Buffer) viClampCursor() {
+	if this.Length > 0 && this.Cursor >= this.Length {
+		this.moveCursor(this.Length - 1)
+	}
+}
+
+func (this *Buffer) viInsertState() {
+	this.vi.change = viInserting
+	this.setViState(false)
+}
+
+// KeyFuncViCommandMode leaves the insert-state of the vi-mode (ESC).
+func KeyFuncViCommandMode(ctx context.Context, this *Buffer) Result {
+	if this.vi.recording {
+		this.vi.repeat = this.vi.record
+		this.vi.recording = false
+		this.vi.record = nil
+	}
+	this.setViState(true)
+	if this.Cursor > 0 {
+		this.moveCursor(this.Cursor - 1)
+	}
+	return CONTINUE
+}
+
+// KeyFuncViInsertMode enters the insert-state of the vi-mode.
+func KeyFuncViInsertMode(ctx context.Context, this *Buffer) Result {
+	switch this.Unicode {
+	case 'a':
+		if this.Cursor < this.Length {
+			this.moveCursor(this.Cursor + 1)
+		}
+	case 'A':
+		this.moveCursor(this.Length)
+	case 'I':
+		pos, _, _ := this.viMotion('^', 1)
+		this.moveCursor(pos)
+	}
+	this.vi.count = 0
+	this.viInsertState()
+	return CONTINUE
+}
+
+func KeyFuncViDigit(ctx context.Context, this *Buffer) Result {
+	if this.Unicode == '0' && this.vi.count == 0 {
+		return KeyFuncViMotion(ctx, this)
+	}
+	this.vi.count = this.vi.count*10 + int(this.Unicode-'0')
+	this.vi.change = viPending
+	return CONTINUE
+}
+
+func KeyFuncViMotion(ctx context.Context, this *Buffer) Result {
+	if pos, _, ok := this.viMotion(this.Unicode, this.viCount()); ok {
+		this.moveCursor(pos)
+	}
+	return CONTINUE
+}
+
+// viOperate applies the operator d, c or y to the text between start and end.
+func (this *Buffer) viOperate(op rune, start, end int) {
+	if start > end {
+		start, end = end, start
+	}
+	if end > this.Length {
+		end = this.Length
+	}
+	text := this.SubString(start, end)
+	switch op {
+	case 'y':
+		this.kill(text)
+		this.moveCursor(start)
+	case 'd':
+		this.kill(text)
+		this.replaceRange(start, end, "", start)
+		this.vi.change = viChanged
+	case 'c':
+		this.kill(text)
+		this.replaceRange(start, end, "", start)
+		this.viInsertState()
+	}
+}
+
+// KeyFuncViOperator is the operator d, c or y followed by a motion.
+// `dd`, `cc` and `yy` operate the whole line.
+func KeyFuncViOperator(ctx context.Context, this *Buffer) Result {
+	op := this.Unicode
+	count := this.viCount()
+	count2 := 0
+	var ch rune
+	for {
+		var err error
+		ch, err = this.GetRune()
+		if err != nil {
+			return CONTINUE
+		}
+		if ch < '0' || '9' < ch || (ch == '0' && count2 == 0) {
+			break
+		}
+		count2 = count2*10 + int(ch-'0')
+	}
+	if count2 > 0 {
+		count *= count2
+	}
+	if ch == op {
+		this.viOperate(op, 0, this.Length)
+		return CONTINUE
+	}
+	if op == 'c' && (ch == 'w' || ch == 'W') &&
+		this.Cursor < this.Length && !unicode.IsSpace(this.Buffer[this.Cursor]) {
+		// `cw` changes to the end of the word as `ce`.
+		ch = map[rune]rune{'w': 'e', 'W': 'E'}[ch]
+	}
+	pos, inclusive, ok := this.viMotion(ch, count)
+	if !ok {
+		return CONTINUE
+	}
+	end := pos
+	start := this.Cursor
+	if pos < start {
+		start, end = pos, start
+	} else if inclusive {
+		end++
+	}
+	this.viOperate(op, start, end)
+	return CONTINUE
+}
+
+// KeyFuncViEdit runs the commands which edit the text without motions:
+// x X D C s S p P r ~
+func KeyFuncViEdit(ctx context.Context, this *Buffer) Result {
+	count := this.viCount()
+	switch this.Unicode {
+	case 'x':
+		if this.Length > 0 {
+			this.viOperate('d', this.Cursor, this.Cursor+count)
+		}
+	case 'X':
+		start := this.Cursor - count
+		if start < 0 {
+			start = 0
+		}
+		if start < this.Cursor {
+			this.viOperate('d', start, this.Cursor)
+		}
+	case 'D':
+		this.viOperate('d', this.Cursor, this.Length)
+	case 'C':
+		this.viOperate('c', this.Cursor, this.Length)
+	case 's':
+		this.viOperate('c', this.Cursor, this.Cursor+count)
+	case 'S':
+		this.viOperate('c', 0, this.Length)
+	case 'p', 'P':
+		text, ok := this.currentKill()
+		if !ok {
+			return CONTINUE
+		}
+		text = strings.Repeat(text, count)
+		pos := this.Cursor
+		if this.Unicode == 'p' && this.Length > 0 {
+			pos++
+		}
+		n := len([]rune(text))
+		this.replaceRange(pos, pos, text, pos+n-1)
+		this.vi.change = viChanged
+	case 'r':
+		ch, err := this.GetRune()
+		if err != nil || this.Cursor+count > this.Length {
+			return CONTINUE
+		}
+		this.replaceRange(this.Cursor, this.Cursor+count,
+			strings.Repeat(string(ch), count), this.Cursor+count-1)
+		this.vi.change = viChanged
+	case '~':
+		end := this.Cursor + count
+		if end > this.Length {
+			end = this.Length
+		}
+		word := []rune(this.SubString(this.Cursor, end))
+		for i, ch := range word {
+			if unicode.IsUpper(ch) {
+				word[i] = unicode.ToLower(ch)
+			} else {
+				word[i] = unicode.ToUpper(ch)
+			}
+		}
+		this.replaceRange(this.Cursor, end, string(word), end)
+		this.vi.change = viChanged
+	}
+	return CONTINUE
+}
+
+// KeyFuncViRepeat repeats the last change (`.`).
+func KeyFuncViRepeat(ctx context.Context, this *Buffer) Result {
+	this.vi.count = 0
+	this.pending = append(append([]Event{}, this.vi.repeat...), this.pending...)
+	return CONTINUE
+}
+
+func (this *Buffer) viSearchHistory(pattern string, start, step int) bool {
+	for i := start; 0 <= i && i < this.History.Len(); i += step {
+		line := this.History.At(i)
+		if strings.Contains(line, pattern) {
+			this.HistoryPointer = i
+			this.setText(line, 0)
+			return true
+		}
+	}
+	return false
+}
+
+// KeyFuncViSearch searches the history backward (`/`).
+// `n` and `N` repeat it backward and forward.
+func KeyFuncViSearch(ctx context.Context, this *Buffer) Result {
+	this.vi.count = 0
+	switch this.Unicode {
+	case 'n':
+		if this.vi.search != "" {
+			this.viSearchHistory(this.vi.search, this.HistoryPointer-1, -1)
+		}
+		return CONTINUE
+	case 'N':
+		if this.vi.search != "" {
+			this.viSearchHistory(this.vi.search, this.HistoryPointer+1, +1)
+		}
+		return CONTINUE
+	}
+	if this.multiLine {
+		this.beginSingleRow()
+	} else {
+		this.Backspace(this.GetWidthBetween(this.ViewStart, this.Cursor))
+	}
+	var pattern []rune
+	for {
+		io.WriteString(this.Writer, "/"+string(pattern)+"\x1B[0K")
+		io.WriteString(this.Writer, CURSOR_ON)
+		this.Writer.Flush()
+		ch, err := this.GetRune()
+		io.WriteString(this.Writer, CURSOR_OFF)
+		this.Backspace(GetStringWidth(string(pattern)) + 1)
+		if err != nil {
+			ch = rune(0x1B)
+		}
+		switch ch {
+		case '\b':
+			if len(pattern) > 0 {
+				pattern = pattern[:len(pattern)-1]
+			}
+		case '\r':
+			if len(pattern) > 0 {
+				this.vi.search = string(pattern)
+			}
+			this.ViewStart = 0
+			if this.vi.search == "" ||
+				!this.viSearchHistory(this.vi.search, this.HistoryPointer-1, -1) {
+				this.RepaintAfterPrompt()
+			}
+			return CONTINUE
+		case rune(0x1B), rune('c' & 0x1F), rune('g' & 0x1F):
+			this.ViewStart = 0
+			this.RepaintAfterPrompt()
+			return CONTINUE
+		default:
+			if !unicode.IsControl(ch) {
+				pattern = append(pattern, ch)
+			}
+		}
+	}
+}
+
+var viInsertMap = map[rune]KeyFuncT{
+	name2char[K_ESCAPE]: name2func(F_VI_COMMAND_MODE),
+}
+
+func viFunc(name string, f func(context.Context, *Buffer) Result) KeyFuncT {
+	return &KeyGoFuncT{Func: f, Name: name}
+}
+
+var viCommandMap = map[rune]KeyFuncT{
+	name2char[K_CTRL_C]: name2func(F_INTR),
+	name2char[K_CTRL_D]: name2func(F_DELETE_OR_ABORT),
+	name2char[K_CTRL_J]: name2func(F_ACCEPT_LINE),
+	name2char[K_CTRL_L]: name2func(F_CLEAR_SCREEN),
+	name2char[K_CTRL_M]: name2func(F_ACCEPT_LINE),
+	name2char[K_CTRL_N]: name2func(F_NEXT_HISTORY),
+	name2char[K_CTRL_P]: name2func(F_PREVIOUS_HISTORY),
+	name2char[K_CTRL_R]: name2func(F_REDO),
+	name2char[K_ESCAPE]: name2func(F_PASS),
+	'1':                 viFunc("1", KeyFuncViDigit),
+	'2':                 viFunc("2", KeyFuncViDigit),
+	'3':                 viFunc("3", KeyFuncViDigit),
+	'4':                 viFunc("4", KeyFuncViDigit),
+	'5':                 viFunc("5", KeyFuncViDigit),
+	'6':                 viFunc("6", KeyFuncViDigit),
+	'7':                 viFunc("7", KeyFuncViDigit),
+	'8':                 viFunc("8", KeyFuncViDigit),
+	'9':                 viFunc("9", KeyFuncViDigit),
+	'0':                 viFunc("0", KeyFuncViDigit),
+	'h':                 viFunc("h", KeyFuncViMotion),
+	'\b':                viFunc("h", KeyFuncViMotion),
+	'l':                 viFunc("l", KeyFuncViMotion),
+	' ':                 viFunc("l", KeyFuncViMotion),
+	'w':                 viFunc("w", KeyFuncViMotion),
+	'W':                 viFunc("W", KeyFuncViMotion),
+	'b':                 viFunc("b", KeyFuncViMotion),
+	'B':                 viFunc("B", KeyFuncViMotion),
+	'e':                 viFunc("e", KeyFuncViMotion),
+	'E':                 viFunc("E", KeyFuncViMotion),
+	'^':                 viFunc("^", KeyFuncViMotion),
+	'$':                 viFunc("$", KeyFuncViMotion),
+	'f':                 viFunc("f", KeyFuncViMotion),
+	't':                 viFunc("t", KeyFuncViMotion),
+	'F':                 viFunc("F", KeyFuncViMotion),
+	'T':                 viFunc("T", KeyFuncViMotion),
+	';':                 viFunc(";", KeyFuncViMotion),
+	',':                 viFunc(",", KeyFuncViMotion),
+	'i':                 viFunc("i", KeyFuncViInsertMode),
+	'a':                 viFunc("a", KeyFuncViInsertMode),
+	'I':                 viFunc("I", KeyFuncViInsertMode),
+	'A':                 viFunc("A", KeyFuncViInsertMode),
+	'd':                 viFunc("d", KeyFuncViOperator),
+	'c':                 viFunc("c", KeyFuncViOperator),
+	'y':                 viFunc("y", KeyFuncViOperator),
+	'x':                 viFunc("x", KeyFuncViEdit),
+	'X':                 viFunc("X", KeyFuncViEdit),
+	'D':                 viFunc("D", KeyFuncViEdit),
+	'C':                 viFunc("C", KeyFuncViEdit),
+	's':                 viFunc("s", KeyFuncViEdit),
+	'S':                 viFunc("S", KeyFuncViEdit),
+	'p':                 viFunc("p", KeyFuncViEdit),
+	'P':                 viFunc("P", KeyFuncViEdit),
+	'r':                 viFunc("r", KeyFuncViEdit),
+	'~':                 viFunc("~", KeyFuncViEdit),
+	'u':                 name2func(F_UNDO),
+	'.':                 viFunc(".", KeyFuncViRepeat),
+	'/':                 viFunc("/", KeyFuncViSearch),
+	'n':                 viFunc("n", KeyFuncViSearch),
+	'N':                 viFunc("N", KeyFuncViSearch),
+	'j':                 name2func(F_NEXT_HISTORY),
+	'k':                 name2func(F_PREVIOUS_HISTORY),
+}
+
+// viKeyFunc returns the function for the key in the vi-mode.
+// It returns false when the key is not bound in the tables of the vi-mode.
+func (this *Buffer) viKeyFunc() (KeyFuncT, bool) {
+	if !this.viMode {
+		return nil, false
+	}
+	if this.vi.command {
+		f, ok := viCommandMap[this.Unicode]
+		if !ok {
+			f = name2func(F_PASS)
+		}
+		return f, true
+	}
+	f, ok := viInsertMap[this.Unicode]
+	return f, ok
+}
+
+// viBeforeCommand starts to record the keys of the command for `.`.
+func (this *Buffer) viBeforeCommand(e Event) {
+	this.vi.change = viNoChange
+	if this.viMode && this.vi.command && !this.vi.recording {
+		this.vi.recording = true
+		this.vi.record = []Event{e}
+	}
+}
+
+// viAfterCommand saves the keys of the command which changed the text.
+func (this *Buffer) viAfterCommand() {
+	if !this.viMode || !this.vi.command {
+		return
+	}
+	if this.vi.change == viPending {
+		return
+	}
+	this.vi.count = 0
+	if this.vi.recording {
+		if this.vi.change == viChanged {
+			this.vi.repeat = this.vi.record
+		}
+		this.vi.recording = false
+		this.vi.record = nil
+	}
+	this.viClampCursor()
+}
@@ -0,0 +1,126 @@
+package readline
+
+import (
+	"context"
+	"unicode"
+)
+
+func isWordRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// forwardWordEnd returns the position of the end of the word
+// at or after pos.
+func (this *Buffer) forwardWordEnd(pos int) int {
+	for pos < this.Length && !isWordRune(this.Buffer[pos]) {
+		pos++
+	}
+	for pos < this.Length && isWordRune(this.Buffer[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// backwardWordTop returns the position of the top of the word
+// before pos.
+func (this *Buffer) backwardWordTop(pos int) int {
+	for pos > 0 && !isWordRune(this.Buffer[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(this.Buffer[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// moveCursor moves the cursor to pos and repaints.
+func (this *Buffer) moveCursor(pos int) {
+	this.Backspace(this.GetWidthBetween(this.ViewStart, this.Cursor))
+	this.Cursor = pos
+	this.RepaintAfterPrompt()
+}
+
+// replaceRange replaces the text between start and end with text,
+// moves the cursor to pos and repaints.
+func (this *Buffer) replaceRange(start, end int, text string, pos int) {
+	this.Backspace(this.GetWidthBetween(this.ViewStart, this.Cursor))
+	this.Delete(start, end-start)
+	this.InsertString(start, text)
+	this.Cursor = pos
+	this.RepaintAfterPrompt()
+}
+
+func KeyFuncForwardWord(ctx context.Context, this *Buffer) Result {
+	if this.acceptSuggestion(true) {
+		return CONTINUE
+	}
+	this.moveCursor(this.forwardWordEnd(this.Cursor))
+	return CONTINUE
+}
+
+func KeyFuncBackwardWord(ctx context.Context, this *Buffer) Result {
+	this.moveCursor(this.backwardWordTop(this.Cursor))
+	return CONTINUE
+}
+
+func KeyFuncKillWord(ctx context.Context, this *Buffer) Result {
+	end := this.forwardWordEnd(this.Cursor)
+	if end == this.Cursor {
+		return CONTINUE
+	}
+	this.kill(this.SubString(this.Cursor, end))
+	this.replaceRange(this.Cursor, end, "", this.Cursor)
+	return CONTINUE
+}
+
+func KeyFuncBackwardKillWord(ctx context.Context, this *Buffer) Result {
+	top := this.backwardWordTop(this.Cursor)
+	if top == this.Cursor {
+		return CONTINUE
+	}
+	this.kill(this.SubString(top, this.Cursor))
+	this.replaceRange(top, this.Cursor, "", top)
+	return CONTINUE
+}
+
+func KeyFuncUpcaseWord(ctx context.Context, this *Buffer) Result {
+	end := this.forwardWordEnd(this.Cursor)
+	word := []rune(this.SubString(this.Cursor, end))
+	for i, ch := range word {
+		word[i] = unicode.ToUpper(ch)
+	}
+	this.replaceRange(this.Cursor, end, string(word), end)
+	return CONTINUE
+}
+
+// KeyFuncTransposeWords swaps the word before the cursor and the word
+// after it, and moves the cursor after them.
+func KeyFuncTransposeWords(ctx context.Context, this *Buffer) Result {
+	end2 := this.forwardWordEnd(this.Cursor)
+	top2 := this.backwardWordTop(end2)
+	top1 := this.backwardWordTop(top2)
+	if top1 == top2 {
+		return CONTINUE
+	}
+	end1 := this.forwardWordEnd(top1)
+	word1 := this.SubString(top1, end1)
+	word2 := this.SubString(top2, end2)
+	text := word2 + this.SubString(end1, top2) + word1
+	this.replaceRange(top1, end2, text, end2)
+	return CONTINUE
+}
+
+func KeyFuncSetMark(ctx context.Context, this *Buffer) Result {
+	this.mark = this.Cursor
+	return CONTINUE
+}
+
+func KeyFuncExchangePointAndMark(ctx context.Context, this *Buffer) Result {
+	mark := this.mark
+	if mark > this.Length {
+		mark = this.Length
+	}
+	this.mark = this.Cursor
+	this.moveCursor(mark)
+	return CONTINUE
+}
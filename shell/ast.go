@@ -0,0 +1,261 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is the interface for all nodes of the syntax tree made by ParseTree.
+type Node interface {
+	// Pos returns the byte offset of the node in the source text.
+	Pos() int
+	// String returns the text which is equivalent to the node.
+	String() string
+}
+
+// SequenceNode is the list of commands separated with ` ; ` or `&`.
+type SequenceNode struct {
+	Position int
+	Items    []Node
+}
+
+// AsyncNode is the command executed in background with `&`.
+type AsyncNode struct {
+	Position int
+	Body     Node
+}
+
+// AndOrNode is `Left && Right` or `Left || Right`.
+type AndOrNode struct {
+	Position int
+	Op       string
+	Left     Node
+	Right    Node
+}
+
+// PipelineNode is the list of commands connected with `|` or `|&`.
+type PipelineNode struct {
+	Position int
+	Commands []Node
+	// Pipes[i] is the operator between Commands[i] and Commands[i+1].
+	Pipes []string
+}
+
+// SubshellNode is the commands enclosed with `(` and `)`.
+type SubshellNode struct {
+	Position  int
+	Body      Node
+	Redirects []*RedirectNode
+}
+
+// GroupNode is the commands enclosed with `{` and `}`.
+type GroupNode struct {
+	Position  int
+	Body      Node
+	Redirects []*RedirectNode
+}
+
+// CommandNode is the simple command which has the command-name and arguments.
+type CommandNode struct {
+	Position  int
+	Words     []*WordNode
+	Redirects []*RedirectNode
+}
+
+// WordNode is one field of the command-line.
+// Text is the source text before quotations are removed and variables are expanded.
+type WordNode struct {
+	Position int
+	Text     string
+}
+
+// RedirectNode is the redirection like `>FILE`, `2>>FILE`, `<FILE`, `2>&1`,
+// `3>&-`, `&>FILE`, `<>FILE`, `<<EOF` (here-document) or `<<<WORD` (here-string).
+type RedirectNode struct {
+	Position int
+	FileNo   int
+	IsInput  bool
+	IsAppend bool
+	Force    bool
+	// ReadWrite is true for `<>FILE`.
+	ReadWrite bool
+	// Both is true for `&>FILE`, which redirects both stdout and stderr.
+	Both bool
+	// DupFrom is the file-number to duplicate. It is -1 when Target is used.
+	DupFrom int
+	// Close is true for `N>&-`.
+	Close bool
+	// Target is the filename, the terminator of the here-document or the here-string.
+	Target     *WordNode
+	HereDoc    bool
+	HereString bool
+	// StripTabs is true for `<<-EOF`, which removes the leading tabs of the here-document.
+	StripTabs bool
+	// HereBody is the text of the here-document read by Interpret.
+	HereBody string
+}
+
+func (n *SequenceNode) Pos() int { return n.Position }
+func (n *AsyncNode) Pos() int    { return n.Position }
+func (n *AndOrNode) Pos() int    { return n.Position }
+func (n *PipelineNode) Pos() int { return n.Position }
+func (n *SubshellNode) Pos() int { return n.Position }
+func (n *GroupNode) Pos() int    { return n.Position }
+func (n *CommandNode) Pos() int  { return n.Position }
+func (n *WordNode) Pos() int     { return n.Position }
+func (n *RedirectNode) Pos() int { return n.Position }
+
+func (n *SequenceNode) String() string {
+	var buffer strings.Builder
+	for i, item := range n.Items {
+		if i > 0 {
+			if _, ok := n.Items[i-1].(*AsyncNode); ok {
+				buffer.WriteRune(' ')
+			} else {
+				buffer.WriteString(" ; ")
+			}
+		}
+		buffer.WriteString(item.String())
+	}
+	return buffer.String()
+}
+
+func (n *AsyncNode) String() string {
+	return n.Body.String() + " &"
+}
+
+func (n *AndOrNode) String() string {
+	return fmt.Sprintf("%s %s %s", n.Left.String(), n.Op, n.Right.String())
+}
+
+func (n *PipelineNode) String() string {
+	var buffer strings.Builder
+	for i, cmd := range n.Commands {
+		if i > 0 {
+			fmt.Fprintf(&buffer, " %s ", n.Pipes[i-1])
+		}
+		buffer.WriteString(cmd.String())
+	}
+	return buffer.String()
+}
+
+func redirectsString(redirects []*RedirectNode) string {
+	var buffer strings.Builder
+	for _, r := range redirects {
+		buffer.WriteRune(' ')
+		buffer.WriteString(r.String())
+	}
+	return buffer.String()
+}
+
+func (n *SubshellNode) String() string {
+	return "( " + n.Body.String() + " )" + redirectsString(n.Redirects)
+}
+
+func (n *GroupNode) String() string {
+	return "{ " + n.Body.String() + " ; }" + redirectsString(n.Redirects)
+}
+
+func (n *CommandNode) String() string {
+	var buffer strings.Builder
+	for i, w := range n.Words {
+		if i > 0 {
+			buffer.WriteRune(' ')
+		}
+		buffer.WriteString(w.Text)
+	}
+	if len(n.Words) > 0 {
+		buffer.WriteString(redirectsString(n.Redirects))
+	} else {
+		buffer.WriteString(strings.TrimPrefix(redirectsString(n.Redirects), " "))
+	}
+	return buffer.String()
+}
+
+func (n *WordNode) String() string {
+	return n.Text
+}
+
+func (n *RedirectNode) String() string {
+	var buffer strings.Builder
+	if n.Both {
+		buffer.WriteRune('&')
+	} else if (n.IsInput && n.FileNo != 0) || (!n.IsInput && n.FileNo != 1) {
+		fmt.Fprintf(&buffer, "%d", n.FileNo)
+	}
+	if n.IsInput {
+		buffer.WriteRune('<')
+		if n.ReadWrite {
+			buffer.WriteRune('>')
+		}
+		if n.HereDoc || n.HereString {
+			buffer.WriteRune('<')
+		}
+		if n.HereString {
+			buffer.WriteRune('<')
+		}
+		if n.StripTabs {
+			buffer.WriteRune('-')
+		}
+	} else {
+		buffer.WriteRune('>')
+		if n.IsAppend {
+			buffer.WriteRune('>')
+		}
+		if n.Force {
+			buffer.WriteRune('!')
+		}
+	}
+	if n.Close {
+		buffer.WriteString("&-")
+	} else if n.DupFrom >= 0 {
+		fmt.Fprintf(&buffer, "&%d", n.DupFrom)
+	} else if n.Target != nil {
+		buffer.WriteString(n.Target.Text)
+	}
+	return buffer.String()
+}
+
+// Walk calls f for node and its descendants in depth-first order.
+// When f returns false, the children of the node are skipped.
+func Walk(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *SequenceNode:
+		for _, item := range n.Items {
+			Walk(item, f)
+		}
+	case *AsyncNode:
+		Walk(n.Body, f)
+	case *AndOrNode:
+		Walk(n.Left, f)
+		Walk(n.Right, f)
+	case *PipelineNode:
+		for _, cmd := range n.Commands {
+			Walk(cmd, f)
+		}
+	case *SubshellNode:
+		Walk(n.Body, f)
+		for _, r := range n.Redirects {
+			Walk(r, f)
+		}
+	case *GroupNode:
+		Walk(n.Body, f)
+		for _, r := range n.Redirects {
+			Walk(r, f)
+		}
+	case *CommandNode:
+		for _, w := range n.Words {
+			Walk(w, f)
+		}
+		for _, r := range n.Redirects {
+			Walk(r, f)
+		}
+	case *RedirectNode:
+		if n.Target != nil {
+			Walk(n.Target, f)
+		}
+	}
+}
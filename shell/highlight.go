@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"strings"
+)
+
+// The kinds of HighlightSpan
+const (
+	HlCommand  = iota + 1 // the command-name
+	HlQuote               // "..." or '...'
+	HlVariable            // %VAR%
+	HlRedirect            // the redirection such as `>`, `2>&1` and `<<`
+	HlOperator            // `|`, `&&`, `;` and so on
+	HlError               // the quotation not closed
+)
+
+// HighlightSpan is the part of the command-line to be coloured.
+// Start and End are the byte offsets.
+type HighlightSpan struct {
+	Kind  int
+	Start int
+	End   int
+}
+
+// highlightWord appends the spans of the quotations and the variables
+// in the word at pos.
+func highlightWord(spans []HighlightSpan, pos int, word string) []HighlightSpan {
+	quote := NOTQUOTED
+	quoteIndex := -1
+	yenCount := 0
+	for i := 0; i < len(word); i++ {
+		ch := rune(word[i])
+		if quote == NOTQUOTED && yenCount%2 == 0 && (ch == '"' || ch == '\'') {
+			quote = ch
+			quoteIndex = len(spans)
+			spans = append(spans, HighlightSpan{Kind: HlQuote, Start: pos + i})
+		} else if quote != NOTQUOTED && yenCount%2 == 0 && ch == quote {
+			spans[quoteIndex].End = pos + i + 1
+			quote = NOTQUOTED
+		} else if ch == '%' && quote != '\'' {
+			n := strings.IndexByte(word[i+1:], '%')
+			if n > 0 && !strings.ContainsAny(word[i+1:i+1+n], " \t\"'") {
+				spans = append(spans, HighlightSpan{Kind: HlVariable, Start: pos + i, End: pos + i + n + 2})
+				i += n + 1
+				yenCount = 0
+				continue
+			}
+		}
+		if ch == '\\' {
+			yenCount++
+		} else {
+			yenCount = 0
+		}
+	}
+	if quote != NOTQUOTED {
+		spans[quoteIndex].Kind = HlError
+		spans[quoteIndex].End = pos + len(word)
+	}
+	return spans
+}
+
+// redirectEnd returns the end of the operator of the redirection r.
+func redirectEnd(text string, r *RedirectNode) int {
+	end := r.Position
+	for end < len(text) && strings.IndexByte("0123456789<>&|!-", text[end]) >= 0 {
+		end++
+	}
+	if r.Target != nil && r.Target.Position < end {
+		end = r.Target.Position
+	}
+	return end
+}
+
+// Highlight splits the command-line into the spans to be coloured
+// with the tokenizer of the parser. The later spans overlap the earlier ones.
+// It returns nil when the command-line can not be tokenized.
+func Highlight(text string) []HighlightSpan {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil
+	}
+	isVerbatim := func(pos int, word string) bool {
+		return pos+len(word) <= len(text) && text[pos:pos+len(word)] == word
+	}
+	spans := []HighlightSpan{}
+	commandStart := true
+	for _, tk := range tokens {
+		switch tk.kind {
+		case tkOperator:
+			spans = append(spans, HighlightSpan{Kind: HlOperator, Start: tk.pos, End: tk.pos + len(tk.text)})
+			commandStart = (tk.text != ")" && tk.text != "}")
+		case tkRedirect:
+			spans = append(spans, HighlightSpan{Kind: HlRedirect, Start: tk.pos, End: redirectEnd(text, tk.redirect)})
+			if target := tk.redirect.Target; target != nil && isVerbatim(target.Position, target.Text) {
+				spans = highlightWord(spans, target.Position, target.Text)
+			}
+		case tkWord:
+			if !isVerbatim(tk.pos, tk.text) {
+				commandStart = false
+				continue
+			}
+			spans = highlightWord(spans, tk.pos, tk.text)
+			if commandStart {
+				spans = append(spans, HighlightSpan{Kind: HlCommand, Start: tk.pos, End: tk.pos + len(tk.text)})
+			}
+			commandStart = false
+		}
+	}
+	return spans
+}
@@ -5,14 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"reflect"
 	"strings"
 	"sync"
 	"syscall"
+	"unicode/utf8"
 
 	"github.com/zetamatta/go-findfile"
+	"github.com/zetamatta/go-mbcs"
 
 	"github.com/zetamatta/nyagos/defined"
 	"github.com/zetamatta/nyagos/dos"
@@ -50,6 +53,10 @@ type Shell struct {
 	Console      io.Writer
 	tag          CloneCloser
 	IsBackGround bool
+	// extraFiles[i] is the file-descriptor 3+i.
+	extraFiles []*os.File
+	// job is the background job which the shell runs for.
+	job *Job
 }
 
 func (sh *Shell) In() io.Reader          { return sh.Stdin }
@@ -59,10 +66,48 @@ func (sh *Shell) Term() io.Writer        { return sh.Console }
 func (sh *Shell) Tag() CloneCloser       { return sh.tag }
 func (sh *Shell) SetTag(tag CloneCloser) { sh.tag = tag }
 
+// File returns the file of the file-descriptor fd. It returns nil when fd is not opened.
+func (sh *Shell) File(fd int) *os.File {
+	switch fd {
+	case 0:
+		return sh.Stdin
+	case 1:
+		return sh.Stdout
+	case 2:
+		return sh.Stderr
+	}
+	if fd >= 3 && fd-3 < len(sh.extraFiles) {
+		return sh.extraFiles[fd-3]
+	}
+	return nil
+}
+
+func (sh *Shell) setFile(fd int, file *os.File) {
+	switch fd {
+	case 0:
+		sh.Stdin = file
+	case 1:
+		sh.Stdout = file
+	case 2:
+		sh.Stderr = file
+	default:
+		// copy not to change the parent's one.
+		size := len(sh.extraFiles)
+		if fd-3 >= size {
+			size = fd - 2
+		}
+		files := make([]*os.File, size)
+		copy(files, sh.extraFiles)
+		files[fd-3] = file
+		sh.extraFiles = files
+	}
+}
+
 type Cmd struct {
 	Shell
 	args            []string
 	rawArgs         []string
+	sourceArgs      []string
 	fullPath        string
 	UseShellExecute bool
 	Closers         []io.Closer
@@ -75,6 +120,11 @@ func (cmd *Cmd) RawArg(n int) string   { return cmd.rawArgs[n] }
 func (cmd *Cmd) RawArgs() []string     { return cmd.rawArgs }
 func (cmd *Cmd) SetRawArgs(s []string) { cmd.rawArgs = s }
 
+// SourceArgs returns the arguments before quotations, variables and
+// command substitutions are expanded. It is nil when the command was not
+// made from the command-line.
+func (cmd *Cmd) SourceArgs() []string { return cmd.sourceArgs }
+
 var LookCurdirOrder = dos.LookCurdirFirst
 
 func (cmd *Cmd) FullPath() string {
@@ -110,11 +160,13 @@ func New() *Shell {
 func (sh *Shell) Command() *Cmd {
 	cmd := &Cmd{
 		Shell: Shell{
-			Stdin:   sh.Stdin,
-			Stdout:  sh.Stdout,
-			Stderr:  sh.Stderr,
-			Console: sh.Console,
-			tag:     sh.tag,
+			Stdin:      sh.Stdin,
+			Stdout:     sh.Stdout,
+			Stderr:     sh.Stderr,
+			Console:    sh.Console,
+			tag:        sh.tag,
+			extraFiles: sh.extraFiles,
+			job:        sh.job,
 		},
 	}
 	if sh.session != nil {
@@ -154,6 +206,14 @@ var OnCommandNotFound = func(ctx context.Context, cmd *Cmd, err error) error {
 
 var LastErrorLevel int
 
+// PipeStatus is the list of the errorlevels of the members of
+// the last foreground pipeline.
+var PipeStatus = []int{0}
+
+// PipeFail is the switch to make the errorlevel of the pipeline
+// that of the last member which failed.
+var PipeFail = false
+
 func makeCmdline(args, rawargs []string) string {
 	var buffer strings.Builder
 	for i, s := range args {
@@ -207,6 +267,9 @@ func (cmd *Cmd) spawnvpSilent(ctx context.Context) (int, error) {
 	if defined.DBG {
 		print("exec.LookPath(", cmd.args[0], ")==", fullpath, "\n")
 	}
+	if err := cmd.checkExtraFiles(); err != nil {
+		return 255, err
+	}
 	if WildCardExpansionAlways {
 		cmd.args = findfile.Globs(cmd.args)
 	}
@@ -242,7 +305,13 @@ func (cmd *Cmd) spawnvpSilent(ctx context.Context) (int, error) {
 		println(cmdline)
 	}
 	xcmd.SysProcAttr.CmdLine = cmdline
-	err := xcmd.Run()
+	err := xcmd.Start()
+	if err == nil {
+		if cmd.job != nil {
+			cmd.job.addProcess(xcmd.Process)
+		}
+		err = xcmd.Wait()
+	}
 	errorlevel, errorlevelOk := dos.GetErrorLevel(xcmd)
 	if errorlevelOk {
 		return errorlevel, err
@@ -266,7 +335,7 @@ func IsAlreadyReported(err error) bool {
 
 func (cmd *Cmd) Spawnvp(ctx context.Context) (int, error) {
 	errorlevel, err := cmd.spawnvpSilent(ctx)
-	if err != nil && err != io.EOF && !IsAlreadyReported(err) {
+	if err != nil && err != io.EOF && !IsAlreadyReported(err) && !IsControlFlow(err) {
 		if defined.DBG {
 			val := reflect.ValueOf(err)
 			fmt.Fprintf(cmd.Stderr, "error-type=%s\n", val.Type())
@@ -285,153 +354,359 @@ func (sh *Shell) Spawnlp(ctx context.Context, args, rawargs []string) (int, erro
 	return cmd.Spawnvp(ctx)
 }
 
+// captureOutput executes cmdline and returns its standard output
+// for the command substitution.
+func (sh *Shell) captureOutput(ctx context.Context, cmdline string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	cmd := sh.Command()
+	cmd.Stdout = w
+	done := make(chan error, 1)
+	go func() {
+		_, err := cmd.Interpret(ctx, cmdline)
+		w.Close()
+		done <- err
+	}()
+	output, err := ioutil.ReadAll(r)
+	r.Close()
+	interpretErr := <-done
+	cmd.Close()
+	if err != nil {
+		return "", err
+	}
+	if interpretErr != nil && interpretErr != io.EOF && !IsAlreadyReported(interpretErr) {
+		return "", interpretErr
+	}
+	var text string
+	if utf8.Valid(output) {
+		text = string(output)
+	} else if text, err = mbcs.AtoU(output); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(text, "\r\n"), nil
+}
+
 func (sh *Shell) Interpret(ctx context.Context, text string) (errorlevel int, finalerr error) {
+	return sh.interpret(ctx, text, nil)
+}
+
+// interpret executes text reading its here-documents from stream.
+func (sh *Shell) interpret(ctx context.Context, text string, stream Stream) (errorlevel int, finalerr error) {
 	if defined.DBG {
 		print("Interpret('", text, "')\n")
 	}
 	if sh == nil {
 		return 255, errors.New("Fatal Error: Interpret: instance is nil")
 	}
-	errorlevel = 0
-	finalerr = nil
-
-	statements, statementsErr := Parse(text)
-	if statementsErr != nil {
+	node, err := ParseTree(text)
+	if err != nil {
 		if defined.DBG {
-			print("Parse Error:", statementsErr.Error(), "\n")
+			print("Parse Error:", err.Error(), "\n")
 		}
-		return 0, statementsErr
+		return 0, err
 	}
-	if argsHook != nil {
-		if defined.DBG {
-			print("call argsHook\n")
+	if node == nil {
+		return 0, nil
+	}
+	if err := sh.readHereDocuments(ctx, node, stream); err != nil {
+		return 0, err
+	}
+	return sh.run(ctx, node)
+}
+
+// isFatal returns true when err should stop the rest of the command-line.
+func isFatal(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err1, ok := err.(AlreadyReportedError); ok {
+		return err1.Err == io.EOF
+	}
+	return true
+}
+
+// subShell returns the copy of sh to change its standard I/O.
+func (sh *Shell) subShell() *Shell {
+	sub := *sh
+	return &sub
+}
+
+// goBackground executes f on the goroutine with the clone of the tag.
+func (sh *Shell) goBackground(ctx context.Context, f func(context.Context, *Shell)) error {
+	bg := sh.subShell()
+	if tag := bg.Tag(); tag != nil {
+		newctx, newtag, err := tag.Clone(ctx)
+		if err != nil {
+			return err
 		}
-		for _, pipeline := range statements {
-			for _, state := range pipeline {
-				var err error
-				state.Args, err = argsHook(ctx, sh, state.Args)
-				if err != nil {
-					return 255, err
-				}
+		ctx = newctx
+		bg.SetTag(newtag)
+	}
+	go func() {
+		f(ctx, bg)
+		if tag := bg.Tag(); tag != nil {
+			if err := tag.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 			}
 		}
-		if defined.DBG {
-			print("done argsHook\n")
-		}
+	}()
+	return nil
+}
+
+func reportError(w io.Writer, err error) {
+	if err != nil && err != io.EOF && !IsAlreadyReported(err) && !IsControlFlow(err) {
+		fmt.Fprintln(w, err.Error())
 	}
-	for _, pipeline := range statements {
-		for i, state := range pipeline {
-			if state.Term == "|" && (i+1 >= len(pipeline) || len(pipeline[i+1].Args) <= 0) {
-				return 255, errors.New("The syntax of the command is incorrect.")
+}
+
+// run executes the syntax tree made by ParseTree.
+func (sh *Shell) run(ctx context.Context, node Node) (int, error) {
+	switch n := node.(type) {
+	case *SequenceNode:
+		errorlevel := 0
+		var err error
+		for _, item := range n.Items {
+			errorlevel, err = sh.run(ctx, item)
+			if isFatal(err) {
+				return errorlevel, err
 			}
 		}
+		return errorlevel, err
+	case *AsyncNode:
+		job, jobctx := newJob(ctx, n.Body.String())
+		err := sh.goBackground(jobctx, func(ctx1 context.Context, bg *Shell) {
+			bg.IsBackGround = true
+			bg.job = job
+			errorlevel, err := bg.run(ctx1, n.Body)
+			reportError(bg.Stderr, err)
+			job.finish(errorlevel)
+		})
+		if err != nil {
+			job.finish(-1)
+			fmt.Fprintln(os.Stderr, err.Error())
+			return -1, err
+		}
+		return 0, nil
+	case *AndOrNode:
+		errorlevel, err := sh.run(ctx, n.Left)
+		if isFatal(err) {
+			return errorlevel, err
+		}
+		if (n.Op == "&&") != (errorlevel == 0) {
+			return errorlevel, nil
+		}
+		return sh.run(ctx, n.Right)
+	case *PipelineNode:
+		return sh.runPipeline(ctx, n)
+	case *SubshellNode:
+		if sh.IsBackGround {
+			// on the other goroutine than the foreground.
+			return sh.runSubshellProcess(ctx, n)
+		}
+		defer saveEnvironment()()
+		return sh.runGroup(ctx, n.Body, n.Redirects)
+	case *GroupNode:
+		return sh.runGroup(ctx, n.Body, n.Redirects)
+	case *CommandNode:
+		return sh.runCommand(ctx, n, true)
 	}
+	return 255, fmt.Errorf("Fatal Error: unknown node %T", node)
+}
 
-	for _, pipeline := range statements {
+func (sh *Shell) substituter(ctx context.Context) substituteFunc {
+	return func(cmdline string) (string, error) {
+		return sh.captureOutput(ctx, cmdline)
+	}
+}
 
-		var pipeIn *os.File = nil
-		isBackGround := sh.IsBackGround
-		for _, state := range pipeline {
-			if state.Term == "&" {
-				isBackGround = true
-				break
-			}
+// ExpandArgs expands quotations, variables and command substitutions
+// of source as arguments of a command.
+func (sh *Shell) ExpandArgs(ctx context.Context, source []string) (rawArgs []string, args []string, err error) {
+	words := make([]*WordNode, len(source))
+	for i, s := range source {
+		words[i] = &WordNode{Text: s}
+	}
+	return (&CommandNode{Words: words}).expand(sh.substituter(ctx), nil)
+}
+
+func (sh *Shell) runCommand(ctx context.Context, n *CommandNode, standalone bool) (int, error) {
+	subst := sh.substituter(ctx)
+	var procs processSubstitutions
+	defer func() { procs.cleanup(ctx, sh) }()
+	procSubst := procs.starter(ctx, sh)
+	rawArgs, args, err := n.expand(subst, procSubst)
+	if err != nil {
+		return 0, err
+	}
+	if argsHook != nil {
+		if defined.DBG {
+			print("call argsHook\n")
 		}
-		var wg sync.WaitGroup
-		shutdown_immediately := false
-		for i, state := range pipeline {
-			if defined.DBG {
-				print(i, ": pipeline loop(", state.Args[0], ")\n")
-			}
-			cmd := sh.Command()
-			cmd.IsBackGround = isBackGround
+		args, err = argsHook(ctx, sh, args)
+		if err != nil {
+			return 255, err
+		}
+	}
+	cmd := sh.Command()
+	cmd.IsBackGround = sh.IsBackGround
+	defer cmd.Close()
 
-			if pipeIn != nil {
-				cmd.Stdin = pipeIn
-				cmd.Closers = append(cmd.Closers, pipeIn)
-				pipeIn = nil
-			}
+	cmd.Closers, err = cmd.openRedirects(n.Redirects, subst, procSubst)
+	if err != nil {
+		return 0, err
+	}
+	if len(args) <= 0 {
+		// command substitution was expanded to nothing.
+		return 0, nil
+	}
+	cmd.args = args
+	cmd.rawArgs = rawArgs
+	cmd.sourceArgs = make([]string, len(n.Words))
+	for i, word := range n.Words {
+		cmd.sourceArgs[i] = word.Text
+	}
+	if standalone && dos.IsGui(cmd.FullPath()) {
+		cmd.UseShellExecute = true
+	}
+	procs.waitInputs()
+	errorlevel, err := cmd.Spawnvp(ctx)
+	if standalone && !sh.IsBackGround {
+		LastErrorLevel = errorlevel
+		PipeStatus = []int{errorlevel}
+	}
+	return errorlevel, err
+}
 
-			var err error
-			if state.Term[0] == '|' {
-				var pipeOut *os.File
-				pipeIn, pipeOut, err = os.Pipe()
-				cmd.Stdout = pipeOut
-				if state.Term == "|&" {
-					cmd.Stderr = pipeOut
-				}
-				cmd.Closers = append(cmd.Closers, pipeOut)
-			}
+func (sh *Shell) runMember(ctx context.Context, node Node) (int, error) {
+	if cmd, ok := node.(*CommandNode); ok {
+		return sh.runCommand(ctx, cmd, false)
+	}
+	return sh.run(ctx, node)
+}
 
-			for _, red := range state.Redirect {
-				var fd *os.File
-				fd, err = red.OpenOn(cmd)
-				if err != nil {
-					return 0, err
-				}
-				cmd.Closers = append(cmd.Closers, fd)
-			}
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
 
-			cmd.args = state.Args
-			cmd.rawArgs = state.RawArgs
-			if i > 0 {
-				cmd.IsBackGround = true
-			}
-			if len(pipeline) == 1 && dos.IsGui(cmd.FullPath()) {
-				cmd.UseShellExecute = true
+func (sh *Shell) runPipeline(ctx context.Context, n *PipelineNode) (errorlevel int, finalerr error) {
+	var pipeIn *os.File
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	last := len(n.Commands) - 1
+	status := make([]int, len(n.Commands))
+	for i, node := range n.Commands {
+		if defined.DBG {
+			print(i, ": pipeline loop(", node.String(), ")\n")
+		}
+		member := sh.subShell()
+		// the members run concurrently, so only the pipeline itself
+		// sets the errorlevels of them.
+		member.IsBackGround = sh.IsBackGround || last > 0
+		closers := make([]io.Closer, 0, 2)
+
+		if pipeIn != nil {
+			member.Stdin = pipeIn
+			closers = append(closers, pipeIn)
+			pipeIn = nil
+		}
+		if i < last {
+			var pipeOut *os.File
+			var err error
+			pipeIn, pipeOut, err = os.Pipe()
+			if err != nil {
+				closeAll(closers)
+				return 255, err
 			}
-			if i == len(pipeline)-1 && state.Term != "&" {
-				// foreground execution.
-				errorlevel, finalerr = cmd.Spawnvp(ctx)
-				LastErrorLevel = errorlevel
-				cmd.Close()
-			} else {
-				// background
-				if !isBackGround {
-					wg.Add(1)
-				}
-				newctx := ctx
-				if tag := cmd.Tag(); tag != nil {
-					var newtag CloneCloser
-					if newctx, newtag, err = tag.Clone(ctx); err != nil {
-						fmt.Fprintln(os.Stderr, err.Error())
-						return -1, err
-					} else {
-						cmd.SetTag(newtag)
-					}
-				}
-				go func(ctx1 context.Context, cmd1 *Cmd) {
-					if !isBackGround {
-						defer wg.Done()
-					}
-					cmd1.Spawnvp(ctx1)
-					if tag := cmd1.Tag(); tag != nil {
-						if err := tag.Close(); err != nil {
-							fmt.Fprintln(os.Stderr, err.Error())
-						}
-					}
-					cmd1.Close()
-				}(newctx, cmd)
+			member.Stdout = pipeOut
+			if n.Pipes[i] == "|&" {
+				member.Stderr = pipeOut
 			}
+			closers = append(closers, pipeOut)
 		}
-		if !isBackGround {
+		if i == last {
+			// foreground execution.
+			errorlevel, finalerr = member.runMember(ctx, node)
+			closeAll(closers)
+			status[i] = errorlevel
 			wg.Wait()
-			if shutdown_immediately {
-				return errorlevel, nil
-			}
-			if len(pipeline) > 0 {
-				switch pipeline[len(pipeline)-1].Term {
-				case "&&":
-					if errorlevel != 0 {
-						return errorlevel, nil
-					}
-				case "||":
-					if errorlevel == 0 {
-						return errorlevel, nil
+			if PipeFail {
+				for _, rc := range status {
+					if rc != 0 {
+						errorlevel = rc
 					}
 				}
 			}
+			if !sh.IsBackGround {
+				LastErrorLevel = errorlevel
+				PipeStatus = status
+			}
+			break
+		}
+		wg.Add(1)
+		index := i
+		err := member.goBackground(ctx, func(ctx1 context.Context, bg *Shell) {
+			defer wg.Done()
+			var err error
+			status[index], err = bg.runMember(ctx1, node)
+			reportError(bg.Stderr, err)
+			closeAll(closers)
+		})
+		if err != nil {
+			wg.Done()
+			closeAll(closers)
+			if pipeIn != nil {
+				pipeIn.Close()
+			}
+			fmt.Fprintln(os.Stderr, err.Error())
+			return -1, err
 		}
 	}
 	return
 }
+
+// runGroup executes the commands enclosed with parentheses or braces.
+func (sh *Shell) runGroup(ctx context.Context, body Node, redirects []*RedirectNode) (int, error) {
+	sub := sh.subShell()
+	var procs processSubstitutions
+	defer func() { procs.cleanup(ctx, sh) }()
+	closers, err := sub.openRedirects(redirects, sh.substituter(ctx), procs.starter(ctx, sh))
+	if err != nil {
+		return 0, err
+	}
+	defer closeAll(closers)
+	procs.waitInputs()
+	return sub.run(ctx, body)
+}
+
+// saveEnvironment returns the function to restore the current directory
+// and the environment variables, which the subshell in the foreground may change.
+func saveEnvironment() func() {
+	wd, wdErr := os.Getwd()
+	saved := make(map[string]string)
+	for _, env := range os.Environ() {
+		if pair := strings.SplitN(env, "=", 2); len(pair) == 2 && pair[0] != "" {
+			saved[pair[0]] = pair[1]
+		}
+	}
+	return func() {
+		for _, env := range os.Environ() {
+			pair := strings.SplitN(env, "=", 2)
+			if _, ok := saved[pair[0]]; !ok && pair[0] != "" {
+				os.Unsetenv(pair[0])
+			}
+		}
+		for key, value := range saved {
+			if os.Getenv(key) != value {
+				os.Setenv(key, value)
+			}
+		}
+		if wdErr == nil {
+			os.Chdir(wd)
+		}
+	}
+}
@@ -3,6 +3,13 @@ package shell
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -20,3 +27,214 @@ func TestMain(t *testing.T) {
 		t.Fatalf(`Fail "%s" != "%s"`, out, tst)
 	}
 }
+
+// testHook runs echo, cat, fd, set, wait and exit as built-in commands for the tests.
+func testHook(ctx context.Context, cmd *Cmd) (int, bool, error) {
+	switch cmd.args[0] {
+	case "echo":
+		fmt.Fprintln(cmd.Stdout, strings.Join(cmd.args[1:], " "))
+		return 0, true, nil
+	case "cat":
+		io.Copy(cmd.Stdout, cmd.Stdin)
+		return 0, true, nil
+	case "fd":
+		fd, _ := strconv.Atoi(cmd.args[1])
+		fmt.Fprintln(cmd.File(fd), strings.Join(cmd.args[2:], " "))
+		return 0, true, nil
+	case "set":
+		if eq := strings.IndexRune(cmd.args[1], '='); eq >= 0 {
+			os.Setenv(cmd.args[1][:eq], cmd.args[1][eq+1:])
+		}
+		return 0, true, nil
+	case "wait":
+		for _, job := range Jobs() {
+			job.Wait(ctx)
+		}
+		return 0, true, nil
+	case "exit":
+		rc, _ := strconv.Atoi(cmd.args[1])
+		return rc, true, nil
+	}
+	return 0, false, nil
+}
+
+// testSubshellProcess runs the subshell with TestHelperProcess of the test binary.
+func testSubshellProcess(cmdline string) (*exec.Cmd, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "NYAGOS_TEST_SUBSHELL="+cmdline)
+	return cmd, nil
+}
+
+// TestHelperProcess is not a test, but the subshell process for testSubshellProcess.
+func TestHelperProcess(t *testing.T) {
+	cmdline, ok := os.LookupEnv("NYAGOS_TEST_SUBSHELL")
+	if !ok {
+		return
+	}
+	os.Unsetenv("NYAGOS_TEST_SUBSHELL")
+	SetHook(testHook)
+	SubshellProcess = testSubshellProcess
+	errorlevel, _ := New().Interpret(context.Background(), cmdline)
+	os.Exit(errorlevel)
+}
+
+// runScript runs the lines of script and returns the standard output.
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+	defer SetHook(SetHook(testHook))
+	defer func(f func(string) (*exec.Cmd, error)) { SubshellProcess = f }(SubshellProcess)
+	SubshellProcess = testSubshellProcess
+
+	out, err := ioutil.TempFile("", "nyagos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	sh := New()
+	sh.Stdout = out
+	_, err = sh.Loop(context.Background(), NewCmdStreamFile(strings.NewReader(script)))
+	if err != nil && err != io.EOF {
+		t.Fatalf("%q: %s", script, err)
+	}
+	output, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestHereDocument(t *testing.T) {
+	os.Setenv("HEREDOC_TEST", "value")
+	defer os.Unsetenv("HEREDOC_TEST")
+	os.Unsetenv("PROMPT")
+
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"cat <<EOF\nfoo\n%HEREDOC_TEST%\nEOF\n", "foo\nvalue\n"},
+		{"cat <<'EOF'\nfoo\n%HEREDOC_TEST%\nEOF\n", "foo\n%HEREDOC_TEST%\n"},
+		{"cat <<\"EOF\"\n%HEREDOC_TEST%\nEOF\n", "%HEREDOC_TEST%\n"},
+		{"cat <<-EOF\n\t\tfoo\n  bar\n\tEOF\n", "foo\n  bar\n"},
+		{"cat <<EOF\nfoo\nEOF\necho bar\n", "foo\nbar\n"},
+		{"cat <<<%HEREDOC_TEST%\n", "value\n"},
+		{"cat <<<\"foo bar\"\n", "foo bar\n"},
+		{"echo $(cat <<EOF)\necho foo\n", "foo\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+	if prompt, ok := os.LookupEnv("PROMPT"); ok {
+		t.Errorf("PROMPT is %q after here-documents", prompt)
+	}
+}
+
+func TestFileDescriptors(t *testing.T) {
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"fd 3 foo 3>&1\n", "foo\n"},
+		{"fd 1 foo 4>&1 1>&4 4>&-\n", "foo\n"},
+		{"echo foo >&-\necho bar\n", "bar\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "nyagos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the test binary itself as an external command which must not run.
+	line := fmt.Sprintf(`"%s" -test.run=NONE 3>"%s"`, os.Args[0], filepath.Join(dir, "fd3"))
+	if _, err := New().Interpret(context.Background(), line); err == nil {
+		t.Errorf("%s: no error for the external command with fd 3", line)
+	}
+	// the batch file which must not run, too.
+	batch := filepath.Join(dir, "test.cmd")
+	if err := ioutil.WriteFile(batch, []byte("@echo off\r\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	line = fmt.Sprintf(`"%s" 3>"%s"`, batch, filepath.Join(dir, "fd3"))
+	if _, err := New().Interpret(context.Background(), line); err == nil {
+		t.Errorf("%s: no error for the batch file with fd 3", line)
+	}
+}
+
+func TestProcessSubstitutionRedirect(t *testing.T) {
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"cat < <(echo foo)\n", "foo\n"},
+		{"echo foo > >(cat)\n", "foo\n"},
+		{"{ cat ; } < <(echo foo)\n", "foo\n"},
+		{"{ echo foo ; } > >(cat)\n", "foo\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+
+	path := strings.TrimSpace(runScript(t, "echo <(echo foo)\n"))
+	if !strings.HasPrefix(filepath.Base(path), "nyagos-psub-") {
+		t.Fatalf("%q is not the temporary file", path)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s is not removed", path)
+	}
+}
+
+func TestPipeStatus(t *testing.T) {
+	defer func(pipeFail bool) { PipeFail = pipeFail }(PipeFail)
+
+	tests := []struct {
+		pipeFail bool
+		script   string
+		expect   string
+	}{
+		{false, "exit 1 | exit 2 | exit 0\necho %PIPESTATUS% %ERRORLEVEL%\n", "1 2 0 0\n"},
+		{true, "exit 1 | exit 2 | exit 0\necho %PIPESTATUS% %ERRORLEVEL%\n", "1 2 0 2\n"},
+		{true, "exit 0 | exit 0\necho %PIPESTATUS% %ERRORLEVEL%\n", "0 0 0\n"},
+		{false, "exit 3\necho %PIPESTATUS% %?%\n", "3 3\n"},
+		{false, "( exit 1 ) | { exit 2 ; } | exit 0\necho %PIPESTATUS%\n", "1 2 0\n"},
+		{true, "{ exit 4 ; exit 0 ; } | ( exit 5 )\necho %PIPESTATUS% %ERRORLEVEL%\n", "0 5 5\n"},
+		{false, "exit 6\n( exit 1 ) | echo %?%\n", "6\n"},
+	}
+	for _, test := range tests {
+		PipeFail = test.pipeFail
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("pipefail=%v %q: %q != %q", test.pipeFail, test.script, result, test.expect)
+		}
+	}
+}
+
+func TestSubshell(t *testing.T) {
+	defer os.Unsetenv("SUBSHELL_TEST")
+	os.Setenv("SUBSHELL_TEST", "parent")
+
+	tests := []struct {
+		script string
+		expect string
+	}{
+		{"( set SUBSHELL_TEST=child ; echo %SUBSHELL_TEST% )\necho %SUBSHELL_TEST%\n", "child\nparent\n"},
+		{"( set SUBSHELL_TEST=child ; echo %SUBSHELL_TEST% ) | cat\necho %SUBSHELL_TEST%\n", "child\nparent\n"},
+		{"echo foo | ( set SUBSHELL_TEST=child ; cat )\necho %SUBSHELL_TEST%\n", "foo\nparent\n"},
+		{"( exit 3 ) | ( exit 0 )\necho %PIPESTATUS%\n", "3 0\n"},
+		{"( set SUBSHELL_TEST=child ) &\nwait\necho %SUBSHELL_TEST%\n", "parent\n"},
+	}
+	for _, test := range tests {
+		if result := runScript(t, test.script); result != test.expect {
+			t.Errorf("%q: %q != %q", test.script, result, test.expect)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is the pipeline executed in background with `&`.
+type Job struct {
+	ID         int
+	Cmdline    string
+	StartTime  time.Time
+	ErrorLevel int
+
+	mutex     sync.Mutex
+	processes []*os.Process
+	done      chan struct{}
+	cancel    context.CancelFunc
+}
+
+// jobContext keeps the values of the context which started the job,
+// but is not canceled with it. The job is canceled only by Kill.
+type jobContext struct {
+	context.Context
+}
+
+func (jobContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (jobContext) Done() <-chan struct{}       { return nil }
+func (jobContext) Err() error                  { return nil }
+
+var jobMutex sync.Mutex
+var jobTable = map[int]*Job{}
+
+// newJob registers the job for cmdline to the job table and returns it
+// with the context which the job should run with.
+func newJob(ctx context.Context, cmdline string) (*Job, context.Context) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	id := 1
+	for id1 := range jobTable {
+		if id1 >= id {
+			id = id1 + 1
+		}
+	}
+	ctx, cancel := context.WithCancel(jobContext{ctx})
+	job := &Job{
+		ID:        id,
+		Cmdline:   cmdline,
+		StartTime: time.Now(),
+		done:      make(chan struct{}),
+		cancel:    cancel,
+	}
+	jobTable[id] = job
+	return job, ctx
+}
+
+func (job *Job) remove() {
+	jobMutex.Lock()
+	delete(jobTable, job.ID)
+	jobMutex.Unlock()
+}
+
+func (job *Job) addProcess(p *os.Process) {
+	job.mutex.Lock()
+	job.processes = append(job.processes, p)
+	job.mutex.Unlock()
+}
+
+func (job *Job) finish(errorlevel int) {
+	job.ErrorLevel = errorlevel
+	close(job.done)
+	job.cancel()
+}
+
+// Pids returns the process-ids which the job has started.
+func (job *Job) Pids() []int {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	pids := make([]int, len(job.processes))
+	for i, p := range job.processes {
+		pids[i] = p.Pid
+	}
+	return pids
+}
+
+// Done returns true when the job has finished.
+func (job *Job) Done() bool {
+	select {
+	case <-job.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits until the job finishes, removes it from the job table
+// and returns its errorlevel.
+func (job *Job) Wait(ctx context.Context) (int, error) {
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+	job.remove()
+	return job.ErrorLevel, nil
+}
+
+// Kill cancels the built-in commands of the job, kills its processes
+// which are still running and removes it from the job table.
+func (job *Job) Kill() error {
+	job.cancel()
+	job.remove()
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	var result error
+	for _, p := range job.processes {
+		if err := p.Kill(); err != nil && err != os.ErrProcessDone && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Status returns the text like `Running`, `Done` or `Exit 1`.
+func (job *Job) Status() string {
+	if !job.Done() {
+		return "Running"
+	}
+	if job.ErrorLevel != 0 {
+		return fmt.Sprintf("Exit %d", job.ErrorLevel)
+	}
+	return "Done"
+}
+
+func (job *Job) String() string {
+	return fmt.Sprintf("[%d] %-10s %s", job.ID, job.Status(), job.Cmdline)
+}
+
+// Jobs returns the jobs in the job table sorted by ID.
+func Jobs() []*Job {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	jobs := make([]*Job, 0, len(jobTable))
+	for _, job := range jobTable {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// ErrNoSuchJob is returned by FindJob when the job does not exist.
+var ErrNoSuchJob = errors.New("no such job")
+
+// FindJob returns the job for the job-spec `%N`, `%%` or `%+`
+// (the latest job) and `%STRING` (the job whose command-line starts with STRING).
+func FindJob(spec string) (*Job, error) {
+	if !strings.HasPrefix(spec, "%") {
+		return nil, fmt.Errorf("%s: %s", spec, ErrNoSuchJob)
+	}
+	key := spec[1:]
+	jobs := Jobs()
+	if key == "" || key == "%" || key == "+" {
+		if len(jobs) <= 0 {
+			return nil, fmt.Errorf("%s: %s", spec, ErrNoSuchJob)
+		}
+		return jobs[len(jobs)-1], nil
+	}
+	if id, err := strconv.Atoi(key); err == nil {
+		for _, job := range jobs {
+			if job.ID == id {
+				return job, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %s", spec, ErrNoSuchJob)
+	}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if strings.HasPrefix(jobs[i].Cmdline, key) {
+			return jobs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %s", spec, ErrNoSuchJob)
+}
+
+// ReportDoneJobs prints the notices of finished jobs like `[1] Done  CMDLINE`
+// and removes them from the job table. It is called before the prompt.
+func ReportDoneJobs(w io.Writer) {
+	for _, job := range Jobs() {
+		if job.Done() {
+			fmt.Fprintln(w, job.String())
+			job.remove()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestJobTable(t *testing.T) {
+	if jobs := Jobs(); len(jobs) > 0 {
+		t.Fatalf("%v are left by the other tests", jobs)
+	}
+	defer func() {
+		for _, job := range Jobs() {
+			job.remove()
+		}
+	}()
+	job1, ctx1 := newJob(context.Background(), "sleep 10")
+	job2, _ := newJob(context.Background(), "echo foo")
+	if job1.ID != 1 || job2.ID != 2 {
+		t.Fatalf("IDs are %d and %d", job1.ID, job2.ID)
+	}
+
+	tests := map[string]*Job{
+		"%1":     job1,
+		"%2":     job2,
+		"%%":     job2,
+		"%+":     job2,
+		"%":      job2,
+		"%sleep": job1,
+		"%echo":  job2,
+	}
+	for spec, expect := range tests {
+		if job, err := FindJob(spec); err != nil || job != expect {
+			t.Errorf("%s: %v,%v != %v", spec, job, err, expect)
+		}
+	}
+	for _, spec := range []string{"%3", "%cat", "1"} {
+		if _, err := FindJob(spec); err == nil {
+			t.Errorf("%s: no error", spec)
+		}
+	}
+
+	job2.finish(0)
+	var buffer strings.Builder
+	ReportDoneJobs(&buffer)
+	if result := buffer.String(); result != "[2] Done       echo foo\n" {
+		t.Errorf("ReportDoneJobs: %q", result)
+	}
+	if jobs := Jobs(); len(jobs) != 1 || jobs[0] != job1 {
+		t.Errorf("%v are left after ReportDoneJobs", jobs)
+	}
+
+	// the process which has already finished is not an error for Kill.
+	xcmd := exec.Command(os.Args[0], "-test.run=NONE")
+	if err := xcmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	job1.addProcess(xcmd.Process)
+	if err := job1.Kill(); err != nil {
+		t.Errorf("Kill: %s", err)
+	}
+	if ctx1.Err() == nil {
+		t.Error("the context of the job is not canceled by Kill")
+	}
+	if jobs := Jobs(); len(jobs) > 0 {
+		t.Errorf("%v are left after Kill", jobs)
+	}
+}
@@ -2,12 +2,29 @@ package shell
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"strings"
 )
 
+// ErrBreak is the error returned by `break` to stop the loop command.
+var ErrBreak = errors.New("break: not in a loop")
+
+// ErrContinue is the error returned by `continue` to go to the next turn of the loop command.
+var ErrContinue = errors.New("continue: not in a loop")
+
+// ErrReturn is the error returned by `return` to leave the function.
+var ErrReturn = errors.New("return: not in a function")
+
+// IsControlFlow returns true when err is ErrBreak, ErrContinue or ErrReturn,
+// which stop Loop and go up to the caller.
+func IsControlFlow(err error) bool {
+	return err == ErrBreak || err == ErrContinue || err == ErrReturn
+}
+
 // Stream is the inteface which can read command-line
 type Stream interface {
 	ReadLine(context.Context) (context.Context, string, error)
@@ -32,6 +49,15 @@ func (ses *session) pop() (string, bool) {
 	return line, true
 }
 
+// readLine reads one line: the statements left by ReadCommand first
+// and the next line of `stream` after them.
+func (sh *Shell) readLine(ctx context.Context, stream Stream) (context.Context, string, error) {
+	if line, ok := sh.pop(); ok {
+		return ctx, line, nil
+	}
+	return stream.ReadLine(ctx)
+}
+
 // ReadCommand reads completed one command from `stream`.
 func (sh *Shell) ReadCommand(ctx context.Context, stream Stream) (context.Context, string, error) {
 	var line string
@@ -44,24 +70,82 @@ func (sh *Shell) ReadCommand(ctx context.Context, stream Stream) (context.Contex
 			return ctx, line, err
 		}
 
-		texts := splitToStatement(line)
+		texts := SplitToStatement(line)
 		line = texts[0]
 		sh.push(texts[1:])
 	}
 	return ctx, line, nil
 }
 
+// hereDocumentTerminator returns the terminator of the here-document
+// and whether it was quoted.
+func hereDocumentTerminator(word string) (string, bool) {
+	quoted := strings.ContainsAny(word, `'"`)
+	return strings.NewReplacer(`'`, "", `"`, "").Replace(word), quoted
+}
+
+// readHereDocument reads the lines of the here-document from the stream
+// until its terminator.
+func (sh *Shell) readHereDocument(ctx context.Context, stream Stream, r *RedirectNode) error {
+	terminator, _ := hereDocumentTerminator(r.Target.Text)
+	var buffer strings.Builder
+	for {
+		_, line, err := sh.readLine(ctx, stream)
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("here-document: `%s' not found", terminator)
+			}
+			return err
+		}
+		if r.StripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == terminator {
+			break
+		}
+		buffer.WriteString(line)
+		buffer.WriteRune('\n')
+	}
+	r.HereBody = buffer.String()
+	return nil
+}
+
+// readHereDocuments reads the all here-documents in node in order.
+// stream is nil when node is not the command-line read from the stream
+// by Loop (aliases, `$(...)` and so on), which can not have them.
+func (sh *Shell) readHereDocuments(ctx context.Context, node Node, stream Stream) error {
+	var err error
+	Walk(node, func(n Node) bool {
+		if r, ok := n.(*RedirectNode); ok && r.HereDoc && err == nil {
+			if stream == nil {
+				err = errors.New("here-document: not found stream")
+				return false
+			}
+			savePrompt, ok := os.LookupEnv("PROMPT")
+			os.Setenv("PROMPT", "heredoc>")
+			err = sh.readHereDocument(ctx, stream, r)
+			if ok {
+				os.Setenv("PROMPT", savePrompt)
+			} else {
+				os.Unsetenv("PROMPT")
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
 type streamIDT struct{}
 
 // StreamID is the key-object to find the last stream in the context object.
 var StreamID streamIDT
 
 // Loop executes commands from `stream` until any errors are found.
+// At the end of `stream`, it returns the errorlevel of the last command and io.EOF.
 func (sh *Shell) Loop(ctx0 context.Context, stream Stream) (int, error) {
+	errorlevel := 0
 	sigint := make(chan os.Signal, 1)
 	defer close(sigint)
-	quit := make(chan struct{}, 1)
-	defer close(quit)
 
 	for {
 		ctx, cancel := context.WithCancel(ctx0)
@@ -71,31 +155,34 @@ func (sh *Shell) Loop(ctx0 context.Context, stream Stream) (int, error) {
 		if err != nil {
 			cancel()
 			if err == io.EOF {
-				return 0, err
+				return errorlevel, err
 			}
 			return 1, err
 		}
 		signal.Notify(sigint, os.Interrupt)
 
+		// quit is made for each line not to cancel the context of the next line.
+		quit := make(chan struct{})
 		go func(sigint_ chan os.Signal, quit_ chan struct{}, cancel_ func()) {
 			for {
 				select {
 				case <-sigint_:
 					cancel_()
-					<-quit
+					<-quit_
 					return
-				case <-quit:
+				case <-quit_:
 					cancel_()
 					return
 				}
 			}
 		}(sigint, quit, cancel)
-		rc, err := sh.Interpret(ctx, line)
+		rc, err := sh.interpret(ctx, line, stream)
 		signal.Stop(sigint)
-		quit <- struct{}{}
+		close(quit)
+		errorlevel = rc
 
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || IsControlFlow(err) {
 				return rc, err
 			}
 			if err1, ok := err.(AlreadyReportedError); ok {
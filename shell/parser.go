@@ -14,13 +14,6 @@ import (
 	"github.com/zetamatta/nyagos/texts"
 )
 
-type StatementT struct {
-	Args     []string
-	RawArgs  []string
-	Redirect []*_Redirecter
-	Term     string
-}
-
 var prefix []string = []string{" 0<", " 1>", " 2>"}
 
 var PercentFunc = map[string]func() string{
@@ -35,6 +28,19 @@ var PercentFunc = map[string]func() string{
 	"ERRORLEVEL": func() string {
 		return fmt.Sprintf("%d", LastErrorLevel)
 	},
+	"?": func() string {
+		return fmt.Sprintf("%d", LastErrorLevel)
+	},
+	"PIPESTATUS": func() string {
+		var buffer strings.Builder
+		for i, rc := range PipeStatus {
+			if i > 0 {
+				buffer.WriteRune(' ')
+			}
+			fmt.Fprintf(&buffer, "%d", rc)
+		}
+		return buffer.String()
+	},
 }
 
 var rxUnicode = regexp.MustCompile("^[uU]\\+?([0-9a-fA-F]+)$")
@@ -85,12 +91,125 @@ const NOTQUOTED = '\000'
 
 const EMPTY_COMMAND_FOUND = "Empty command found"
 
+const SYNTAX_INCORRECT = "The syntax of the command is incorrect."
+
+const UNTERMINATED_SUBSTITUTION = "Unterminated command substitution"
+
 var TildeExpansion = true
 
-func string2word(source_ string, removeQuote bool) string {
+// substituteFunc executes the command-line enclosed with `$(...)` or
+// backquotes and returns what it wrote on the standard output.
+type substituteFunc func(cmdline string) (string, error)
+
+// processSubstituteFunc starts the command-line of `<(...)` or `>(...)`
+// and returns the filename to be passed to the command instead.
+type processSubstituteFunc func(cmdline string, isOutput bool) (string, error)
+
+// startProcessSubstitution returns true when ch and the next character
+// on reader begin `<(` or `>(`. Then reader is positioned after `(`.
+func startProcessSubstitution(ch rune, reader *strings.Reader) bool {
+	if ch != '<' && ch != '>' {
+		return false
+	}
+	next, _, err := reader.ReadRune()
+	if err != nil {
+		return false
+	}
+	if next == '(' {
+		return true
+	}
+	reader.UnreadRune()
+	return false
+}
+
+// readSubstitution reads the command-line of `$(...)` or `...` from reader
+// which is positioned just after the opening mark.
+// It returns the command-line without the closing mark.
+func readSubstitution(reader *strings.Reader, closer rune) (string, error) {
 	var buffer strings.Builder
+	quoteNow := NOTQUOTED
+	yenCount := 0
+	nest := 0
+	for {
+		ch, _, err := reader.ReadRune()
+		if err != nil {
+			return "", errors.New(UNTERMINATED_SUBSTITUTION)
+		}
+		if quoteNow != NOTQUOTED {
+			if ch == quoteNow && yenCount%2 == 0 {
+				quoteNow = NOTQUOTED
+			}
+		} else if (ch == '"' || ch == '\'') && yenCount%2 == 0 {
+			quoteNow = ch
+		} else if closer == ')' && ch == '(' {
+			nest++
+		} else if ch == closer {
+			if nest <= 0 {
+				return buffer.String(), nil
+			}
+			nest--
+		}
+		if ch == '\\' {
+			yenCount++
+		} else {
+			yenCount = 0
+		}
+		buffer.WriteRune(ch)
+	}
+}
+
+// startSubstitution returns the closing mark when ch (and the next character
+// on reader) begins a command substitution. Otherwise it returns NOTQUOTED.
+func startSubstitution(ch rune, reader *strings.Reader) rune {
+	if ch == '`' {
+		return '`'
+	}
+	if ch != '$' {
+		return NOTQUOTED
+	}
+	next, _, err := reader.ReadRune()
+	if err != nil {
+		return NOTQUOTED
+	}
+	if next == '(' {
+		return ')'
+	}
+	reader.UnreadRune()
+	return NOTQUOTED
+}
+
+// string2words expands one field of the command-line into words.
+// rawArgs keep the quotation marks and args do not.
+// The output of command substitutions not enclosed with double quotations
+// is split with spaces, so one field may become more than one word.
+// When subst or procSubst is nil, command substitutions or process
+// substitutions are left as they are.
+func string2words(source_ string, subst substituteFunc, procSubst processSubstituteFunc) (rawArgs []string, args []string, err error) {
+	var raw strings.Builder
+	var buffer strings.Builder
+	pending := false
 	source := strings.NewReader(source_)
 
+	writeRune := func(ch rune) {
+		raw.WriteRune(ch)
+		buffer.WriteRune(ch)
+		pending = true
+	}
+	writeString := func(s string) {
+		raw.WriteString(s)
+		buffer.WriteString(s)
+		pending = true
+	}
+	termWord := func() {
+		if pending {
+			rawArgs = append(rawArgs, raw.String())
+			args = append(args, buffer.String())
+		}
+		raw.Reset()
+		buffer.Reset()
+		pending = false
+	}
+
 	lastchar := ' '
 	quoteNow := NOTQUOTED
 	yenCount := 0
@@ -101,30 +220,30 @@ func string2word(source_ string, removeQuote bool) string {
 		}
 		if TildeExpansion && ch == '~' && unicode.IsSpace(lastchar) && quoteNow == NOTQUOTED {
 			if home := dos.GetHome(); home != "" {
-				buffer.WriteString(home)
+				writeString(home)
 			} else {
-				buffer.WriteRune('~')
+				writeRune('~')
 			}
 			lastchar = '~'
 			continue
 		}
 		if ch == '%' && quoteNow != '\'' {
 			for ; yenCount > 0; yenCount-- {
-				buffer.WriteRune('\\')
+				writeRune('\\')
 			}
 			var nameBuf strings.Builder
 			for {
 				ch, _, err = source.ReadRune()
 				if err != nil {
-					buffer.WriteRune('%')
+					writeRune('%')
 					source.Seek(-int64(nameBuf.Len()), io.SeekCurrent)
 					break
 				}
 				if ch == '%' {
 					if value, ok := ourGetenvSub(nameBuf.String()); ok {
-						buffer.WriteString(value)
+						writeString(value)
 					} else {
-						buffer.WriteRune('%')
+						writeRune('%')
 						source.Seek(-int64(nameBuf.Len()+1), io.SeekCurrent)
 					}
 					break
@@ -133,104 +252,278 @@ func string2word(source_ string, removeQuote bool) string {
 			}
 			continue
 		}
+		if quoteNow == NOTQUOTED && startProcessSubstitution(ch, source) {
+			for ; yenCount > 0; yenCount-- {
+				writeRune('\\')
+			}
+			cmdline, err := readSubstitution(source, ')')
+			if err != nil {
+				return nil, nil, err
+			}
+			if procSubst == nil {
+				writeString(string(ch) + "(" + cmdline + ")")
+			} else {
+				path, err := procSubst(cmdline, ch == '>')
+				if err != nil {
+					return nil, nil, err
+				}
+				writeString(path)
+			}
+			lastchar = ')'
+			continue
+		}
+		if quoteNow != '\'' {
+			if closer := startSubstitution(ch, source); closer != NOTQUOTED {
+				for ; yenCount > 0; yenCount-- {
+					writeRune('\\')
+				}
+				cmdline, err := readSubstitution(source, closer)
+				if err != nil {
+					return nil, nil, err
+				}
+				if subst == nil {
+					if closer == ')' {
+						writeString("$(" + cmdline + ")")
+					} else {
+						writeString("`" + cmdline + "`")
+					}
+				} else {
+					output, err := subst(cmdline)
+					if err != nil {
+						return nil, nil, err
+					}
+					if quoteNow != NOTQUOTED {
+						writeString(output)
+					} else {
+						// split the output into words.
+						for i, field := range strings.Fields(output) {
+							if i > 0 || unicode.IsSpace(rune(output[0])) {
+								termWord()
+							}
+							writeString(field)
+						}
+						if len(output) > 0 && unicode.IsSpace(rune(output[len(output)-1])) {
+							termWord()
+						}
+					}
+				}
+				lastchar = closer
+				continue
+			}
+		}
 
 		if quoteNow != NOTQUOTED && ch == quoteNow && yenCount%2 == 0 {
-			if !removeQuote {
-				buffer.WriteRune(ch)
-			}
+			raw.WriteRune(ch)
+			pending = true
 			// Close Quotation.
 			for ; yenCount >= 2; yenCount -= 2 {
-				buffer.WriteRune('\\')
+				writeRune('\\')
 			}
 			quoteNow = NOTQUOTED
 		} else if (ch == '\'' || ch == '"') && quoteNow == NOTQUOTED && yenCount%2 == 0 {
-			if !removeQuote {
-				buffer.WriteRune(ch)
-			}
+			raw.WriteRune(ch)
+			pending = true
 			// Open Qutation.
 			for ; yenCount >= 2; yenCount -= 2 {
-				buffer.WriteRune('\\')
+				writeRune('\\')
 			}
 			quoteNow = ch
 			if ch == lastchar {
-				buffer.WriteRune(ch)
+				writeRune(ch)
 			}
 		} else {
 			if ch == '\\' {
 				yenCount++
 			} else if ch == '\'' || ch == '"' {
 				for ; yenCount >= 2; yenCount -= 2 {
-					buffer.WriteRune('\\')
+					writeRune('\\')
 				}
 				yenCount = 0
-				buffer.WriteRune(ch)
+				writeRune(ch)
 			} else {
 				for ; yenCount > 0; yenCount-- {
-					buffer.WriteRune('\\')
+					writeRune('\\')
 				}
-				buffer.WriteRune(ch)
+				writeRune(ch)
 			}
 		}
 		lastchar = ch
 	}
 	for ; yenCount > 0; yenCount-- {
-		buffer.WriteRune('\\')
+		writeRune('\\')
+	}
+	termWord()
+	return rawArgs, args, nil
+}
+
+// expandPercent expands only `%VAR%` in text for here-documents.
+func expandPercent(text string) string {
+	var buffer strings.Builder
+	for {
+		start := strings.IndexRune(text, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexRune(text[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		if value, ok := ourGetenvSub(text[start+1 : end]); ok {
+			buffer.WriteString(text[:start])
+			buffer.WriteString(value)
+			text = text[end+1:]
+		} else {
+			buffer.WriteString(text[:end])
+			text = text[end:]
+		}
 	}
+	buffer.WriteString(text)
 	return buffer.String()
 }
 
-func parse1(text string) ([]*StatementT, error) {
+// string2path expands a field as the filename for redirection.
+func string2path(source string, subst substituteFunc, procSubst processSubstituteFunc) (string, error) {
+	_, args, err := string2words(source, subst, procSubst)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(args, " "), nil
+}
+
+const (
+	tkWord = iota
+	tkOperator
+	tkRedirect
+)
+
+type token struct {
+	kind     int
+	text     string
+	pos      int
+	redirect *RedirectNode
+}
+
+// redirectFileNo returns the file-number written before `>` or `<`
+// and removes it from buffer: `3>` or `12<`.
+// For the compatibility, the last `1` or `2` of the word is also
+// the file-number: `echo a2>err`.
+func redirectFileNo(buffer *strings.Builder, bufferPos int, lastchar rune, defaultNo int, pos int) (int, int) {
+	word := buffer.String()
+	if word != "" && strings.Trim(word, "0123456789") == "" {
+		if n, err := strconv.Atoi(word); err == nil {
+			buffer.Reset()
+			return n, bufferPos
+		}
+	}
+	if defaultNo == 1 && (lastchar == '1' || lastchar == '2') {
+		chomp(buffer)
+		return int(lastchar - '0'), pos - 1
+	}
+	return defaultNo, pos
+}
+
+// readDupFrom reads the file-number after `>&` or `<&`.
+// `-` means to close the file.
+func readDupFrom(reader *strings.Reader, r *RedirectNode) error {
+	ch, _, err := reader.ReadRune()
+	if err != nil {
+		return errors.New("Too Near EOF for >&")
+	}
+	if ch == '-' {
+		r.Close = true
+		return nil
+	}
+	n := 0
+	digits := 0
+	for ; err == nil && ch >= '0' && ch <= '9'; ch, _, err = reader.ReadRune() {
+		n = n*10 + int(ch-'0')
+		digits++
+	}
+	if err == nil {
+		reader.UnreadRune()
+	}
+	if digits <= 0 {
+		return errors.New("Syntax error after >&")
+	}
+	r.DupFrom = n
+	return nil
+}
+
+// tokenize splits text into words, operators and redirections.
+// The quotations, variables and command substitutions in words
+// are left as they are.
+func tokenize(text string) ([]*token, error) {
+	tokens := make([]*token, 0)
 	quoteNow := NOTQUOTED
 	yenCount := 0
-	statements := make([]*StatementT, 0)
-	args := make([]string, 0)
-	rawArgs := make([]string, 0)
 	lastchar := ' '
 	var buffer strings.Builder
-	isNextRedirect := false
-	redirect := make([]*_Redirecter, 0, 3)
-
-	term_line := func(term string) {
-		statement1 := new(StatementT)
-		if buffer.Len() > 0 {
-			if isNextRedirect && len(redirect) > 0 {
-				redirect[len(redirect)-1].SetPath(string2word(buffer.String(), true))
-				isNextRedirect = false
-				statement1.RawArgs = rawArgs
-				statement1.Args = args
-			} else {
-				statement1.RawArgs = append(rawArgs, string2word(buffer.String(), false))
-				statement1.Args = append(args, string2word(buffer.String(), true))
-			}
-			buffer.Reset()
-		} else if len(args) <= 0 {
-			return
-		} else {
-			statement1.RawArgs = rawArgs
-			statement1.Args = args
+	bufferPos := 0
+	var nextRedirect *RedirectNode
+	commandStart := true
+	parenDepth := 0
+	literalParens := 0
+	braceDepth := 0
+
+	reader := strings.NewReader(text)
+	offset := func() int {
+		return len(text) - reader.Len()
+	}
+	writeRune := func(ch rune, pos int) {
+		if buffer.Len() <= 0 {
+			bufferPos = pos
 		}
-		statement1.Redirect = redirect
-		redirect = make([]*_Redirecter, 0, 3)
-		rawArgs = make([]string, 0)
-		args = make([]string, 0)
-		statement1.Term = term
-		statements = append(statements, statement1)
+		buffer.WriteRune(ch)
 	}
-
-	term_word := func() {
-		if isNextRedirect && len(redirect) > 0 {
-			redirect[len(redirect)-1].SetPath(string2word(buffer.String(), true))
-		} else {
-			if buffer.Len() > 0 {
-				rawArgs = append(rawArgs, string2word(buffer.String(), false))
-				args = append(args, string2word(buffer.String(), true))
-			}
+	operator := func(op string, pos int) {
+		tokens = append(tokens, &token{kind: tkOperator, text: op, pos: pos})
+		commandStart = (op != ")" && op != "}")
+	}
+	lastOperator := func() *token {
+		if len(tokens) <= 0 {
+			return nil
+		}
+		if last := tokens[len(tokens)-1]; last.kind == tkOperator {
+			return last
 		}
+		return nil
+	}
+	termWord := func() {
+		if buffer.Len() <= 0 {
+			return
+		}
+		word := buffer.String()
 		buffer.Reset()
+		literalParens = 0
+		if nextRedirect != nil {
+			nextRedirect.Target = &WordNode{Position: bufferPos, Text: word}
+			nextRedirect = nil
+			return
+		}
+		if commandStart && word == "{" {
+			braceDepth++
+			operator("{", bufferPos)
+			return
+		}
+		if commandStart && word == "}" && braceDepth > 0 {
+			braceDepth--
+			operator("}", bufferPos)
+			return
+		}
+		tokens = append(tokens, &token{kind: tkWord, text: word, pos: bufferPos})
+		commandStart = false
+	}
+	newRedirect := func(fileno int, pos int) *RedirectNode {
+		nextRedirect = &RedirectNode{Position: pos, FileNo: fileno, DupFrom: -1}
+		tokens = append(tokens, &token{kind: tkRedirect, pos: pos, redirect: nextRedirect})
+		commandStart = false
+		return nextRedirect
 	}
+	var lastRedirect *RedirectNode
 
-	reader := strings.NewReader(text)
 	for reader.Len() > 0 {
+		pos := offset()
 		ch, chSize, chErr := reader.ReadRune()
 		if chSize <= 0 {
 			break
@@ -238,6 +531,24 @@ func parse1(text string) ([]*StatementT, error) {
 		if chErr != nil {
 			return nil, chErr
 		}
+		if quoteNow != '\'' {
+			if closer := startSubstitution(ch, reader); closer != NOTQUOTED {
+				cmdline, err := readSubstitution(reader, closer)
+				if err != nil {
+					return nil, err
+				}
+				if closer == ')' {
+					writeRune('$', pos)
+					buffer.WriteString("(" + cmdline + ")")
+				} else {
+					writeRune('`', pos)
+					buffer.WriteString(cmdline + "`")
+				}
+				lastchar = closer
+				yenCount = 0
+				continue
+			}
+		}
 		if quoteNow == NOTQUOTED {
 			if yenCount%2 == 0 && (ch == '"' || ch == '\'') {
 				quoteNow = ch
@@ -246,93 +557,116 @@ func parse1(text string) ([]*StatementT, error) {
 			quoteNow = NOTQUOTED
 		}
 		if quoteNow != NOTQUOTED {
-			buffer.WriteRune(ch)
+			writeRune(ch, pos)
 		} else if unicode.IsSpace(ch) {
-			if buffer.Len() > 0 {
-				term_word()
-				isNextRedirect = false
-			}
+			termWord()
 		} else if unicode.IsSpace(lastchar) && ch == '#' {
 			break
-		} else if unicode.IsSpace(lastchar) && ch == ';' {
-			term_line(";")
-		} else if ch == '!' && lastchar == '>' && isNextRedirect && len(redirect) > 0 {
-			redirect[len(redirect)-1].force = true
+		} else if (unicode.IsSpace(lastchar) || braceDepth > 0 || parenDepth > 0) && ch == ';' {
+			// `;` after a word is a part of it like `PATH=a;b` except in the groups.
+			termWord()
+			operator(";", pos)
+		} else if ch == '(' && buffer.Len() <= 0 && commandStart && nextRedirect == nil {
+			parenDepth++
+			operator("(", pos)
+		} else if ch == '(' {
+			literalParens++
+			writeRune(ch, pos)
+		} else if ch == ')' && literalParens <= 0 && parenDepth > 0 {
+			termWord()
+			parenDepth--
+			operator(")", pos)
+		} else if ch == ')' {
+			if literalParens > 0 {
+				literalParens--
+			}
+			writeRune(ch, pos)
+		} else if ch == '!' && lastchar == '>' && nextRedirect != nil {
+			nextRedirect.Force = true
 		} else if ch == '|' {
-			if lastchar == '>' && isNextRedirect && len(redirect) > 0 {
-				redirect[len(redirect)-1].force = true
-			} else if lastchar == '|' {
-				if len(statements) <= 0 {
-					return nil, errors.New(EMPTY_COMMAND_FOUND)
-				}
-				statements[len(statements)-1].Term = "||"
+			if lastchar == '>' && nextRedirect != nil {
+				nextRedirect.Force = true
+			} else if op := lastOperator(); lastchar == '|' && op != nil && op.text == "|" {
+				op.text = "||"
 			} else {
-				term_line("|")
+				termWord()
+				operator("|", pos)
 			}
 		} else if ch == '&' {
-			switch lastchar {
-			case '&':
-				if len(statements) <= 0 {
-					return nil, errors.New(EMPTY_COMMAND_FOUND)
-				}
-				statements[len(statements)-1].Term = "&&"
-			case '|':
-				if len(statements) <= 0 {
-					return nil, errors.New(EMPTY_COMMAND_FOUND)
+			if op := lastOperator(); lastchar == '&' && op != nil && op.text == "&" {
+				op.text = "&&"
+			} else if lastchar == '|' && op != nil && op.text == "|" {
+				op.text = "|&"
+			} else if (lastchar == '>' || lastchar == '<') && nextRedirect != nil {
+				// >&N , <&N or >&-
+				if err := readDupFrom(reader, nextRedirect); err != nil {
+					return nil, err
 				}
-				statements[len(statements)-1].Term = "|&"
-			case '>':
-				// >&[n]
-				ch2, ch2siz, ch2err := reader.ReadRune()
-				if ch2err != nil {
-					return nil, ch2err
-				}
-				if ch2siz <= 0 {
-					return nil, errors.New("Too Near EOF for >&")
-				}
-				red := redirect[len(redirect)-1]
-				switch ch2 {
-				case '1':
-					red.DupFrom(1)
-				case '2':
-					red.DupFrom(2)
-				default:
-					return nil, errors.New("Syntax error after >&")
+				nextRedirect = nil
+				lastchar = '&'
+				yenCount = 0
+				continue
+			} else if next, _, err := reader.ReadRune(); err == nil && next == '>' {
+				// &>
+				termWord()
+				lastRedirect = newRedirect(1, pos)
+				lastRedirect.Both = true
+				lastchar = '>'
+				yenCount = 0
+				continue
+			} else {
+				if err == nil {
+					reader.UnreadRune()
 				}
-				isNextRedirect = false
-			default:
-				term_line("&")
+				termWord()
+				operator("&", pos)
+			}
+		} else if startProcessSubstitution(ch, reader) {
+			// <(...) or >(...)
+			cmdline, err := readSubstitution(reader, ')')
+			if err != nil {
+				return nil, err
 			}
+			writeRune(ch, pos)
+			buffer.WriteString("(" + cmdline + ")")
+			lastchar = ')'
+			yenCount = 0
+			continue
 		} else if ch == '>' {
-			switch lastchar {
-			case '1':
-				// 1>
-				chomp(&buffer)
-				term_word()
-				redirect = append(redirect, newRedirecter(1))
-			case '2':
-				// 2>
-				chomp(&buffer)
-				term_word()
-				redirect = append(redirect, newRedirecter(2))
-			case '>':
+			if lastchar == '>' && nextRedirect != nil && !nextRedirect.IsInput {
 				// >>
-				term_word()
-				if len(redirect) >= 0 {
-					redirect[len(redirect)-1].SetAppend()
-				}
-			default:
-				// >
-				term_word()
-				redirect = append(redirect, newRedirecter(1))
+				nextRedirect.IsAppend = true
+			} else if lastchar == '<' && nextRedirect != nil && nextRedirect.IsInput && !nextRedirect.HereDoc && !nextRedirect.HereString {
+				// <>
+				nextRedirect.ReadWrite = true
+			} else {
+				// N>
+				fileno, fdPos := redirectFileNo(&buffer, bufferPos, lastchar, 1, pos)
+				termWord()
+				lastRedirect = newRedirect(fileno, fdPos)
 			}
-			isNextRedirect = true
 		} else if ch == '<' {
-			term_word()
-			redirect = append(redirect, newRedirecter(0))
-			isNextRedirect = true
+			if lastchar == '<' && nextRedirect != nil && nextRedirect.IsInput && !nextRedirect.HereString && !nextRedirect.ReadWrite {
+				if nextRedirect.HereDoc {
+					// <<<
+					nextRedirect.HereDoc = false
+					nextRedirect.HereString = true
+				} else {
+					// <<
+					nextRedirect.HereDoc = true
+				}
+			} else {
+				// N<
+				fileno, fdPos := redirectFileNo(&buffer, bufferPos, lastchar, 0, pos)
+				termWord()
+				lastRedirect = newRedirect(fileno, fdPos)
+				lastRedirect.IsInput = true
+			}
+		} else if ch == '-' && lastchar == '<' && nextRedirect != nil && nextRedirect.HereDoc {
+			// <<-
+			nextRedirect.StripTabs = true
 		} else {
-			buffer.WriteRune(ch)
+			writeRune(ch, pos)
 		}
 		if ch == '\\' {
 			yenCount++
@@ -341,33 +675,318 @@ func parse1(text string) ([]*StatementT, error) {
 		}
 		lastchar = ch
 	}
-	term_line(" ")
-	return statements, nil
+	termWord()
+	return tokens, nil
 }
 
-// Make arrays whose elements are pipelines
-func parse2(statements []*StatementT) [][]*StatementT {
-	result := make([][]*StatementT, 1)
-	for _, statement1 := range statements {
-		result[len(result)-1] = append(result[len(result)-1], statement1)
-		switch statement1.Term {
-		case "|", "|&":
+type treeParser struct {
+	tokens []*token
+	index  int
+}
 
-		default:
-			result = append(result, make([]*StatementT, 0))
+func (p *treeParser) peek() *token {
+	if p.index < len(p.tokens) {
+		return p.tokens[p.index]
+	}
+	return nil
+}
+
+func (p *treeParser) peekOperator(ops ...string) string {
+	tk := p.peek()
+	if tk == nil || tk.kind != tkOperator {
+		return ""
+	}
+	for _, op := range ops {
+		if tk.text == op {
+			return op
 		}
 	}
-	if len(result[len(result)-1]) <= 0 {
-		result = result[0 : len(result)-1]
+	return ""
+}
+
+// sequence := andor { (";"|"&") andor }
+func (p *treeParser) sequence() (Node, error) {
+	items := make([]Node, 0)
+	for {
+		node, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		switch p.peekOperator(";", "&") {
+		case ";":
+			p.index++
+			if node != nil {
+				items = append(items, node)
+			}
+			continue
+		case "&":
+			p.index++
+			if node != nil {
+				items = append(items, &AsyncNode{Position: node.Pos(), Body: node})
+			}
+			continue
+		}
+		if node != nil {
+			items = append(items, node)
+		}
+		break
 	}
-	return result
+	if len(items) <= 0 {
+		return nil, nil
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return &SequenceNode{Position: items[0].Pos(), Items: items}, nil
 }
 
+// andor := pipeline { ("&&"|"||") pipeline }
+func (p *treeParser) andOr() (Node, error) {
+	left, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOperator("&&", "||")
+		if op == "" {
+			return left, nil
+		}
+		if left == nil {
+			return nil, errors.New(EMPTY_COMMAND_FOUND)
+		}
+		p.index++
+		right, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			return nil, errors.New(SYNTAX_INCORRECT)
+		}
+		left = &AndOrNode{Position: left.Pos(), Op: op, Left: left, Right: right}
+	}
+}
+
+// pipeline := command { ("|"|"|&") command }
+func (p *treeParser) pipeline() (Node, error) {
+	first, err := p.command()
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		if p.peekOperator("|", "|&") != "" {
+			return nil, errors.New(EMPTY_COMMAND_FOUND)
+		}
+		return nil, nil
+	}
+	commands := []Node{first}
+	pipes := make([]string, 0)
+	for {
+		op := p.peekOperator("|", "|&")
+		if op == "" {
+			break
+		}
+		p.index++
+		next, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, errors.New(SYNTAX_INCORRECT)
+		}
+		commands = append(commands, next)
+		pipes = append(pipes, op)
+	}
+	if len(commands) == 1 {
+		return first, nil
+	}
+	return &PipelineNode{Position: first.Pos(), Commands: commands, Pipes: pipes}, nil
+}
+
+func (p *treeParser) redirects() ([]*RedirectNode, error) {
+	result := make([]*RedirectNode, 0)
+	for {
+		tk := p.peek()
+		if tk == nil || tk.kind != tkRedirect {
+			return result, nil
+		}
+		if tk.redirect.DupFrom < 0 && !tk.redirect.Close && tk.redirect.Target == nil {
+			return nil, errors.New(SYNTAX_INCORRECT)
+		}
+		result = append(result, tk.redirect)
+		p.index++
+	}
+}
+
+// command := "(" sequence ")" redirects | "{" sequence "}" redirects | simple-command
+func (p *treeParser) command() (Node, error) {
+	if open := p.peekOperator("(", "{"); open != "" {
+		pos := p.peek().pos
+		p.index++
+		body, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		closer := ")"
+		if open == "{" {
+			closer = "}"
+		}
+		if p.peekOperator(closer) == "" {
+			return nil, fmt.Errorf("Missing '%s'", closer)
+		}
+		p.index++
+		if body == nil {
+			return nil, errors.New(EMPTY_COMMAND_FOUND)
+		}
+		redirects, err := p.redirects()
+		if err != nil {
+			return nil, err
+		}
+		if open == "(" {
+			return &SubshellNode{Position: pos, Body: body, Redirects: redirects}, nil
+		}
+		return &GroupNode{Position: pos, Body: body, Redirects: redirects}, nil
+	}
+	cmd := &CommandNode{
+		Words:     make([]*WordNode, 0),
+		Redirects: make([]*RedirectNode, 0),
+	}
+	for {
+		tk := p.peek()
+		if tk == nil || tk.kind == tkOperator {
+			break
+		}
+		if tk.kind == tkWord {
+			cmd.Words = append(cmd.Words, &WordNode{Position: tk.pos, Text: tk.text})
+			p.index++
+		} else {
+			redirects, err := p.redirects()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Redirects = append(cmd.Redirects, redirects...)
+		}
+	}
+	if len(cmd.Words) <= 0 && len(cmd.Redirects) <= 0 {
+		return nil, nil
+	}
+	if len(cmd.Words) > 0 {
+		cmd.Position = cmd.Words[0].Position
+	} else {
+		cmd.Position = cmd.Redirects[0].Position
+	}
+	return cmd, nil
+}
+
+// ParseTree parses text and returns its syntax tree.
+// It returns nil when text has no commands.
+// Quotations, variables and command substitutions are not expanded yet.
+func ParseTree(text string) (Node, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &treeParser{tokens: tokens}
+	node, err := p.sequence()
+	if err != nil {
+		return nil, err
+	}
+	if tk := p.peek(); tk != nil {
+		return nil, fmt.Errorf("Unexpected '%s'", tk.text)
+	}
+	return node, nil
+}
+
+// StatementT is a simple command of the result of Parse.
+type StatementT struct {
+	Args     []string
+	RawArgs  []string
+	Redirect []*_Redirecter
+	Term     string // the operator after the command such as ";", "|" and "&&"
+}
+
+// Parse parses text into the pipelines of the simple commands.
+// It is kept for the compatibility. Use ParseTree to get the syntax tree.
+// The subshells `( )` and the groups `{ }` are not supported.
 func Parse(text string) ([][]*StatementT, error) {
-	result1, err := parse1(text)
+	node, err := ParseTree(text)
 	if err != nil {
 		return nil, err
 	}
-	result2 := parse2(result1)
-	return result2, nil
+	result := [][]*StatementT{}
+	pipeline := []*StatementT{}
+	var flatten func(node Node, term string) error
+	flatten = func(node Node, term string) error {
+		switch n := node.(type) {
+		case *SequenceNode:
+			for i, item := range n.Items {
+				term1 := ";"
+				if i == len(n.Items)-1 {
+					term1 = term
+				}
+				if err := flatten(item, term1); err != nil {
+					return err
+				}
+			}
+		case *AsyncNode:
+			return flatten(n.Body, "&")
+		case *AndOrNode:
+			if err := flatten(n.Left, n.Op); err != nil {
+				return err
+			}
+			return flatten(n.Right, term)
+		case *PipelineNode:
+			for i, cmd := range n.Commands {
+				term1 := term
+				if i < len(n.Pipes) {
+					term1 = n.Pipes[i]
+				}
+				if err := flatten(cmd, term1); err != nil {
+					return err
+				}
+			}
+		case *CommandNode:
+			rawArgs, args, err := n.expand(nil, nil)
+			if err != nil {
+				return err
+			}
+			statement1 := &StatementT{Args: args, RawArgs: rawArgs, Term: term}
+			for _, r := range n.Redirects {
+				red, err := redirecterOf(r, nil, nil)
+				if err != nil {
+					return err
+				}
+				statement1.Redirect = append(statement1.Redirect, red)
+			}
+			pipeline = append(pipeline, statement1)
+			if term != "|" && term != "|&" {
+				result = append(result, pipeline)
+				pipeline = []*StatementT{}
+			}
+		default:
+			return fmt.Errorf("Parse: `%s` is not supported. Use ParseTree", node.String())
+		}
+		return nil
+	}
+	if node != nil {
+		if err := flatten(node, " "); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// expand returns the words of the command whose quotations, variables
+// and command substitutions are expanded.
+func (n *CommandNode) expand(subst substituteFunc, procSubst processSubstituteFunc) (rawArgs []string, args []string, err error) {
+	rawArgs = make([]string, 0, len(n.Words))
+	args = make([]string, 0, len(n.Words))
+	for _, word := range n.Words {
+		rawArgs1, args1, err := string2words(word.Text, subst, procSubst)
+		if err != nil {
+			return nil, nil, err
+		}
+		rawArgs = append(rawArgs, rawArgs1...)
+		args = append(args, args1...)
+	}
+	return rawArgs, args, nil
 }
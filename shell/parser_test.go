@@ -2,6 +2,7 @@ package shell
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +31,179 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTreeText(t *testing.T) {
+	text := "gawk \"{ print(\"\"ahaha ihihi ufufu\"\") }\" <\"ddd\"\"ddd\"|ahaha \"ihihi |ufufu\" ; ohoho gegee&&hogehogeo >ihihi"
+	result, err := ParseTree(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fmt.Println(result.String())
+	result, _ = ParseTree("")
+	if result != nil {
+		t.Fatal("empty line is not nil")
+	}
+}
+
+func TestParse(t *testing.T) {
+	result, err := Parse(`a "b c" >out | d && e ; f &`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var buffer strings.Builder
+	for _, pipeline := range result {
+		buffer.WriteString("[")
+		for _, st := range pipeline {
+			fmt.Fprintf(&buffer, "%s(%d)%s", strings.Join(st.Args, ","), len(st.Redirect), st.Term)
+		}
+		buffer.WriteString("]")
+	}
+	if s := buffer.String(); s != "[a,b c(1)|d(0)&&][e(0);][f(0)&]" {
+		t.Fatalf("Parse: %s", s)
+	}
+	if _, err := Parse("(a) | b"); err == nil {
+		t.Fatal("Parse: subshell is not an error")
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	tests := []struct {
+		text   string
+		expect string
+	}{
+		{"a b ; c", "a b ; c"},
+		{"a|b|&c", "a | b |& c"},
+		{"a && b || c", "a && b || c"},
+		{"a & b", "a & b"},
+		{"a 2>&1 >>log 2>err", "a 2>&1 >>log 2>err"},
+		{"a >!out <in", "a >!out <in"},
+		{"(a ; b) > out", "( a ; b ) >out"},
+		{"(a | (b && c)) | d", "( a | ( b && c ) ) | d"},
+		{"{ a ; b ; } 2> err", "{ a ; b ; } 2>err"},
+		{"{ a; b; } >x", "{ a ; b ; } >x"},
+		{"(a; b)", "( a ; b )"},
+		{"set PATH=a;b", "set PATH=a;b"},
+		{"echo (a) {b}", "echo (a) {b}"},
+		{"echo $(a ; b) x", "echo $(a ; b) x"},
+		{"echo a # comment", "echo a"},
+		{"cat <<EOF | sort", "cat <<EOF | sort"},
+		{"cat <<-'EOF' >out", "cat <<-'EOF' >out"},
+		{"tr a-z A-Z <<<%FOO%", "tr a-z A-Z <<<%FOO%"},
+		{"a 3>fd3 4<fd4 5>&1 1>&3 3>&- 12>>log", "a 3>fd3 4<fd4 5>&1 >&3 3>&- 12>>log"},
+		{"a &>all <>rw 0<&4 x2>y", "a x &>all <>rw <&4 2>y"},
+		{"a && b &>>log & c", "a && b &>>log & c"},
+		{"diff <(sort a ; echo) >(tee b) | c", "diff <(sort a ; echo) >(tee b) | c"},
+	}
+	for _, test := range tests {
+		result, err := ParseTree(test.text)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err.Error())
+		}
+		if s := result.String(); s != test.expect {
+			t.Fatalf("%s: `%s` != `%s`", test.text, s, test.expect)
+		}
+	}
+
+	result, _ := ParseTree("a && (b | c) > out")
+	andor, ok := result.(*AndOrNode)
+	if !ok {
+		t.Fatalf("%T is not *AndOrNode", result)
+	}
+	subshell, ok := andor.Right.(*SubshellNode)
+	if !ok || subshell.Pos() != 5 || len(subshell.Redirects) != 1 {
+		t.Fatalf("%v: invalid subshell", andor.Right)
+	}
+	if _, ok := subshell.Body.(*PipelineNode); !ok {
+		t.Fatalf("%T is not *PipelineNode", subshell.Body)
+	}
+
+	for _, text := range []string{"a |", "&& a", "(a", "{ a ; b", "( )", "a >", "cat <<"} {
+		if _, err := ParseTree(text); err == nil {
+			t.Fatalf("%s: no error", text)
+		}
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	subst := func(cmdline string) (string, error) {
+		switch cmdline {
+		case "echo a b":
+			return "a b", nil
+		case "echo $(echo x)":
+			return "x", nil
+		case `echo ")"`:
+			return ")", nil
+		default:
+			return "[" + cmdline + "]", nil
+		}
+	}
+	tests := []struct {
+		text string
+		args []string
+	}{
+		{"foo $(echo a b) c", []string{"foo", "a", "b", "c"}},
+		{`foo "$(echo a b)" c`, []string{"foo", "a b", "c"}},
+		{"foo x$(echo a b)y", []string{"foo", "xa", "by"}},
+		{"foo `echo a b`", []string{"foo", "a", "b"}},
+		{"foo $(echo $(echo x))", []string{"foo", "x"}},
+		{`foo $(echo ")")`, []string{"foo", ")"}},
+		{"foo $(a | b ; c)", []string{"foo", "[a", "|", "b", ";", "c]"}},
+		{"foo '$(echo a b)'", []string{"foo", "$(echo a b)"}},
+	}
+	for _, test := range tests {
+		result, err := ParseTree(test.text)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err.Error())
+		}
+		cmd, ok := result.(*CommandNode)
+		if !ok {
+			t.Fatalf("%s: not one command", test.text)
+		}
+		rawArgs, args, err := cmd.expand(subst, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err.Error())
+		}
+		if len(args) != len(test.args) || len(rawArgs) != len(args) {
+			t.Fatalf("%s: %v != %v", test.text, args, test.args)
+		}
+		for i := range args {
+			if args[i] != test.args[i] {
+				t.Fatalf("%s: %v != %v", test.text, args, test.args)
+			}
+		}
+	}
+	if _, err := ParseTree("foo $(echo"); err == nil {
+		t.Fatal("unterminated command substitution is not an error")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	names := map[int]string{
+		HlCommand:  "cmd",
+		HlQuote:    "quote",
+		HlVariable: "var",
+		HlRedirect: "redir",
+		HlOperator: "op",
+		HlError:    "error",
+	}
+	tests := []struct {
+		text   string
+		expect string
+	}{
+		{`echo "a b" %PATH%`, `cmd:echo quote:"a b" var:%PATH%`},
+		{"a 2>&1 >out | b && c", "cmd:a redir:2>&1 redir:> op:| cmd:b op:&& cmd:c"},
+		{`echo "%HOME%\x" '%NO%'`, `cmd:echo quote:"%HOME%\x" var:%HOME% quote:'%NO%'`},
+		{`(a ; b) 2>"err log"`, `op:( cmd:a op:; cmd:b op:) redir:2> quote:"err log"`},
+		{`echo "abc`, `cmd:echo error:"abc`},
+		{`"c:\Program Files\x" y`, `quote:"c:\Program Files\x" cmd:"c:\Program Files\x"`},
+	}
+	for _, test := range tests {
+		var result []string
+		for _, span := range Highlight(test.text) {
+			result = append(result, names[span.Kind]+":"+test.text[span.Start:span.End])
+		}
+		if s := strings.Join(result, " "); s != test.expect {
+			t.Fatalf("%s: `%s` != `%s`", test.text, s, test.expect)
+		}
+	}
+}
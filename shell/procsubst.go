@@ -0,0 +1,111 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// processSubstitution is the temporary file for `<(cmd)` or `>(cmd)`.
+// `<(cmd)` writes the output of cmd into the file before the outer command starts.
+// `>(cmd)` gives the file written by the outer command to cmd as stdin after it finishes.
+type processSubstitution struct {
+	path     string
+	isOutput bool
+	cmdline  string
+	wg       sync.WaitGroup
+}
+
+func (sh *Shell) startProcessSubstitution(ctx context.Context, cmdline string, isOutput bool) (*processSubstitution, error) {
+	fd, err := ioutil.TempFile("", "nyagos-psub-")
+	if err != nil {
+		return nil, err
+	}
+	ps := &processSubstitution{
+		path:     fd.Name(),
+		isOutput: isOutput,
+		cmdline:  cmdline,
+	}
+	if isOutput {
+		fd.Close()
+		return ps, nil
+	}
+	ps.wg.Add(1)
+	err = sh.goBackground(ctx, func(ctx context.Context, bg *Shell) {
+		bg.Stdout = fd
+		bg.IsBackGround = true
+		_, err := bg.Interpret(ctx, cmdline)
+		reportError(bg.Stderr, err)
+		fd.Close()
+		ps.wg.Done()
+	})
+	if err != nil {
+		fd.Close()
+		os.Remove(ps.path)
+		return nil, err
+	}
+	return ps, nil
+}
+
+// finish runs the command of `>(cmd)` with the file written by the outer command.
+func (ps *processSubstitution) finish(ctx context.Context, sh *Shell) {
+	if !ps.isOutput {
+		return
+	}
+	fd, err := os.Open(ps.path)
+	if err != nil {
+		reportError(sh.Stderr, err)
+		return
+	}
+	ps.wg.Add(1)
+	err = sh.goBackground(ctx, func(ctx context.Context, bg *Shell) {
+		bg.Stdin = fd
+		bg.IsBackGround = true
+		_, err := bg.Interpret(ctx, ps.cmdline)
+		reportError(bg.Stderr, err)
+		fd.Close()
+		ps.wg.Done()
+	})
+	if err != nil {
+		fd.Close()
+		ps.wg.Done()
+		reportError(sh.Stderr, err)
+	}
+}
+
+type processSubstitutions []*processSubstitution
+
+// starter returns the function for string2words, which starts a process
+// substitution and returns the path of its temporary file.
+func (procs *processSubstitutions) starter(ctx context.Context, sh *Shell) processSubstituteFunc {
+	return func(cmdline string, isOutput bool) (string, error) {
+		ps, err := sh.startProcessSubstitution(ctx, cmdline, isOutput)
+		if err != nil {
+			return "", err
+		}
+		*procs = append(*procs, ps)
+		return ps.path, nil
+	}
+}
+
+// waitInputs waits until all the commands of `<(cmd)` finish writing.
+func (procs processSubstitutions) waitInputs() {
+	for _, ps := range procs {
+		if !ps.isOutput {
+			ps.wg.Wait()
+		}
+	}
+}
+
+// cleanup runs the commands of `>(cmd)`, waits all of them
+// and removes the temporary files.
+func (procs processSubstitutions) cleanup(ctx context.Context, sh *Shell) {
+	for _, ps := range procs {
+		ps.finish(ctx, sh)
+	}
+	for _, ps := range procs {
+		ps.wg.Wait()
+		os.Remove(ps.path)
+	}
+}
@@ -2,6 +2,8 @@ package shell
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
@@ -9,11 +11,16 @@ import (
 var NoClobber = false
 
 type _Redirecter struct {
-	path     string
-	isAppend bool
-	no       int
-	dupFrom  int
-	force    bool
+	path      string
+	isAppend  bool
+	isInput   bool
+	readWrite bool
+	no        int
+	dupFrom   int
+	closeFd   bool
+	both      bool
+	force     bool
+	hereData  *string
 }
 
 func newRedirecter(no int) *_Redirecter {
@@ -40,11 +47,34 @@ func (r *_Redirecter) SetAppend() {
 	r.isAppend = true
 }
 
+// SetHereData makes the redirecter feed data to the standard input.
+func (r *_Redirecter) SetHereData(data string) {
+	r.hereData = &data
+}
+
+// openHereData returns the pipe which the here-document is written into.
+func (r *_Redirecter) openHereData() (*os.File, error) {
+	pipeIn, pipeOut, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func(data string) {
+		io.WriteString(pipeOut, data)
+		pipeOut.Close()
+	}(*r.hereData)
+	return pipeIn, nil
+}
+
 func (r *_Redirecter) open() (*os.File, error) {
+	if r.hereData != nil {
+		return r.openHereData()
+	}
 	if r.path == "" {
 		return nil, errors.New("_Redirecter.open(): path=\"\"")
 	}
-	if r.no == 0 {
+	if r.readWrite {
+		return os.OpenFile(r.path, os.O_RDWR|os.O_CREATE, 0666)
+	} else if r.isInput {
 		return os.Open(r.path)
 	} else if r.isAppend {
 		return os.OpenFile(r.path, os.O_APPEND|os.O_CREATE, 0666)
@@ -59,32 +89,91 @@ func (r *_Redirecter) open() (*os.File, error) {
 	}
 }
 
-func (r *_Redirecter) OpenOn(cmd *Cmd) (*os.File, error) {
+func (r *_Redirecter) OpenOn(sh *Shell) (*os.File, error) {
 	var fd *os.File
 	var err error
 
-	switch r.dupFrom {
-	case 0:
-		fd = cmd.Stdin
-	case 1:
-		fd = cmd.Stdout
-	case 2:
-		fd = cmd.Stderr
-	default:
+	if r.closeFd && r.no <= 2 {
+		// the programs expect the standard handles, so the closed ones are the null device.
+		fd, err = os.OpenFile(os.DevNull, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+	} else if r.closeFd {
+		fd = nil
+	} else if r.dupFrom >= 0 {
+		fd = sh.File(r.dupFrom)
+		if fd == nil {
+			return nil, fmt.Errorf("%d: Bad file descriptor", r.dupFrom)
+		}
+	} else {
 		fd, err = r.open()
 		if err != nil {
 			return nil, err
 		}
 	}
-	switch r.FileNo() {
-	case 0:
-		cmd.Stdin = fd
-	case 1:
-		cmd.Stdout = fd
-	case 2:
-		cmd.Stderr = fd
-	default:
-		panic("Assertion failed: _Redirecter.OpenAs: r.no not in (0,1,2)")
+	sh.setFile(r.FileNo(), fd)
+	if r.both {
+		sh.setFile(2, fd)
 	}
 	return fd, nil
 }
+
+// redirecterOf makes the redirecter for the node of the syntax tree.
+func redirecterOf(node *RedirectNode, subst substituteFunc, procSubst processSubstituteFunc) (*_Redirecter, error) {
+	red := newRedirecter(node.FileNo)
+	red.isInput = node.IsInput
+	red.readWrite = node.ReadWrite
+	red.both = node.Both
+	if node.Close {
+		red.closeFd = true
+	} else if node.DupFrom >= 0 {
+		red.DupFrom(node.DupFrom)
+	} else if node.HereDoc {
+		if _, quoted := hereDocumentTerminator(node.Target.Text); quoted {
+			red.SetHereData(node.HereBody)
+		} else {
+			red.SetHereData(expandPercent(node.HereBody))
+		}
+	} else if node.HereString {
+		text, err := string2path(node.Target.Text, subst, procSubst)
+		if err != nil {
+			return nil, err
+		}
+		red.SetHereData(text + "\n")
+	} else {
+		path, err := string2path(node.Target.Text, subst, procSubst)
+		if err != nil {
+			return nil, err
+		}
+		red.SetPath(path)
+	}
+	if node.IsAppend {
+		red.SetAppend()
+	}
+	red.force = node.Force
+	return red, nil
+}
+
+// openRedirects opens the redirections of the syntax tree on sh
+// and returns the files to be closed after the command finishes.
+func (sh *Shell) openRedirects(nodes []*RedirectNode, subst substituteFunc, procSubst processSubstituteFunc) ([]io.Closer, error) {
+	closers := make([]io.Closer, 0, len(nodes))
+	for _, node := range nodes {
+		red, err := redirecterOf(node, subst, procSubst)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		fd, err := red.OpenOn(sh)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		if node.DupFrom < 0 && fd != nil {
+			// the duplicated file is owned by the parent.
+			closers = append(closers, fd)
+		}
+	}
+	return closers, nil
+}
@@ -5,11 +5,19 @@ import (
 	"unicode"
 )
 
-func splitToStatement(line string) []string {
+// isCommandStart returns true when the next word is at the position
+// of the command-name. lastc is the last non-space character.
+func isCommandStart(lastc rune) bool {
+	return lastc == NOTQUOTED || strings.ContainsRune(";&|({", lastc)
+}
+
+// SplitToStatement splits line into the statements separated with ` ; `.
+func SplitToStatement(line string) []string {
 	result := make([]string, 0)
 	quote := false
 	var buffer strings.Builder
 	lastc := ' '
+	lastNonSpace := NOTQUOTED
 
 	done := func() {
 		result = append(result, buffer.String())
@@ -17,17 +25,89 @@ func splitToStatement(line string) []string {
 		buffer.Reset()
 	}
 
-	for _, c := range line {
+	nest := 0
+	brace := 0
+	backquote := false
+	runes := []rune(line)
+	for i, c := range runes {
+		standalone := unicode.IsSpace(lastc) && (i+1 >= len(runes) || unicode.IsSpace(runes[i+1]))
 		if c == '"' {
 			quote = !quote
-		} else if !quote && c == ';' && unicode.IsSpace(lastc) {
+		} else if quote || backquote {
+			if c == '`' {
+				backquote = !backquote
+			}
+		} else if c == '`' {
+			backquote = true
+		} else if c == '(' && (lastc == '$' || lastc == '<' || lastc == '>' || nest > 0 || ((unicode.IsSpace(lastc) || lastc == lastNonSpace) && isCommandStart(lastNonSpace))) {
+			nest++
+		} else if c == ')' && nest > 0 {
+			nest--
+		} else if c == '{' && standalone && isCommandStart(lastNonSpace) {
+			brace++
+		} else if c == '}' && standalone && brace > 0 {
+			brace--
+		} else if nest <= 0 && brace <= 0 && c == ';' && unicode.IsSpace(lastc) {
 			done()
 			lastc = c
+			lastNonSpace = NOTQUOTED
 			continue
 		}
 		buffer.WriteRune(c)
 		lastc = c
+		if !unicode.IsSpace(c) {
+			lastNonSpace = c
+		}
 	}
 	done()
 	return result
 }
+
+// trimJoiner removes `^` at the end of line or `\` as the last word of line,
+// which joins the next line.
+func trimJoiner(line string) (string, bool) {
+	if strings.HasSuffix(line, "^") {
+		return line[:len(line)-1], true
+	}
+	if line == "\\" || strings.HasSuffix(line, " \\") || strings.HasSuffix(line, "\t\\") {
+		return line[:len(line)-1], true
+	}
+	return line, false
+}
+
+// SplitLines splits the text made by the multi-line editor into lines
+// to be read one by one as the command-line.
+// A newline in quotations is kept in the line. `^` at the end of a line
+// and `\` as the last word of a line join the next line.
+// incomplete is true when the quotation is not closed or the text ends
+// with those joiners.
+func SplitLines(text string) (lines []string, incomplete bool) {
+	var buffer strings.Builder
+	quote := NOTQUOTED
+	joined := false
+	for _, c := range text {
+		joined = false
+		if c == '\n' && quote == NOTQUOTED {
+			line, ok := trimJoiner(buffer.String())
+			buffer.Reset()
+			if ok {
+				buffer.WriteString(line)
+				joined = true
+			} else {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		if quote == NOTQUOTED && (c == '"' || c == '\'') {
+			quote = c
+		} else if c == quote {
+			quote = NOTQUOTED
+		}
+		buffer.WriteRune(c)
+	}
+	line := buffer.String()
+	lines = append(lines, line)
+	_, endsWithJoiner := trimJoiner(line)
+	incomplete = quote != NOTQUOTED || joined || endsWithJoiner
+	return
+}
@@ -0,0 +1,31 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		text       string
+		lines      []string
+		incomplete bool
+	}{
+		{"echo a", []string{"echo a"}, false},
+		{"if a == a\necho b\nend", []string{"if a == a", "echo b", "end"}, false},
+		{"echo \"a\nb\" c", []string{"echo \"a\nb\" c"}, false},
+		{"echo 'a", []string{"echo 'a"}, true},
+		{"echo a ^\nb", []string{"echo a b"}, false},
+		{"echo a \\\nb", []string{"echo a b"}, false},
+		{"dir c:\\", []string{"dir c:\\"}, false},
+		{"echo a ^", []string{"echo a ^"}, true},
+		{"echo a \\", []string{"echo a \\"}, true},
+		{"echo a ^\n", []string{"echo a "}, true},
+	}
+	for _, test := range tests {
+		lines, incomplete := SplitLines(test.text)
+		if !reflect.DeepEqual(lines, test.lines) || incomplete != test.incomplete {
+			t.Fatalf("%q: %q,%v != %q,%v", test.text, lines, incomplete, test.lines, test.incomplete)
+		}
+	}
+}
@@ -56,7 +56,7 @@ func (sh *Shell) Source(ctx context.Context, fname string) error {
 	stream1 := NewCmdStreamFile(fd)
 	_, err = sh.Loop(ctx, stream1)
 	fd.Close()
-	if err == io.EOF {
+	if err == io.EOF || err == ErrReturn {
 		return nil
 	} else {
 		return err
@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/zetamatta/nyagos/dos"
+)
+
+// SubshellProcess returns the command to execute cmdline in a new process.
+// The subshells `( ... )` in the background or on the pipelines run in it,
+// so that they have their own environment variables and current directory
+// instead of changing those of the shell running on the other goroutine.
+var SubshellProcess = func(cmdline string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(self, "-c", cmdline), nil
+}
+
+// checkExtraFiles returns the error when the file-descriptors over 2 are
+// opened, which Windows can not pass to the child processes.
+func (sh *Shell) checkExtraFiles() error {
+	for i, file := range sh.extraFiles {
+		if file != nil {
+			return fmt.Errorf("%d: file-descriptors over 2 are available only for built-in commands", i+3)
+		}
+	}
+	return nil
+}
+
+// runSubshellProcess executes the subshell with SubshellProcess.
+func (sh *Shell) runSubshellProcess(ctx context.Context, n *SubshellNode) (int, error) {
+	sub := sh.subShell()
+	var procs processSubstitutions
+	defer func() { procs.cleanup(ctx, sh) }()
+	closers, err := sub.openRedirects(n.Redirects, sh.substituter(ctx), procs.starter(ctx, sh))
+	if err != nil {
+		return 0, err
+	}
+	defer closeAll(closers)
+	if err := sub.checkExtraFiles(); err != nil {
+		return 255, err
+	}
+	procs.waitInputs()
+
+	xcmd, err := SubshellProcess(n.Body.String())
+	if err != nil {
+		return 255, err
+	}
+	xcmd.Stdin = sub.Stdin
+	xcmd.Stdout = sub.Stdout
+	xcmd.Stderr = sub.Stderr
+	err = xcmd.Start()
+	if err == nil {
+		if sub.job != nil {
+			sub.job.addProcess(xcmd.Process)
+		}
+		err = xcmd.Wait()
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		// the subshell has already reported its errors.
+		err = nil
+	}
+	if errorlevel, ok := dos.GetErrorLevel(xcmd); ok {
+		return errorlevel, err
+	}
+	return 255, err
+}